@@ -50,14 +50,20 @@ var Diff = &command.Command{
 		redacted := cmd.Options["redacted"].ToValue().(bool)
 		remote := cmd.Options["remote"].ToValue().(bool)
 		for _, path := range paths {
-
-			local, err := config.Load(path, false)
+			file, err := config.LoadFile(path)
 			if err != nil {
 				return err
 			}
 
-			if err := local.DiffRemote(path, redacted, remote, cmd.Cobra.OutOrStdout(), cmd.Cobra.OutOrStderr()); err != nil {
-				return err
+			for _, doc := range file.Documents {
+				local, err := file.Flushed(doc)
+				if err != nil {
+					return err
+				}
+
+				if err := local.DiffRemote(file.Label(doc), redacted, remote, cmd.Cobra.OutOrStdout(), cmd.Cobra.OutOrStderr()); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -0,0 +1,150 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"git.rob.mx/nidito/chinampa/pkg/command"
+	"git.rob.mx/nidito/joao/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+var Docs = &command.Command{
+	Path:    []string{"docs"},
+	Summary: "generates documentation for configs",
+	Description: `Documents every ﹅CONFIG﹅ given, looking for config files inside directories. Every key path is listed with its type, whether it's secret, its comments, the description in its schema (if any) and, for non-secret values, its value as the default.
+
+Documentation is printed to stdout as a single document, unless ﹅--to﹅ is given, where a file is written for every config, mirroring the paths given, i.e. ﹅host/juazeiro.yaml﹅ is documented at ﹅DIR/host/juazeiro.md﹅.`,
+	Arguments: command.Arguments{
+		{
+			Name:        "config",
+			Description: "The directories or configuration file(s) to document",
+			Required:    true,
+			Variadic:    true,
+			Values: &command.ValueSource{
+				Files: &fileExtensions,
+			},
+		},
+	},
+	Options: command.Options{
+		"output": {
+			ShortName:   "o",
+			Description: "the format to use for rendering documentation",
+			Default:     "markdown",
+			Values: &command.ValueSource{
+				Static: &[]string{"markdown", "json"},
+			},
+		},
+		"to": {
+			Description: "A directory to write documentation for every config to, instead of stdout",
+		},
+	},
+	Action: func(cmd *command.Command) error {
+		paths := cmd.Arguments[0].ToValue().([]string)
+		format := cmd.Options["output"].ToValue().(string)
+		to := cmd.Options["to"].ToValue().(string)
+
+		docs := []*config.ConfigDoc{}
+		for _, root := range paths {
+			files, err := config.ConfigFiles(root)
+			if err != nil {
+				return err
+			}
+
+			for _, path := range files {
+				file, err := config.LoadFile(path)
+				if err != nil {
+					return err
+				}
+
+				fileDocs := []*config.ConfigDoc{}
+				for _, cfg := range file.Documents {
+					doc, err := file.Docs(cfg)
+					if err != nil {
+						return err
+					}
+					fileDocs = append(fileDocs, doc)
+				}
+
+				if to == "" {
+					docs = append(docs, fileDocs...)
+					continue
+				}
+
+				if err := writeDocs(docPath(to, root, path, format), format, fileDocs); err != nil {
+					return err
+				}
+			}
+		}
+
+		if to != "" {
+			logrus.Info("Done")
+			return nil
+		}
+
+		data, err := renderDocs(format, docs)
+		if err != nil {
+			return err
+		}
+		_, err = cmd.Cobra.OutOrStdout().Write(data)
+		return err
+	},
+}
+
+// docPath returns where to write the documentation for the config at path, found looking at root.
+func docPath(to, root, path, format string) string {
+	rel := filepath.Base(path)
+	if info, err := os.Stat(root); err == nil && info.IsDir() {
+		if r, err := filepath.Rel(root, path); err == nil {
+			rel = r
+		}
+	}
+
+	ext := ".md"
+	if format == "json" {
+		ext = ".json"
+	}
+	name := filepath.Base(rel)
+	if idx := strings.Index(name, "."); idx > 0 {
+		name = name[0:idx]
+	}
+	return filepath.Join(to, filepath.Dir(rel), name+ext)
+}
+
+func renderDocs(format string, docs []*config.ConfigDoc) ([]byte, error) {
+	if format == "json" {
+		data, err := json.MarshalIndent(docs, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+
+	sections := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		sections = append(sections, string(doc.Markdown()))
+	}
+	return []byte(strings.Join(sections, "\n")), nil
+}
+
+func writeDocs(path, format string, docs []*config.ConfigDoc) error {
+	data, err := renderDocs(format, docs)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create directory for %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	logrus.Infof("Documented %s", path)
+	return nil
+}
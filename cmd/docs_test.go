@@ -0,0 +1,40 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "git.rob.mx/nidito/joao/cmd"
+	"git.rob.mx/nidito/joao/internal/testdata"
+	"github.com/spf13/cobra"
+)
+
+func TestDocsTo(t *testing.T) {
+	to := t.TempDir()
+	out := bytes.Buffer{}
+	Docs.SetBindings()
+	cmd := &cobra.Command{}
+	cmd.Flags().String("to", to, "")
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	Docs.Cobra = cmd
+
+	if err := Docs.Run(cmd, []string{testdata.YAML("layers-prod")}); err != nil {
+		t.Fatalf("could not document: %s", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(to, "layers-prod.md"))
+	if err != nil {
+		t.Fatalf("could not read docs: %s", err)
+	}
+
+	expected := "| `port` | int | no | `5432` | inherited from layers-base.yaml |\n"
+	if !strings.Contains(string(data), expected) {
+		t.Fatalf("expected docs to contain %q, got:\n%s", expected, data)
+	}
+}
@@ -31,37 +31,52 @@ var Fetch = &command.Command{
 	},
 	Action: func(cmd *command.Command) error {
 		paths := cmd.Arguments[0].ToValue().([]string)
+		dryRun := cmd.Options["dry-run"].ToValue().(bool)
 		for _, path := range paths {
-			local, err := config.Load(path, false)
+			file, err := config.LoadFile(path)
 			if err != nil {
 				return err
 			}
 
-			if dryRun := cmd.Options["dry-run"].ToValue().(bool); dryRun {
-				logrus.Warnf("dry-run: comparing %s to %s", local.OPURL(), path)
-				stdout := cmd.Cobra.OutOrStdout()
-				stderr := cmd.Cobra.OutOrStderr()
-				if err := local.DiffRemote(path, false, true, stdout, stderr); err != nil {
+			for _, local := range file.Documents {
+				label := file.Label(local)
+				if dryRun {
+					logrus.Warnf("dry-run: comparing %s to %s", local.OPURL(), label)
+					flushed, err := file.Flushed(local)
+					if err != nil {
+						return err
+					}
+					stdout := cmd.Cobra.OutOrStdout()
+					stderr := cmd.Cobra.OutOrStderr()
+					if err := flushed.DiffRemote(label, false, true, stdout, stderr); err != nil {
+						return err
+					}
+					logrus.Warnf("dry-run: did not update %s", label)
+					continue
+				}
+
+				remote, err := config.Remote(local.Vault, local.Name)
+				if err != nil {
 					return err
 				}
-				logrus.Warnf("dry-run: did not update %s", path)
-				continue
-			}
 
-			remote, err := config.Load(path, true)
-			if err != nil {
-				return err
-			}
+				// values inherited from extended files stay there
+				overlay, err := file.Overlay(local, remote)
+				if err != nil {
+					return err
+				}
 
-			if err = local.Merge(remote); err != nil {
-				return err
+				if err = local.Merge(overlay); err != nil {
+					return err
+				}
+				logrus.Infof("Fetched %s => %s", remote.OPURL(), label)
 			}
 
-			if err := local.AsFile(path); err != nil {
-				return err
+			if !dryRun {
+				if err := file.Save(); err != nil {
+					return err
+				}
 			}
-
-			logrus.Infof("Fetched %s => %s", remote.OPURL(), path)
 		}
 
 		logrus.Info("Done")
@@ -4,6 +4,7 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"git.rob.mx/nidito/chinampa/pkg/command"
 	"git.rob.mx/nidito/joao/pkg/config"
@@ -12,9 +13,13 @@ import (
 )
 
 var Flush = &command.Command{
-	Path:        []string{"flush"},
-	Summary:     "flush configuration values to 1Password",
-	Description: `Creates or updates existing items for every ﹅CONFIG﹅ file provided. Does not delete 1Password items.`,
+	Path:    []string{"flush"},
+	Summary: "flush configuration values to 1Password",
+	Description: `Creates or updates existing items for every ﹅CONFIG﹅ file provided. Does not delete 1Password items.
+
+Values tagged ﹅!!generate﹅ are generated and saved to ﹅CONFIG﹅ as secrets before flushing, and never generated again.
+
+Values tagged ﹅!!file﹅ or ﹅!!binary﹅ are uploaded as file attachments with the ﹅op﹅ CLI. 1Password Connect can only download attachments, so ﹅joao serve﹅, the vault plugin and other Connect clients read them but fail to flush configs with new or changed files.`,
 	Arguments: command.Arguments{
 		{
 			Name:        "config",
@@ -45,30 +50,64 @@ var Flush = &command.Command{
 		}
 
 		for _, path := range paths {
-			cfg, err := config.Load(path, false)
+			file, err := config.LoadFile(path)
 			if err != nil {
 				return err
 			}
 
-			if dryRun {
-				logrus.Warnf("dry-run: comparing %s to %s", path, cfg.OPURL())
-				if err := cfg.DiffRemote(path, false, false, cmd.Cobra.OutOrStdout(), cmd.Cobra.OutOrStderr()); err != nil {
+			generated := []string{}
+			for _, doc := range file.Documents {
+				paths, err := doc.Materialize()
+				if err != nil {
 					return err
 				}
-				logrus.Warnf("dry-run: did not update %s", cfg.OPURL())
-				continue
+				generated = append(generated, paths...)
+			}
+
+			if len(generated) > 0 {
+				if dryRun {
+					logrus.Warnf("dry-run: generated values for %s will not be saved to %s", strings.Join(generated, ", "), path)
+				} else {
+					if err := file.Save(); err != nil {
+						return err
+					}
+					logrus.Infof("Generated values for %s in %s", strings.Join(generated, ", "), path)
+				}
 			}
 
-			if err := opclient.Update(cfg.Vault, cfg.Name, cfg.ToOP()); err != nil {
-				return fmt.Errorf("could not flush to 1password: %w", err)
+			for _, doc := range file.Documents {
+				if err := file.Validate(doc); err != nil {
+					return err
+				}
+			}
+
+			for _, doc := range file.Documents {
+				label := file.Label(doc)
+				cfg, err := file.Flushed(doc)
+				if err != nil {
+					return err
+				}
+
+				if dryRun {
+					logrus.Warnf("dry-run: comparing %s to %s", label, cfg.OPURL())
+					if err := cfg.DiffRemote(label, false, false, cmd.Cobra.OutOrStdout(), cmd.Cobra.OutOrStderr()); err != nil {
+						return err
+					}
+					logrus.Warnf("dry-run: did not update %s", cfg.OPURL())
+					continue
+				}
+
+				if err := cfg.Flush(); err != nil {
+					return fmt.Errorf("could not flush to 1password: %w", err)
+				}
+				logrus.Infof("Flushed %s to %s", label, cfg.OPURL())
 			}
 
-			if cmd.Options["redact"].ToValue().(bool) {
-				if err := cfg.AsFile(path, config.OutputModeRedacted); err != nil {
+			if !dryRun && cmd.Options["redact"].ToValue().(bool) {
+				if err := file.Save(config.OutputModeRedacted); err != nil {
 					return err
 				}
 			}
-			logrus.Infof("Flushed %s to %s", path, cfg.OPURL())
 		}
 
 		logrus.Info("Done")
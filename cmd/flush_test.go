@@ -3,6 +3,7 @@ package cmd_test
 import (
 	"bytes"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
@@ -114,3 +115,84 @@ func TestFlushRedacted(t *testing.T) {
 		t.Fatalf("did not get expected redacted serialization after flush.\n wanted:\n%s\n\ngot:\n%s", serialized, redactedData)
 	}
 }
+
+func TestFlushDocuments(t *testing.T) {
+	testdata.MockOPConnect(t)
+	out := &bytes.Buffer{}
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("dry-run", false, "")
+	cmd.Flags().Bool("redact", false, "")
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+
+	Flush.SetBindings()
+	Flush.Cobra = cmd
+	if err := Flush.Run(cmd, []string{testdata.YAML("multi")}); err != nil {
+		t.Fatalf("could not flush: %s", err)
+	}
+
+	for name, expected := range map[string]string{"multi:prod": "prod.example.com", "multi:staging": "staging.example.com"} {
+		item, err := opconnect.Get(name, "example")
+		if err != nil {
+			t.Fatalf("unexpected error getting flushed config %s: %s", name, err)
+		}
+
+		if got := item.GetValue("host"); got != expected {
+			t.Fatalf("unexpected host for %s: %s", name, got)
+		}
+	}
+}
+
+func TestFlushGenerates(t *testing.T) {
+	testdata.MockOPConnect(t)
+	out := &bytes.Buffer{}
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("dry-run", false, "")
+	cmd.Flags().Bool("redact", false, "")
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+
+	path := filepath.Join(t.TempDir(), "generated.yaml")
+	if err := os.WriteFile(path, []byte("_config: !!joao\n  vault: example\n  name: generated\ntoken: !!generate hex,length=8\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	Flush.SetBindings()
+	Flush.Cobra = cmd
+	if err := Flush.Run(cmd, []string{path}); err != nil {
+		t.Fatalf("could not flush: %s", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match := regexp.MustCompile(`\ntoken: !!secret ([0-9a-f]{16})\n`).FindSubmatch(data)
+	if match == nil {
+		t.Fatalf("did not save generated token, got:\n%s", data)
+	}
+
+	item, err := opconnect.Get("generated", "example")
+	if err != nil {
+		t.Fatalf("unexpected error getting flushed config: %s", err)
+	}
+
+	cfg, err := config.FromOP(item)
+	if err != nil {
+		t.Fatalf("unexpected error translating flushed config: %s", err)
+	}
+
+	if got := cfg.Tree.Lookup([]string{"token"}); got == nil || !got.IsSecret() || got.Value != string(match[1]) {
+		t.Fatalf("flushed token %s does not match saved token %s", got, match[1])
+	}
+
+	// once materialized, flushing again keeps the same value
+	if err := Flush.Run(cmd, []string{path}); err != nil {
+		t.Fatalf("could not flush again: %s", err)
+	}
+
+	if again, _ := os.ReadFile(path); !bytes.Equal(again, data) {
+		t.Fatalf("flushing again changed the file:\n%s", again)
+	}
+}
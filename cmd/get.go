@@ -5,13 +5,28 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"git.rob.mx/nidito/chinampa/pkg/command"
 	"git.rob.mx/nidito/joao/pkg/config"
 	"gopkg.in/yaml.v3"
 )
 
+var builtinFormats = []string{"raw", "json", "yaml", "diff-yaml", "op"}
+var outputFormats = append(append([]string{}, builtinFormats...), config.Formats()...)
+
+func builtinFormat(format string) bool {
+	for _, builtin := range builtinFormats {
+		if format == builtin {
+			return true
+		}
+	}
+	return false
+}
+
 var Get = &command.Command{
 	Path:    []string{"get"},
 	Summary: "retrieves configuration",
@@ -24,7 +39,30 @@ looks at the filesystem or remotely, using 1password (over the CLI if available,
   - when querying for trees or lists, this will output JSON
 - **yaml**: formats the value at the given path as YAML
 - **json**: formats the value at the given path as JSON
-- **op**: formats the whole configuration as a 1Password item`,
+- **op**: formats the whole configuration as a 1Password item
+- **dotenv**: flattens values into ﹅KEY="value"﹅ lines, so ﹅smtp.password﹅ becomes ﹅SMTP_PASSWORD﹅
+- **shell**: flattens values into ﹅export KEY='value'﹅ lines, like **dotenv**
+- **properties**: flattens values into java properties, keeping keys dot-delimited
+- **toml**: formats the value at the given path as TOML
+- **hcl**/**tfvars**: formats the value at the given path as HCL, i.e. terraform variables
+
+﹅PATH﹅ is a dot-delimited query, where dots within keys are escaped as ﹅example\.com﹅ or quoted as ﹅["example.com"]﹅. Queries may also select many values, output as a list:
+- **wildcards**: ﹅hosts.*.address﹅ selects the address of every host
+- **recursive descent**: ﹅..password﹅ selects every key named password, at any depth
+- **indices** and **slices**: ﹅roles[0]﹅, ﹅roles[-1]﹅, ﹅roles[1:3]﹅ or ﹅roles[::2]﹅
+- **filters**: ﹅roles[?(@ == "http")]﹅ or ﹅servers[?(@.port >= 8000 && @.host =~ "^web")]﹅, comparing with ﹅==﹅, ﹅!=﹅, ﹅<﹅, ﹅<=﹅, ﹅>﹅, ﹅>=﹅ and ﹅=~﹅ for regular expressions. Filters never compare secrets, so they cannot be used to guess their values
+
+Many queries are output as an object keyed by query, as JSON or YAML. Secrets stay secret when selected, so ﹅--redacted﹅ applies to them just the same.
+
+Configs extending others (﹅_config: !!joao {extends: [base.yaml]}﹅, or through ﹅overlays﹅ in ﹅.joao.yaml﹅) are shown with the values they inherit, unless ﹅--overlay﹅ is given. ﹅--origins﹅ lists the file every value below ﹅PATH﹅ came from instead.
+
+Files (﹅!!file﹅ for text, ﹅!!binary﹅ for base64-encoded data) are stored as 1Password file attachments, and output as their contents by **raw**. ﹅--to-file﹅ writes the value at ﹅PATH﹅ to a file instead, only readable by its owner if secret.
+
+One-time passwords (﹅!!otp otpauth://totp/...﹅) are output as their current code, unless ﹅--seed﹅ is given.
+
+References (﹅!!ref other/file.yaml#dotted.path﹅ or ﹅!!ref op://VAULT/ITEM/path﹅) are replaced with the values they point to, keeping them secret if they were.
+
+Integers, floats and booleans are output unquoted where the format allows. ﹅--prefix﹅, ﹅--separator﹅ and ﹅--case﹅ change how **dotenv**, **shell** and **properties** name nested keys; **dotenv** and **shell** fail on names that aren't valid variable names.`,
 	Arguments: command.Arguments{
 		{
 			Name:        "config",
@@ -36,10 +74,11 @@ looks at the filesystem or remotely, using 1password (over the CLI if available,
 		},
 		{
 			Name:        "path",
-			Default:     ".",
-			Description: "A dot-delimited path to extract from CONFIG",
+			Variadic:    true,
+			Description: "Queries for the values to extract from CONFIG, the whole of it by default",
 			Values: &command.ValueSource{
-				Func: config.AutocompleteKeysAndParents,
+				Suggestion: true,
+				Func:       config.AutocompleteKeysAndParents,
 			},
 		},
 	},
@@ -49,9 +88,25 @@ looks at the filesystem or remotely, using 1password (over the CLI if available,
 			Description: "the format to use for rendering output",
 			Default:     "raw",
 			Values: &command.ValueSource{
-				Static: &[]string{"raw", "json", "yaml", "diff-yaml", "op"},
+				Static: &outputFormats,
+			},
+		},
+		"prefix": {
+			Description: "A prefix to add to flattened keys",
+		},
+		"separator": {
+			Description: "The string to join flattened keys with",
+		},
+		"case": {
+			Description: "How to case flattened keys, defaults to upper for dotenv and shell",
+			Values: &command.ValueSource{
+				Static: &[]string{"upper", "lower", "keep"},
 			},
 		},
+		"document": {
+			ShortName:   "d",
+			Description: "The document to get from, by index or item name, when CONFIG holds many",
+		},
 		"redacted": {
 			Description: "Do not print secret values",
 			Type:        "bool",
@@ -62,21 +117,87 @@ looks at the filesystem or remotely, using 1password (over the CLI if available,
 			Type:        "bool",
 			Default:     false,
 		},
+		"overlay": {
+			Description: "Only get the values set by CONFIG, not the ones it inherits from the files it extends",
+			Type:        "bool",
+			Default:     false,
+		},
+		"origins": {
+			Description: "List the file each value came from",
+			Type:        "bool",
+			Default:     false,
+		},
+		"to-file": {
+			Description: "Write the value at PATH to a file, instead of printing it",
+			Values: &command.ValueSource{
+				Files: &[]string{},
+			},
+		},
+		"seed": {
+			Description: "Print the seeds of one-time passwords instead of their current code",
+			Type:        "bool",
+			Default:     false,
+		},
 	},
 	Action: func(cmd *command.Command) error {
 		path := cmd.Arguments[0].ToValue().(string)
-		query := cmd.Arguments[1].ToValue().(string)
+		queries := cmd.Arguments[1].ToValue().([]string)
+		if len(queries) == 0 {
+			queries = []string{"."}
+		}
 
 		remote := cmd.Options["remote"].ToValue().(bool)
 		format := cmd.Options["output"].ToValue().(string)
 		redacted := cmd.Options["redacted"].ToValue().(bool)
 
-		cfg, err := config.Load(path, remote)
+		document := cmd.Options["document"].ToValue().(string)
+
+		var cfg *config.Config
+		var err error
+		if cmd.Options["overlay"].ToValue().(bool) && !remote {
+			cfg, err = loadOverlay(path, document)
+		} else {
+			cfg, err = config.LoadDocument(path, document, remote)
+		}
 		if err != nil {
 			return err
 		}
 
+		if cmd.Options["origins"].ToValue().(bool) {
+			return printOrigins(cmd, cfg, path, queries)
+		}
+
+		if err := config.NewRefResolver(remote).ResolveConfig(cfg, path); err != nil {
+			return err
+		}
+
+		// items and diffs hold seeds, everything else gets codes, only for the values queried
+		withCodes := !cmd.Options["seed"].ToValue().(bool) && format != "op" && format != "diff-yaml"
+
+		formatOpts := &config.FormatOptions{
+			Redacted: redacted,
+			Naming: config.EnvNaming{
+				Prefix:    cmd.Options["prefix"].ToValue().(string),
+				Separator: cmd.Options["separator"].ToValue().(string),
+				Case:      cmd.Options["case"].ToValue().(string),
+			},
+		}
+
+		toFile := cmd.Options["to-file"].ToValue().(string)
+		query := queries[0]
+		if toFile != "" && (len(queries) > 1 || query == "" || query == ".") {
+			return fmt.Errorf("--to-file needs a PATH to a single value")
+		}
+
+		if len(queries) > 1 {
+			return printQueries(cmd, cfg, queries, format, redacted, withCodes)
+		}
+
 		if query == "" || query == "." {
+			if err := otpCodes(cfg.Tree, withCodes); err != nil {
+				return err
+			}
+
 			var bytes []byte
 			switch format {
 			case "yaml", "raw", "diff-yaml":
@@ -91,7 +212,7 @@ looks at the filesystem or remotely, using 1password (over the CLI if available,
 			case "json", "op":
 				bytes, err = cfg.AsJSON(redacted, format == "op")
 			default:
-				return fmt.Errorf("unknown format %s", format)
+				bytes, err = cfg.As(format, formatOpts)
 			}
 			if err != nil {
 				return err
@@ -100,19 +221,37 @@ looks at the filesystem or remotely, using 1password (over the CLI if available,
 			return err
 		}
 
-		parts := strings.Split(query, ".")
+		q, err := config.ParseQuery(query)
+		if err != nil {
+			return err
+		}
+
+		entry, err := q.Get(cfg.Tree)
+		if err != nil {
+			return err
+		}
 
-		entry := cfg.Tree
-		for _, part := range parts {
-			entry = entry.ChildNamed(part)
-			if entry == nil {
-				return fmt.Errorf("value not found at %s of %s", part, query)
-			}
+		if err := otpCodes(entry, withCodes); err != nil {
+			return err
+		}
+
+		if toFile != "" {
+			return writeValue(entry, toFile, redacted)
 		}
 
 		var bytes []byte
-		if len(entry.Content) > 0 {
-			val := entry.AsMap()
+		if !builtinFormat(format) {
+			bytes, err = config.Format(format, entry, formatOpts)
+			if err != nil {
+				return err
+			}
+		} else if len(entry.Content) > 0 || !q.Definite() {
+			modes := []config.OutputMode{}
+			if redacted {
+				modes = append(modes, config.OutputModeRedacted)
+			}
+
+			val := entry.ToMap(modes...)
 			if format == "yaml" {
 				enc := yaml.NewEncoder(cmd.Cobra.OutOrStdout())
 				enc.SetIndent(2)
@@ -123,6 +262,12 @@ looks at the filesystem or remotely, using 1password (over the CLI if available,
 			if err != nil {
 				return err
 			}
+		} else if redacted && entry.IsSecret() {
+			bytes = []byte{}
+		} else if format == "raw" && entry.IsFile() {
+			if bytes, err = entry.FileContent(); err != nil {
+				return err
+			}
 		} else {
 			bytes = []byte(entry.String())
 		}
@@ -131,3 +276,141 @@ looks at the filesystem or remotely, using 1password (over the CLI if available,
 		return err
 	},
 }
+
+// writeValue writes the scalar value at entry to path, only readable by its owner if it's secret. Files are
+// written with their contents.
+func writeValue(entry *config.Entry, path string, redacted bool) error {
+	if !entry.IsScalar() {
+		return fmt.Errorf("--to-file can only write single values, not trees")
+	}
+
+	if redacted && entry.IsSecret() {
+		return fmt.Errorf("cannot write a --redacted secret to a file")
+	}
+
+	data := []byte(entry.String())
+	var mode os.FileMode = 0644
+	if entry.IsSecret() {
+		mode = 0600
+	}
+
+	if entry.IsFile() {
+		var err error
+		if data, err = entry.FileContent(); err != nil {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return fmt.Errorf("could not write to %s: %w", path, err)
+	}
+
+	// files that already existed keep their mode otherwise
+	return os.Chmod(path, mode)
+}
+
+func loadOverlay(path, document string) (*config.Config, error) {
+	file, err := config.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return file.Select(document)
+}
+
+// printQueries outputs the values matching every query as a single object, keyed by query.
+// otpCodes replaces the seeds of one-time passwords at or below entry with their current codes, if enabled.
+func otpCodes(entry *config.Entry, enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	return entry.OTPCodes(time.Now())
+}
+
+func printQueries(cmd *command.Command, cfg *config.Config, queries []string, format string, redacted, withCodes bool) error {
+	if format != "raw" && format != "json" && format != "yaml" {
+		return fmt.Errorf("values for many queries can only be output as json or yaml, not %s", format)
+	}
+
+	modes := []config.OutputMode{}
+	if redacted {
+		modes = append(modes, config.OutputModeRedacted)
+	}
+
+	values := map[string]any{}
+	for _, query := range queries {
+		if query == "" || query == "." {
+			if err := otpCodes(cfg.Tree, withCodes); err != nil {
+				return err
+			}
+			values[query] = cfg.ToMap(append(modes, config.OutputModeNoConfig)...)
+			continue
+		}
+
+		q, err := config.ParseQuery(query)
+		if err != nil {
+			return err
+		}
+
+		entry, err := q.Get(cfg.Tree)
+		if err != nil {
+			return err
+		}
+
+		if err := otpCodes(entry, withCodes); err != nil {
+			return err
+		}
+		values[query] = entry.ToMap(modes...)
+	}
+
+	if format == "yaml" {
+		enc := yaml.NewEncoder(cmd.Cobra.OutOrStdout())
+		enc.SetIndent(2)
+		return enc.Encode(values)
+	}
+
+	bytes, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	_, err = cmd.Cobra.OutOrStdout().Write(bytes)
+	return err
+}
+
+// printOrigins lists the file every value below queries came from, relative to the working directory when possible.
+func printOrigins(cmd *command.Command, cfg *config.Config, path string, queries []string) error {
+	entries := []*config.Entry{}
+	for _, query := range queries {
+		q, err := config.ParseQuery(query)
+		if err != nil {
+			return err
+		}
+
+		if _, err := q.Get(cfg.Tree); err != nil {
+			return err
+		}
+		entries = append(entries, q.Select(cfg.Tree)...)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	own := path
+	if abs, err := filepath.Abs(path); err == nil {
+		own = abs
+	}
+
+	for _, entry := range entries {
+		for _, origin := range entry.Origins(own) {
+			file := origin.File
+			if rel, err := filepath.Rel(cwd, file); err == nil && !strings.HasPrefix(rel, "..") {
+				file = rel
+			}
+			if _, err := fmt.Fprintf(cmd.Cobra.OutOrStdout(), "%s\t%s\n", config.JoinPath(origin.Path), file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
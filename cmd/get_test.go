@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -414,3 +415,289 @@ string: pato`
 		t.Fatalf("did not get expected output:\nwanted: %s\ngot: %s", expected, got)
 	}
 }
+
+func TestGetFormat(t *testing.T) {
+	out := bytes.Buffer{}
+	Get.SetBindings()
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("redacted", true, "")
+	cmd.Flags().StringP("output", "o", "dotenv", "")
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	Get.Cobra = cmd
+	err := Get.Run(cmd, []string{testdata.YAML("test"), "nested"})
+
+	if err != nil {
+		t.Fatalf("could not get: %s", err)
+	}
+
+	expected := `NESTED_INT=1
+NESTED_BOOL=true
+NESTED_LIST_0=1
+NESTED_LIST_1=2
+NESTED_LIST_2=3
+NESTED_SECRET=""
+NESTED_SECOND_SECRET=""
+NESTED_STRING="quem"
+`
+	if got := out.String(); got != expected {
+		t.Fatalf("did not get expected output:\nwanted: %s\ngot: %s", expected, got)
+	}
+}
+
+func TestGetDocument(t *testing.T) {
+	out := bytes.Buffer{}
+	Get.SetBindings()
+	cmd := &cobra.Command{}
+	cmd.Flags().StringP("document", "d", "multi:staging", "")
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	Get.Cobra = cmd
+	if err := Get.Run(cmd, []string{testdata.YAML("multi"), "host"}); err != nil {
+		t.Fatalf("could not get: %s", err)
+	}
+
+	if got := out.String(); got != "staging.example.com" {
+		t.Fatalf("did not get expected output: %s", got)
+	}
+}
+
+func TestGetLayers(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		flag     string
+		expected string
+	}{
+		{"effective", "", "# only what differs from the base\nhost: prod.example.com\nport: 5432\npassword: !!secret base-secret\n"},
+		{"overlay", "overlay", "# only what differs from the base\nhost: prod.example.com\n"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			Get.SetBindings()
+			cmd := &cobra.Command{}
+			cmd.Flags().StringP("output", "o", "yaml", "")
+			cmd.Flags().Bool("overlay", c.flag == "overlay", "")
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			Get.Cobra = cmd
+			if err := Get.Run(cmd, []string{testdata.YAML("layers-prod"), "."}); err != nil {
+				t.Fatalf("could not get: %s", err)
+			}
+
+			got := out.String()
+			_, got, _ = strings.Cut(got, "  extends: [layers-base.yaml]\n")
+			if got != c.expected {
+				t.Fatalf("did not get expected output.\nwanted:\n%s\n---\ngot:\n%s", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetOrigins(t *testing.T) {
+	out := bytes.Buffer{}
+	Get.SetBindings()
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("origins", true, "")
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	Get.Cobra = cmd
+	if err := Get.Run(cmd, []string{testdata.YAML("layers-prod"), "."}); err != nil {
+		t.Fatalf("could not get: %s", err)
+	}
+
+	got := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{"host\tlayers-prod.yaml", "port\tlayers-base.yaml", "password\tlayers-base.yaml"}
+	if len(got) != len(expected) {
+		t.Fatalf("unexpected origins: %v", got)
+	}
+	for idx, line := range got {
+		key, file, _ := strings.Cut(line, "\t")
+		if line = key + "\t" + filepath.Base(file); line != expected[idx] {
+			t.Fatalf("unexpected origin %q, wanted %q", line, expected[idx])
+		}
+	}
+}
+
+func TestGetOTP(t *testing.T) {
+	seed := "otpauth://totp/joao?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	path := filepath.Join(t.TempDir(), "otp.yaml")
+	if err := os.WriteFile(path, []byte("_config: !!joao\n  vault: example\n  name: otp\nmfa: !!otp "+seed+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		seed     bool
+		redacted bool
+	}{
+		{"code", false, false},
+		{"seed", true, false},
+		{"redacted", false, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			Get.SetBindings()
+			cmd := &cobra.Command{}
+			cmd.Flags().Bool("seed", c.seed, "")
+			cmd.Flags().Bool("redacted", c.redacted, "")
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			Get.Cobra = cmd
+			if err := Get.Run(cmd, []string{path, "mfa"}); err != nil {
+				t.Fatalf("could not get: %s", err)
+			}
+
+			got := out.String()
+			switch {
+			case c.seed && got != seed:
+				t.Fatalf("expected seed, got %q", got)
+			case c.redacted && got != "":
+				t.Fatalf("expected nothing, got %q", got)
+			case !c.seed && !c.redacted && (len(got) != 6 || strings.Trim(got, "0123456789") != ""):
+				t.Fatalf("expected a code, got %q", got)
+			}
+		})
+	}
+}
+
+func TestGetRedactedOTP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "otp.yaml")
+	if err := os.WriteFile(path, []byte("_config: !!joao\n  vault: example\n  name: otp\nmfa: !!otp \"\"\nhost: example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for query, expected := range map[string]string{
+		"host": "example.com",
+		"mfa":  "",
+		".":    "mfa: !!otp \"\"\nhost: example.com\n",
+	} {
+		t.Run(query, func(t *testing.T) {
+			out := bytes.Buffer{}
+			Get.SetBindings()
+			cmd := &cobra.Command{}
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			Get.Cobra = cmd
+			if err := Get.Run(cmd, []string{path, query}); err != nil {
+				t.Fatalf("could not get: %s", err)
+			}
+
+			if got := strings.Replace(out.String(), "_config: !!joao\n  vault: example\n  name: otp\n", "", 1); got != expected {
+				t.Fatalf("unexpected output, wanted %q, got %q", expected, got)
+			}
+		})
+	}
+}
+
+func TestGetToFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "files.yaml")
+	if err := os.WriteFile(path, []byte("_config: !!joao\n  vault: example\n  name: files\nkeystore: !!binary AAECA/8=\nhost: example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		query    string
+		content  string
+		mode     os.FileMode
+		redacted bool
+		err      string
+	}{
+		{query: "keystore", content: "\x00\x01\x02\x03\xff", mode: 0600},
+		{query: "host", content: "example.com", mode: 0644},
+		{query: ".", err: "--to-file needs a PATH to a single value"},
+		{query: "keystore", redacted: true, err: "cannot write a --redacted secret to a file"},
+	} {
+		t.Run(c.query, func(t *testing.T) {
+			dst := filepath.Join(dir, c.query+".out")
+			Get.SetBindings()
+			cmd := &cobra.Command{}
+			cmd.Flags().String("to-file", dst, "")
+			cmd.Flags().Bool("redacted", c.redacted, "")
+			out := bytes.Buffer{}
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			Get.Cobra = cmd
+
+			err := Get.Run(cmd, []string{path, c.query})
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Fatalf("expected error %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not get: %s", err)
+			}
+
+			if out.Len() != 0 {
+				t.Fatalf("expected no output, got %q", out.String())
+			}
+
+			data, err := os.ReadFile(dst)
+			if err != nil || string(data) != c.content {
+				t.Fatalf("unexpected file contents %q: %v", data, err)
+			}
+
+			if info, err := os.Stat(dst); err != nil || info.Mode().Perm() != c.mode {
+				t.Fatalf("unexpected file mode %v: %v", info.Mode().Perm(), err)
+			}
+		})
+	}
+}
+
+func TestGetDottedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dotted.yaml")
+	if err := os.WriteFile(path, []byte("_config: !!joao\n  vault: example\n  name: dotted\nhosts:\n  example.com:\n    address: 10.0.0.1\n  example:\n    com: nope\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{`hosts.example\.com.address`, `hosts["example.com"].address`, `hosts['example.com']["address"]`} {
+		out := bytes.Buffer{}
+		Get.SetBindings()
+		cmd := &cobra.Command{}
+		cmd.SetOut(&out)
+		cmd.SetErr(&out)
+		Get.Cobra = cmd
+		if err := Get.Run(cmd, []string{path, query}); err != nil {
+			t.Fatalf("could not get %s: %s", query, err)
+		}
+
+		if got := out.String(); got != "10.0.0.1" {
+			t.Fatalf("unexpected value for %s: %q", query, got)
+		}
+	}
+}
+
+func TestGetQueries(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		queries  []string
+		redacted bool
+		expected string
+	}{
+		{"wildcard", []string{"nested.*"}, false, `[1,true,[1,2,3],"very secret","very secret","quem"]`},
+		{"recursive redacted", []string{"..secret"}, true, `["",""]`},
+		{"filter", []string{`nested.list[?(@ > 1)]`}, false, `[2,3]`},
+		{"many", []string{"int", "nested.list[0:2]", "..second_secret"}, false, `{"..second_secret":["very secret"],"int":1,"nested.list[0:2]":[1,2]}`},
+		{"many redacted", []string{"secret", "nested"}, true, `{"nested":{"bool":true,"int":1,"list":[1,2,3],"second_secret":"","secret":"","string":"quem"},"secret":""}`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			Get.SetBindings()
+			cmd := &cobra.Command{}
+			cmd.Flags().Bool("redacted", c.redacted, "")
+			cmd.Flags().StringP("output", "o", "json", "")
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			Get.Cobra = cmd
+			if err := Get.Run(cmd, append([]string{testdata.YAML("test")}, c.queries...)); err != nil {
+				t.Fatalf("could not get: %s", err)
+			}
+
+			if got := out.String(); got != c.expected {
+				t.Fatalf("unexpected output:\nwanted: %s\ngot:    %s", c.expected, got)
+			}
+		})
+	}
+}
@@ -15,7 +15,14 @@ var GitFilters = []*command.Command{
 	FilterGroup,
 }
 
-func redactedData(cmd *command.Command) error {
+// redactedData outputs the redacted contents of a file, refusing to do so for invalid configs if validate is set.
+func redactedData(validate bool) func(cmd *command.Command) error {
+	return func(cmd *command.Command) error {
+		return redact(cmd, validate)
+	}
+}
+
+func redact(cmd *command.Command, validate bool) error {
 	path := cmd.Arguments[0].ToValue().(string)
 
 	flush := false
@@ -28,22 +35,26 @@ func redactedData(cmd *command.Command) error {
 		return err
 	}
 
-	cfg, err := config.FromYAML(contents)
+	file, err := config.ParseFile(path, contents)
 	if err != nil {
 		return err
 	}
 
 	if flush {
-		name, vault, err := config.VaultAndNameFrom(path, contents)
-		if err != nil {
+		if err := file.ResolveItems(); err != nil {
 			return err
 		}
+	}
 
-		cfg.Name = name
-		cfg.Vault = vault
+	if validate {
+		for _, cfg := range file.Documents {
+			if err := file.Validate(cfg); err != nil {
+				return err
+			}
+		}
 	}
 
-	res, err := cfg.AsYAML(config.OutputModeRedacted)
+	res, err := file.Encode(config.OutputModeRedacted)
 	if err != nil {
 		return err
 	}
@@ -80,6 +91,8 @@ Then, **only once**, we need to specify which files to apply the filters and dif
 ﹅﹅﹅sh
 # adds diff and filter attributes for config files ending with .joao.yaml
 echo '**/*.joao.yaml filter=joao diff=joao' >> .gitattributes
+# and likewise for json or toml configs, if any
+echo '**/*.joao.json filter=joao diff=joao' >> .gitattributes
 # finally, commit and push these attributes
 git add .gitattributes
 git commit -m "installing joao attributes"
@@ -116,7 +129,7 @@ var FilterDiff = &command.Command{
 		},
 	},
 	Options: command.Options{},
-	Action:  redactedData,
+	Action:  redactedData(false),
 }
 
 var FilterClean = &command.Command{
@@ -124,7 +137,7 @@ var FilterClean = &command.Command{
 	Summary: "a filter for git to call when a file is checked in",
 	Description: `see ﹅joao git-filter﹅ for instructions to install this filter
 
-Use ﹅--flush﹅ to save changes to 1password before redacting file.`,
+Use ﹅--flush﹅ to save changes to 1password before redacting file. Configs that don't validate against their schema are refused, see ﹅joao validate﹅.`,
 	Arguments: command.Arguments{
 		{
 			Name:        "path",
@@ -141,5 +154,5 @@ Use ﹅--flush﹅ to save changes to 1password before redacting file.`,
 			Type:        "bool",
 		},
 	},
-	Action: redactedData,
+	Action: redactedData(true),
 }
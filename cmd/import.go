@@ -0,0 +1,138 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"git.rob.mx/nidito/chinampa/pkg/command"
+	"git.rob.mx/nidito/joao/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+var Import = &command.Command{
+	Path:    []string{"import"},
+	Summary: "converts dotenv, json, toml and sops files into joao configs",
+	Description: `Reads ﹅FILE﹅ as dotenv, json, toml or yaml, and outputs it as a joao config, marking secrets with the ﹅!!secret﹅ tag. Files encrypted with ﹅sops﹅ are decrypted first, using whatever keys are available to it, like an age key at ﹅SOPS_AGE_KEY_FILE﹅.
+
+Values are marked as secret when:
+- they were encrypted by ﹅sops﹅,
+- their key looks like it holds a secret (i.e. ﹅password﹅, ﹅token﹅, ﹅api_key﹅), unless ﹅--no-detect﹅ is given,
+- they look like a secret (private keys, urls with credentials, well known token formats), unless ﹅--no-detect﹅ is given, or
+- their dot-delimited path matches a ﹅--secret﹅ regular expression.
+
+Integers, floats and booleans keep their types. Unquoted dotenv values that look like these are imported as such, and dotenv comments are kept.
+
+Review the output before flushing, secret detection is a best-effort heuristic.`,
+	Arguments: command.Arguments{
+		{
+			Name:        "file",
+			Description: "The file to import",
+			Required:    true,
+			Values: &command.ValueSource{
+				Files: &[]string{"env", "json", "toml", "yaml", "yml"},
+			},
+		},
+	},
+	Options: command.Options{
+		"to": {
+			Description: "Where to write the imported config, instead of stdout",
+		},
+		"format": {
+			Description: "The format of FILE, detected from its extension by default",
+			Values: &command.ValueSource{
+				Static: &[]string{"dotenv", "json", "toml", "yaml"},
+			},
+		},
+		"secret": {
+			Description: "A regular expression matching the dot-delimited path of values to mark as secret",
+			Repeated:    true,
+		},
+		"no-detect": {
+			Description: "Only mark values as secret if encrypted by sops or matched by --secret",
+			Type:        "bool",
+		},
+		"vault": {
+			Description: "The 1Password vault to set in the config's _config",
+		},
+		"name": {
+			Description: "The 1Password item name to set in the config's _config",
+		},
+		"flush": {
+			Description: "Flush the imported config to 1Password, requires --to",
+			Type:        "bool",
+		},
+	},
+	Action: func(cmd *command.Command) error {
+		path := cmd.Arguments[0].ToValue().(string)
+		to := cmd.Options["to"].ToValue().(string)
+		flush := cmd.Options["flush"].ToValue().(bool)
+
+		if flush && to == "" {
+			return fmt.Errorf("--flush requires --to")
+		}
+
+		if to != "" {
+			if _, err := os.Stat(to); err == nil {
+				return fmt.Errorf("refusing to overwrite existing file %s", to)
+			}
+		}
+
+		opts := &config.ImportOptions{
+			Format:        cmd.Options["format"].ToValue().(string),
+			DetectSecrets: !cmd.Options["no-detect"].ToValue().(bool),
+			Vault:         cmd.Options["vault"].ToValue().(string),
+			Name:          cmd.Options["name"].ToValue().(string),
+		}
+
+		for _, expr := range cmd.Options["secret"].ToValue().([]string) {
+			rule, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("invalid --secret %s: %w", expr, err)
+			}
+			opts.SecretRules = append(opts.SecretRules, rule)
+		}
+
+		cfg, err := config.Import(path, opts)
+		if err != nil {
+			return err
+		}
+
+		if to == "" {
+			bytes, err := cfg.AsYAML()
+			if err != nil {
+				return err
+			}
+			_, err = cmd.Cobra.OutOrStdout().Write(bytes)
+			return err
+		}
+
+		// secrets are written in plain text, so create it only readable by us; AsFile keeps existing permissions
+		if err := writeFileAtomically(to, nil, 0600); err != nil {
+			return err
+		}
+
+		if err := cfg.AsFile(to); err != nil {
+			return err
+		}
+		logrus.Infof("Imported %s => %s", path, to)
+
+		if !flush {
+			return nil
+		}
+
+		// load it back, so vault and name are found like for any other config
+		cfg, err = config.Load(to, false)
+		if err != nil {
+			return err
+		}
+
+		if err := cfg.Flush(); err != nil {
+			return fmt.Errorf("could not flush to 1password: %w", err)
+		}
+		logrus.Infof("Flushed %s to %s", to, cfg.OPURL())
+		return nil
+	},
+}
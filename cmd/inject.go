@@ -0,0 +1,132 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"git.rob.mx/nidito/chinampa/pkg/command"
+	"git.rob.mx/nidito/joao/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+var Inject = &command.Command{
+	Path:    []string{"inject"},
+	Summary: "renders templates with configuration values",
+	Description: `Renders the go template at ﹅--input﹅, replacing references to configuration values, and writes it to ﹅--output﹅. Templates can reference values with:
+
+- ﹅{{ joao "api/config.prod.yaml" "smtp.password" }}﹅, from a config file, relative to the template's directory (or item name with ﹅--remote﹅). Leave out the query to get the whole config as JSON,
+- ﹅{{ joao "op://prod/service:api/smtp/password" }}﹅, from a 1Password item, or
+- ﹅{{ joao "joao://prod/service:api#smtp.password" }}﹅ or ﹅{{ joao "joao://prod/service:api" "smtp.password" }}﹅, from a 1Password item queried like config files are.
+
+Each config or item is loaded only once, no matter how many times it's referenced. Trees and lists are rendered as JSON.
+
+Output is written atomically, with ﹅--mode﹅ permissions. Use ﹅--redacted﹅ to preview a template without any secret values.`,
+	Options: command.Options{
+		"input": {
+			ShortName:   "i",
+			Description: "The template to render, - reads from stdin",
+			Default:     "-",
+		},
+		"output": {
+			ShortName:   "o",
+			Description: "Where to write the rendered template, - writes to stdout",
+			Default:     "-",
+		},
+		"mode": {
+			Description: "The octal permissions to write --output with",
+			Default:     "0600",
+		},
+		"redacted": {
+			Description: "Do not render secret values",
+			Type:        "bool",
+			Default:     false,
+		},
+		"remote": {
+			Description: "Get values from 1password",
+			Type:        "bool",
+			Default:     false,
+		},
+	},
+	Action: func(cmd *command.Command) error {
+		input := cmd.Options["input"].ToValue().(string)
+		output := cmd.Options["output"].ToValue().(string)
+		remote := cmd.Options["remote"].ToValue().(bool)
+		redacted := cmd.Options["redacted"].ToValue().(bool)
+
+		mode, err := strconv.ParseUint(cmd.Options["mode"].ToValue().(string), 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid --mode: %w", err)
+		}
+
+		var source []byte
+		dir := "."
+		if input == "-" {
+			source, err = io.ReadAll(cmd.Cobra.InOrStdin())
+		} else {
+			source, err = os.ReadFile(input)
+			dir = filepath.Dir(input)
+		}
+		if err != nil {
+			return fmt.Errorf("could not read template %s: %w", input, err)
+		}
+
+		rendered := bytes.Buffer{}
+		if err := config.NewRenderer(dir, remote, redacted).Render(input, string(source), &rendered); err != nil {
+			return err
+		}
+
+		if output == "-" {
+			_, err = cmd.Cobra.OutOrStdout().Write(rendered.Bytes())
+			return err
+		}
+
+		if err := writeFileAtomically(output, rendered.Bytes(), fs.FileMode(mode)); err != nil {
+			return err
+		}
+
+		logrus.Infof("Rendered %s => %s", input, output)
+		return nil
+	},
+}
+
+// writeFileAtomically writes data to a temporary file next to path, and moves it to path once it's complete.
+func writeFileAtomically(path string, data []byte, mode fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp already limits access to the current user, make sure it's never looser than that while writing
+	if err := tmp.Chmod(mode & 0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not set permissions for %s: %w", path, err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("could not set permissions for %s: %w", path, err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,171 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "git.rob.mx/nidito/joao/cmd"
+	"git.rob.mx/nidito/joao/internal/testdata"
+	"git.rob.mx/nidito/joao/internal/testdata/opconnect"
+	"git.rob.mx/nidito/joao/pkg/config"
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
+	"github.com/1Password/connect-sdk-go/connect"
+	"github.com/1Password/connect-sdk-go/onepassword"
+	"github.com/spf13/cobra"
+)
+
+const injectTemplate = `string={{ joao "test.yaml" "string" }}
+secret={{ joao "test.yaml" "nested.secret" }}
+list={{ joao "test.yaml" "nested.list" }}
+remote={{ joao "op://example/some:test/nested/string" }}
+inline={{ joao "joao://example/some:test#nested.secret" }}
+query={{ joao "joao://example/some:test" "nested.string" }}.
+text=joao://example/some:test#nested.secret is left as-is.
+`
+
+func injectWith(t *testing.T, input, output string, redacted bool) (string, error) {
+	t.Helper()
+	out := bytes.Buffer{}
+	Inject.SetBindings()
+	cmd := &cobra.Command{}
+	cmd.Flags().String("input", input, "")
+	cmd.Flags().String("output", output, "")
+	cmd.Flags().Bool("redacted", redacted, "")
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	Inject.Cobra = cmd
+	err := Inject.Run(cmd, []string{})
+	return out.String(), err
+}
+
+func injectTemplateFile(t *testing.T) string {
+	t.Helper()
+	testdata.MockOPConnect(t)
+	opconnect.Add(testdata.NewTestConfig("some:test"))
+
+	// relative paths are resolved from the template's directory
+	input := filepath.Join(filepath.Dir(testdata.YAML("test")), "inject-test.tpl")
+	if err := os.WriteFile(input, []byte(injectTemplate), 0600); err != nil {
+		t.Fatalf("could not write template: %s", err)
+	}
+	t.Cleanup(func() { os.Remove(input) })
+	return input
+}
+
+func TestInject(t *testing.T) {
+	input := injectTemplateFile(t)
+	output := filepath.Join(testdata.TempDir(t, "inject"), "out.conf")
+
+	if _, err := injectWith(t, input, output, false); err != nil {
+		t.Fatalf("could not inject: %s", err)
+	}
+
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("could not read output: %s", err)
+	}
+
+	expected := `string=pato
+secret=very secret
+list=[1,2,3]
+remote=quem
+inline=very secret
+query=quem.
+text=joao://example/some:test#nested.secret is left as-is.
+`
+	if string(got) != expected {
+		t.Fatalf("did not get expected output:\nwanted: %s\ngot: %s", expected, got)
+	}
+
+	info, err := os.Stat(output)
+	if err != nil {
+		t.Fatalf("could not stat output: %s", err)
+	}
+
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Fatalf("output was written with mode %o", mode)
+	}
+}
+
+func TestInjectRedacted(t *testing.T) {
+	input := injectTemplateFile(t)
+
+	got, err := injectWith(t, input, "-", true)
+	if err != nil {
+		t.Fatalf("could not inject: %s", err)
+	}
+
+	expected := `string=pato
+secret=
+list=[1,2,3]
+remote=quem
+inline=
+query=quem.
+text=joao://example/some:test#nested.secret is left as-is.
+`
+	if got != expected {
+		t.Fatalf("did not get expected output:\nwanted: %s\ngot: %s", expected, got)
+	}
+}
+
+// fetchCounter counts the times every item is fetched from 1Password Connect.
+type fetchCounter struct {
+	*opconnect.Client
+	fetched map[string]int
+}
+
+func (c *fetchCounter) GetItem(itemQuery, vaultQuery string) (*onepassword.Item, error) {
+	c.fetched[itemQuery]++
+	return c.Client.GetItem(itemQuery, vaultQuery)
+}
+
+func TestInjectFetchesItemsOnce(t *testing.T) {
+	testdata.MockOPConnect(t)
+	counter := &fetchCounter{Client: &opconnect.Client{}, fetched: map[string]int{}}
+	opclient.ConnectClientFactory = func(host, token, userAgent string) connect.Client {
+		return counter
+	}
+	opclient.Use(opclient.NewConnect("", ""))
+	defer testdata.MockOPConnect(t)
+
+	opconnect.Add(testdata.NewTestConfig("some:test"))
+	app, err := config.FromYAML([]byte("alias: !!ref op://example/some:test/nested/string\n"))
+	if err != nil {
+		t.Fatalf("could not parse config: %s", err)
+	}
+	app.Vault = "example"
+	app.Name = "app"
+	item, err := app.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+	opconnect.Add(item)
+
+	input := filepath.Join(t.TempDir(), "fetch.tpl")
+	template := `{{ joao "joao://example/app#alias" }} {{ joao "op://example/some:test/string" }} {{ joao "joao://example/app" "alias" }}`
+	if err := os.WriteFile(input, []byte(template), 0600); err != nil {
+		t.Fatalf("could not write template: %s", err)
+	}
+
+	got, err := injectWith(t, input, "-", false)
+	if err != nil {
+		t.Fatalf("could not inject: %s", err)
+	}
+
+	if expected := "quem pato quem"; got != expected {
+		t.Fatalf("did not get expected output:\nwanted: %s\ngot: %s", expected, got)
+	}
+
+	for name, times := range counter.fetched {
+		if times != 1 {
+			t.Fatalf("fetched %s %d times: %v", name, times, counter.fetched)
+		}
+	}
+	if len(counter.fetched) != 2 {
+		t.Fatalf("unexpected items fetched: %v", counter.fetched)
+	}
+}
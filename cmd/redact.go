@@ -27,12 +27,12 @@ var Redact = &command.Command{
 		paths := cmd.Arguments[0].ToValue().([]string)
 
 		for _, path := range paths {
-			cfg, err := config.Load(path, false)
+			file, err := config.LoadFile(path)
 			if err != nil {
 				return err
 			}
 
-			if err := cfg.AsFile(path, config.OutputModeRedacted); err != nil {
+			if err := file.Save(config.OutputModeRedacted); err != nil {
 				return err
 			}
 		}
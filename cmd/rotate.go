@@ -0,0 +1,192 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"git.rob.mx/nidito/chinampa/pkg/command"
+	"git.rob.mx/nidito/joao/pkg/config"
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
+	"github.com/sirupsen/logrus"
+)
+
+const rotationDescription = `Flushing records when every secret was last rotated, whenever its value changes, as ﹅~rotated-at.PATH﹅ annotations in 1Password items. Secrets may go without rotation for the ﹅maxAge﹅ set for the key or one of its parents in ﹅_config.secrets﹅, then the ﹅maxAge﹅ of ﹅_config﹅, then the one in ﹅.joao.yaml﹅, accepting durations like ﹅90d﹅, ﹅2w﹅ or ﹅36h﹅:
+
+﹅﹅﹅yaml
+_config: !!joao
+  maxAge: 180d
+  secrets:
+    db.password:
+      maxAge: 30d
+      generate: {kind: password, length: 32}
+﹅﹅﹅
+
+Secrets declared with ﹅!!generate﹅ keep their generator in ﹅_config.secrets﹅ once generated.`
+
+// inDays describes a duration in days, for humans.
+func inDays(age time.Duration) string {
+	days := int(age.Hours() / 24)
+	if days == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+var Stale = &command.Command{
+	Path:        []string{"stale"},
+	Summary:     "lists secrets overdue for rotation",
+	Description: "Lists the secrets in every config file found at ﹅DIR﹅ that were rotated longer ago than their max age, or whose rotation was never recorded.\n\n" + rotationDescription,
+	Arguments: command.Arguments{
+		{
+			Name:        "dir",
+			Description: "The directories or configuration files to check, the current directory by default",
+			Required:    false,
+			Variadic:    true,
+			Values: &command.ValueSource{
+				Files: &fileExtensions,
+			},
+		},
+	},
+	Action: func(cmd *command.Command) error {
+		paths := cmd.Arguments[0].ToValue().([]string)
+		if len(paths) == 0 {
+			paths = []string{"."}
+		}
+
+		files, err := config.ConfigFiles(paths...)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		stale := 0
+		for _, path := range files {
+			file, err := config.LoadFile(path)
+			if err != nil {
+				return err
+			}
+
+			for _, cfg := range file.Documents {
+				item, err := opclient.Get(cfg.Vault, cfg.Name)
+				if err != nil {
+					if !opclient.ItemMissingError(cfg.Name, err) {
+						return fmt.Errorf("could not fetch %s: %w", cfg.OPURL(), err)
+					}
+					item = nil
+				}
+
+				secrets, err := file.Stale(cfg, item, now)
+				if err != nil {
+					return err
+				}
+
+				for _, secret := range secrets {
+					stale++
+					rotated := "has no rotation recorded"
+					if !secret.RotatedAt.IsZero() {
+						rotated = fmt.Sprintf("was rotated %s ago", inDays(now.Sub(secret.RotatedAt)))
+					}
+
+					if _, err := fmt.Fprintf(cmd.Cobra.OutOrStdout(), "%s: %s %s, max age is %s\n", file.Label(cfg), config.JoinPath(secret.Path), rotated, inDays(secret.MaxAge)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if stale > 0 {
+			return fmt.Errorf("%d secrets are overdue for rotation", stale)
+		}
+
+		logrus.Info("No secrets are overdue for rotation")
+		return nil
+	},
+}
+
+var Rotate = &command.Command{
+	Path:        []string{"rotate"},
+	Summary:     "regenerates and flushes a secret",
+	Description: "Replaces the secret at ﹅PATH﹅ of ﹅CONFIG﹅ with a new value from its configured generator, or the one specified with ﹅--generate﹅, saves it and flushes it to 1Password.\n\n" + rotationDescription,
+	Arguments: command.Arguments{
+		{
+			Name:        "config",
+			Description: "The configuration file holding the secret",
+			Required:    true,
+			Values: &command.ValueSource{
+				Files: &fileExtensions,
+			},
+		},
+		{
+			Name:        "path",
+			Required:    true,
+			Description: "A dot-delimited path to the secret to rotate",
+			Values: &command.ValueSource{
+				SuggestRaw: true,
+				Suggestion: true,
+				Func:       config.AutocompleteKeys,
+			},
+		},
+	},
+	Options: command.Options{
+		"generate": {
+			Description: "Generate the new value from a SPEC, like password,length=32, instead of the configured one",
+		},
+		"document": {
+			ShortName:   "d",
+			Description: "The document to modify, by index or item name, when CONFIG holds many",
+		},
+	},
+	Action: func(cmd *command.Command) error {
+		path := cmd.Arguments[0].ToValue().(string)
+		query := cmd.Arguments[1].ToValue().(string)
+
+		var generator *config.Generator
+		if spec := cmd.Options["generate"].ToValue().(string); spec != "" {
+			var err error
+			if generator, err = config.ParseGenerator(spec); err != nil {
+				return err
+			}
+		}
+
+		file, err := config.LoadFile(path)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := file.Select(cmd.Options["document"].ToValue().(string))
+		if err != nil {
+			return err
+		}
+
+		parts, err := config.SplitPath(query)
+		if err != nil {
+			return err
+		}
+
+		if err := file.Rotate(cfg, parts, generator); err != nil {
+			return err
+		}
+
+		if err := file.Validate(cfg); err != nil {
+			return err
+		}
+
+		if err := file.Save(); err != nil {
+			return err
+		}
+
+		flushed, err := file.Flushed(cfg)
+		if err != nil {
+			return err
+		}
+
+		if err := flushed.Flush(); err != nil {
+			return fmt.Errorf("could not flush to 1password: %w", err)
+		}
+
+		logrus.Infof("Rotated %s in %s", query, file.Label(cfg))
+		return nil
+	},
+}
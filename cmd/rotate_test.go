@@ -0,0 +1,78 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "git.rob.mx/nidito/joao/cmd"
+	"git.rob.mx/nidito/joao/internal/testdata"
+	"git.rob.mx/nidito/joao/internal/testdata/opconnect"
+	"git.rob.mx/nidito/joao/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+func TestStaleAndRotate(t *testing.T) {
+	testdata.MockOPConnect(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	if err := os.WriteFile(path, []byte(`_config: !!joao
+  vault: example
+  name: app
+  maxAge: 30d
+  secrets:
+    token:
+      generate: hex,length=8
+token: !!secret 0011223344556677
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	cmd := &cobra.Command{}
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	Stale.SetBindings()
+	Stale.Cobra = cmd
+
+	if err := Stale.Run(cmd, []string{dir}); err == nil || !strings.Contains(out.String(), "app.yaml: token has no rotation recorded, max age is 30 days") {
+		t.Fatalf("expected unflushed token to be stale, got %v: %s", err, out.String())
+	}
+
+	rotate := &cobra.Command{}
+	rotate.Flags().String("generate", "", "")
+	rotate.Flags().StringP("document", "d", "", "")
+	rotate.SetOut(out)
+	rotate.SetErr(out)
+	Rotate.SetBindings()
+	Rotate.Cobra = rotate
+	if err := Rotate.Run(rotate, []string{path, "token"}); err != nil {
+		t.Fatalf("could not rotate: %s", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "0011223344556677") {
+		t.Fatalf("token was not rotated:\n%s", data)
+	}
+
+	item, err := opconnect.Get("app", "example")
+	if err != nil {
+		t.Fatalf("rotated token was not flushed: %s", err)
+	}
+	if at, ok := config.RotatedAt(item)["token"]; !ok || time.Since(at) > time.Minute {
+		t.Fatalf("rotation was not recorded: %s", at)
+	}
+
+	out.Reset()
+	if err := Stale.Run(cmd, []string{dir}); err != nil {
+		t.Fatalf("expected no stale secrets after rotating, got %s: %s", err, out.String())
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"git.rob.mx/nidito/chinampa/pkg/command"
+	"git.rob.mx/nidito/joao/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+var Run = &command.Command{
+	Path:    []string{"run"},
+	Summary: "runs a command with configuration values as environment variables",
+	Description: `Flattens the configuration values at each ﹅--config﹅ into environment variables, and runs ﹅COMMAND﹅ with them added to the current environment. Values are only ever handed over to ﹅COMMAND﹅'s environment, never written to disk or passed as arguments. Signals received by joao are forwarded to ﹅COMMAND﹅, and joao exits with its status.
+
+Keys are joined by ﹅--separator﹅ and upper-cased, so ﹅smtp.password﹅ becomes ﹅SMTP_PASSWORD﹅ and ﹅list.0﹅ becomes ﹅LIST_0﹅. Characters other than letters, digits and underscores are replaced with underscores.
+
+﹅--config﹅ can be given multiple times, with values from later configs taking precedence, and can be either:
+- a path to a local config file, or an item name with ﹅--remote﹅, or
+- a reference to a 1Password item, optionally narrowed to a key, like ﹅op://VAULT/ITEM/smtp﹅.
+
+﹅﹅﹅sh
+joao run --config api/config.prod.yaml --prefix APP_ -- ./api serve
+joao run --config op://prod/service:api/smtp -- ./mailer
+﹅﹅﹅`,
+	Arguments: command.Arguments{
+		{
+			Name:        "command",
+			Description: "The command to run, followed by its arguments",
+			Required:    true,
+			Variadic:    true,
+		},
+	},
+	Options: command.Options{
+		"config": {
+			ShortName:   "c",
+			Description: "A config file, item name (with --remote) or op:// reference to read values from",
+			Repeated:    true,
+		},
+		"prefix": {
+			Description: "A prefix to add to every variable name",
+		},
+		"separator": {
+			Description: "The string to join keys with",
+			Default:     "_",
+		},
+		"case": {
+			Description: "How to case variable names",
+			Default:     "upper",
+			Values: &command.ValueSource{
+				Static: &[]string{"upper", "lower", "keep"},
+			},
+		},
+		"remote": {
+			Description: "Get values from 1password",
+			Type:        "bool",
+			Default:     false,
+		},
+	},
+	Action: func(cmd *command.Command) error {
+		args := cmd.Arguments[0].ToValue().([]string)
+		refs := cmd.Options["config"].ToValue().([]string)
+		remote := cmd.Options["remote"].ToValue().(bool)
+		naming := &config.EnvNaming{
+			Prefix:    cmd.Options["prefix"].ToValue().(string),
+			Separator: cmd.Options["separator"].ToValue().(string),
+			Case:      cmd.Options["case"].ToValue().(string),
+		}
+
+		if len(refs) == 0 {
+			return fmt.Errorf("at least one --config is required")
+		}
+
+		env := map[string]string{}
+		for _, ref := range refs {
+			entry, err := envEntry(ref, remote)
+			if err != nil {
+				return err
+			}
+
+			vars, err := entry.AsEnv(naming)
+			if err != nil {
+				return fmt.Errorf("could not set environment from %s: %w", ref, err)
+			}
+
+			for name, value := range vars {
+				env[name] = value
+			}
+		}
+
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		logrus.Debugf("running %s with %v", args[0], names)
+
+		child := exec.Command(args[0], args[1:]...) // nolint: gosec
+		// exec keeps the last value of duplicate keys, so ours take precedence
+		child.Env = os.Environ()
+		for _, name := range names {
+			child.Env = append(child.Env, name+"="+env[name])
+		}
+		child.Stdin = cmd.Cobra.InOrStdin()
+		child.Stdout = cmd.Cobra.OutOrStdout()
+		child.Stderr = cmd.Cobra.ErrOrStderr()
+
+		return runChild(child)
+	},
+}
+
+func envEntry(ref string, remote bool) (*config.Entry, error) {
+	if config.IsOPReference(ref) {
+		opRef, err := config.ParseOPReference(ref)
+		if err != nil {
+			return nil, err
+		}
+		_, entry, err := opRef.Load()
+		if err != nil {
+			return nil, err
+		}
+		return entry, config.NewRefResolver(false).Resolve(entry, "")
+	}
+
+	cfg, err := config.Load(ref, remote)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Tree, config.NewRefResolver(remote).ResolveConfig(cfg, ref)
+}
+
+// ChildExitError is returned when the command given to `joao run` fails, with the status joao should exit with.
+type ChildExitError struct {
+	Command string
+	Code    int
+}
+
+func (e *ChildExitError) Error() string {
+	return fmt.Sprintf("%s exited with status %d", e.Command, e.Code)
+}
+
+// runChild runs child until it exits, forwarding signals to it, and returning a ChildExitError if it fails.
+func runChild(child *exec.Cmd) error {
+	// signals are caught before starting child, so joao doesn't die and leave it orphaned
+	signals := make(chan os.Signal, 8)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
+	if err := child.Start(); err != nil {
+		signal.Stop(signals)
+		return fmt.Errorf("could not start %s: %w", child.Path, err)
+	}
+
+	go func() {
+		for sig := range signals {
+			if err := child.Process.Signal(sig); err != nil {
+				logrus.Debugf("could not forward %s to child: %s", sig, err)
+			}
+		}
+	}()
+
+	err := child.Wait()
+	signal.Stop(signals)
+	close(signals)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			code = 128 + int(status.Signal())
+		}
+		return &ChildExitError{Command: child.Path, Code: code}
+	}
+
+	return err
+}
@@ -0,0 +1,83 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+
+	. "git.rob.mx/nidito/joao/cmd"
+	"git.rob.mx/nidito/joao/internal/testdata"
+	"git.rob.mx/nidito/joao/internal/testdata/opconnect"
+	"github.com/spf13/cobra"
+)
+
+func runWith(t *testing.T, configs []string, prefix string, args ...string) (string, error) {
+	t.Helper()
+	out := bytes.Buffer{}
+	Run.SetBindings()
+	cmd := &cobra.Command{}
+	cmd.Flags().StringArray("config", configs, "")
+	cmd.Flags().String("prefix", prefix, "")
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	Run.Cobra = cmd
+	err := Run.Run(cmd, args)
+	return out.String(), err
+}
+
+func TestRunLocal(t *testing.T) {
+	got, err := runWith(t, []string{testdata.YAML("test")}, "", "sh", "-c", `echo "$STRING $NESTED_SECRET $NESTED_LIST_2 $LIST_0"`)
+	if err != nil {
+		t.Fatalf("could not run: %s", err)
+	}
+
+	if expected := "pato very secret 3 one"; strings.TrimSpace(got) != expected {
+		t.Fatalf("did not get expected output:\nwanted: %s\ngot: %s", expected, got)
+	}
+}
+
+func TestRunPrefix(t *testing.T) {
+	got, err := runWith(t, []string{testdata.YAML("test")}, "app_", "sh", "-c", `echo "$APP_STRING|$STRING|$APP__CONFIG_NAME"`)
+	if err != nil {
+		t.Fatalf("could not run: %s", err)
+	}
+
+	if expected := "pato||"; strings.TrimSpace(got) != expected {
+		t.Fatalf("did not get expected output:\nwanted: %s\ngot: %s", expected, got)
+	}
+}
+
+func TestRunReference(t *testing.T) {
+	testdata.MockOPConnect(t)
+	opconnect.Add(testdata.NewTestConfig("some:test"))
+
+	got, err := runWith(t, []string{testdata.YAML("test"), "op://example/some:test/nested"}, "", "sh", "-c", `echo "$STRING $NESTED_STRING $NESTED_INT"`)
+	if err != nil {
+		t.Fatalf("could not run: %s", err)
+	}
+
+	if expected := "pato quem 1"; strings.TrimSpace(got) != expected {
+		t.Fatalf("did not get expected output:\nwanted: %s\ngot: %s", expected, got)
+	}
+
+	if _, err := runWith(t, []string{"op://example/some:test/nope"}, "", "true"); err == nil {
+		t.Fatalf("did not fail on a missing key")
+	}
+}
+
+func TestRunExitCode(t *testing.T) {
+	_, err := runWith(t, []string{testdata.YAML("test")}, "", "sh", "-c", "exit 3")
+	var exit *ChildExitError
+	if !errors.As(err, &exit) || exit.Code != 3 {
+		t.Fatalf("expected the child's exit status, got %v", err)
+	}
+
+	_, err = runWith(t, []string{testdata.YAML("test")}, "", "sh", "-c", "kill -TERM $$")
+	if !errors.As(err, &exit) || exit.Code != 128+int(syscall.SIGTERM) {
+		t.Fatalf("expected the child's signal as exit status, got %v", err)
+	}
+}
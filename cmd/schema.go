@@ -0,0 +1,133 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"git.rob.mx/nidito/chinampa/pkg/command"
+	"git.rob.mx/nidito/joao/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+var SchemaGroup = &command.Command{
+	Path:        []string{"schema"},
+	Summary:     "Subcommands to work with config schemas",
+	Description: `Schemas describe the keys configs hold, see ﹅joao validate --help﹅ for their format.`,
+	Arguments:   command.Arguments{},
+	Options:     command.Options{},
+	Action: func(cmd *command.Command) error {
+		data, err := cmd.ShowHelp(command.Root.Options, os.Args)
+		if err != nil {
+			return err
+		}
+		_, err = cmd.Cobra.OutOrStderr().Write(data)
+		return err
+	},
+}
+
+var SchemaInfer = &command.Command{
+	Path:    []string{"schema", "infer"},
+	Summary: "infers schemas from existing configs",
+	Description: `Reads every ﹅CONFIG﹅ given, looking for config files inside directories, and outputs a schema for every group of files named by the same ﹅nameTemplate﹅, i.e. all of ﹅host/*.yaml﹅ for the default ﹅{{ DirName }}:{{ FileName }}﹅.
+
+Keys found in every config (holding their parent) are marked as required, and given a type, secretness and, for non-secret strings and booleans with up to ﹅--max-enum﹅ distinct values repeated across configs, an enum. Comments tell how many configs hold every key, and list mixed types and secretness. Schemas are strict, so review them before using them with ﹅joao validate﹅.`,
+	Arguments: command.Arguments{
+		{
+			Name:        "config",
+			Description: "The directories or configuration file(s) to infer schemas from",
+			Required:    true,
+			Variadic:    true,
+			Values: &command.ValueSource{
+				Files: &fileExtensions,
+			},
+		},
+	},
+	Options: command.Options{
+		"max-enum": {
+			Description: "The most distinct values a key may hold to be listed as an enum",
+			Default:     "5",
+		},
+		"output": {
+			ShortName:   "o",
+			Description: "the format to use for rendering schemas",
+			Default:     "yaml",
+			Values: &command.ValueSource{
+				Static: &[]string{"yaml", "json"},
+			},
+		},
+	},
+	Action: func(cmd *command.Command) error {
+		paths := cmd.Arguments[0].ToValue().([]string)
+		maxEnum, err := strconv.Atoi(cmd.Options["max-enum"].ToValue().(string))
+		if err != nil {
+			return fmt.Errorf("--max-enum must be a number: %w", err)
+		}
+
+		files, err := config.ConfigFiles(paths...)
+		if err != nil {
+			return err
+		}
+
+		groups := map[string]*config.Inference{}
+		order := []string{}
+		for _, path := range files {
+			file, err := config.LoadFile(path)
+			if err != nil {
+				return err
+			}
+
+			pattern, err := config.SchemaGroup(path)
+			if err != nil {
+				return err
+			}
+
+			inference, ok := groups[pattern]
+			if !ok {
+				inference = config.NewInference(pattern)
+				groups[pattern] = inference
+				order = append(order, pattern)
+			}
+
+			for _, doc := range file.Documents {
+				cfg, err := file.Effective(doc)
+				if err != nil {
+					return err
+				}
+				inference.Add(cfg.Tree)
+			}
+			logrus.Debugf("Inferring %s from %s", pattern, path)
+		}
+
+		out := cmd.Cobra.OutOrStdout()
+		if cmd.Options["output"].ToValue().(string) == "json" {
+			schemas := map[string]*config.Schema{}
+			for pattern, inference := range groups {
+				schemas[pattern] = inference.Schema(maxEnum)
+			}
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(schemas)
+		}
+
+		for idx, pattern := range order {
+			if idx > 0 {
+				if _, err := out.Write([]byte("---\n")); err != nil {
+					return err
+				}
+			}
+
+			data, err := groups[pattern].Encode(maxEnum)
+			if err != nil {
+				return err
+			}
+			if _, err := out.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,114 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"git.rob.mx/nidito/chinampa/pkg/command"
+	"git.rob.mx/nidito/joao/internal/server"
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
+)
+
+var Serve = &command.Command{
+	Path:    []string{"serve"},
+	Summary: "Serves configuration trees over HTTP",
+	Description: `Serves the vault plugin's ﹅tree/﹅, ﹅trees/﹅ and ﹅meta/﹅ paths over HTTP, for environments without Hashicorp Vault. Responses are the same JSON the vault plugin returns as ﹅data﹅.
+
+Items are read from 1Password Connect, configured through ﹅OP_CONNECT_HOST﹅ and ﹅OP_CONNECT_TOKEN﹅, or with the ﹅op﹅ CLI when ﹅--backend cli﹅ is given.
+
+﹅CONFIG﹅ is a yaml file such as:
+
+﹅﹅﹅yaml
+listen: localhost:7200
+# the vault to use when requests don't specify one
+vault: prod
+# treat this in item titles as a directory when listing trees
+separator: ":"
+# refuse serving items modified outside of joao
+verify-checksum: true
+refresh:
+  interval: 5m
+  # ITEM from the default vault, or VAULT/ITEM
+  items: [service:api]
+tls:
+  cert: server.pem
+  key: server-key.pem
+  # verifies client certificates, if any are given
+  client-ca: clients.pem
+clients:
+  # authenticates with ﹅Authorization: Bearer TOKEN﹅, token-sha256 is the output of ﹅printf TOKEN | sha256sum﹅
+  - name: deploy
+    token-sha256: 6f1ed002ab5595859014ebf0951522d9...
+    # reads items whose VAULT/TITLE starts with any of these, or everything with "*"
+    allow: [prod/service:]
+  # authenticates with a certificate signed by tls.client-ca
+  - name: monitoring
+    common-name: monitoring.example.com
+    allow: [prod/host:]
+﹅﹅﹅
+
+Then, request:
+
+- ﹅GET /v1/tree/[VAULT/]ITEM﹅ to read a configuration tree,
+- ﹅GET /v1/meta/[VAULT/]ITEM﹅ to read its metadata,
+- ﹅GET /v1/trees/[VAULT][/PREFIX/]﹅ to list the trees a client is allowed to read, and
+- ﹅GET /v1/health﹅ to check on the server and its cache.
+
+Paths holding a slash always start with a vault, and further slashes stand in for the ﹅separator﹅, so ﹅/v1/tree/prod/service/api﹅ reads ﹅service:api﹅ from ﹅prod﹅.
+`,
+	Arguments: command.Arguments{
+		{
+			Name:        "config",
+			Description: "The server configuration file",
+			Required:    true,
+			Values: &command.ValueSource{
+				Files: &fileExtensions,
+			},
+		},
+	},
+	Options: command.Options{
+		"listen": {
+			Description: "The address to listen at, overriding the one in CONFIG",
+		},
+		"backend": {
+			Description: "How to read items from 1Password, either connect or cli",
+			Default:     "connect",
+			Values: &command.ValueSource{
+				Static: &[]string{"connect", "cli"},
+			},
+		},
+	},
+	Action: func(cmd *command.Command) error {
+		cfg, err := server.ConfigFromFile(cmd.Arguments[0].ToValue().(string))
+		if err != nil {
+			return err
+		}
+
+		if listen := cmd.Options["listen"].ToValue().(string); listen != "" {
+			cfg.Listen = listen
+		}
+
+		switch backend := cmd.Options["backend"].ToValue().(string); backend {
+		case "connect":
+			host := os.Getenv("OP_CONNECT_HOST")
+			token := os.Getenv("OP_CONNECT_TOKEN")
+			if host == "" || token == "" {
+				return fmt.Errorf("OP_CONNECT_HOST and OP_CONNECT_TOKEN must be set to use the connect backend")
+			}
+			opclient.Use(opclient.NewConnect(host, token))
+		case "cli":
+			opclient.Use(&opclient.CLI{})
+		default:
+			return fmt.Errorf("unknown backend %s, use either connect or cli", backend)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return server.New(cfg).ListenAndServe(ctx)
+	},
+}
@@ -6,11 +6,9 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strings"
 
 	"git.rob.mx/nidito/chinampa/pkg/command"
 	"git.rob.mx/nidito/joao/pkg/config"
-	opclient "git.rob.mx/nidito/joao/pkg/op-client"
 	"github.com/sirupsen/logrus"
 )
 
@@ -21,6 +19,8 @@ var Set = &command.Command{
 Updates the value at ﹅PATH﹅ in a local ﹅CONFIG﹅ file. Specify ﹅--secret﹅ to keep the value secret, or ﹅--delete﹅ to delete the key at PATH.
 
 Will read values from stdin (or ﹅--from﹅ a file) and store it at the ﹅PATH﹅ of ﹅CONFIG﹅, optionally ﹅--flush﹅ing to 1Password.
+
+Secrets can be generated instead with ﹅--generate﹅, specifying a kind followed by its options, i.e. ﹅password,length=32,charset=symbols﹅. Available kinds are ﹅password﹅, ﹅hex﹅, ﹅base64﹅, ﹅base64url﹅, ﹅uuid﹅ (﹅version=7﹅), ﹅ed25519﹅, ﹅rsa﹅ (﹅bits=2048﹅) and ﹅certificate﹅ (﹅hosts=example.com,days=90﹅). Commas within options are escaped as ﹅\,﹅, i.e. ﹅password,charset=abc\,.﹅. Keypairs are stored as ﹅PATH.private﹅ and ﹅PATH.public﹅, and certificates as ﹅PATH.cert﹅ and ﹅PATH.key﹅.
 `,
 	Arguments: command.Arguments{
 		{
@@ -63,10 +63,17 @@ Will read values from stdin (or ﹅--from﹅ a file) and store it at the ﹅PATH
 			Description: "Treat input as JSON-encoded",
 			Type:        "bool",
 		},
+		"document": {
+			ShortName:   "d",
+			Description: "The document to modify, by index or item name, when CONFIG holds many",
+		},
 		"flush": {
 			Description: "Save to 1Password after saving to PATH",
 			Type:        "bool",
 		},
+		"generate": {
+			Description: "Generate a secret value from a SPEC, like password,length=32",
+		},
 	},
 	Action: func(cmd *command.Command) error {
 		path := cmd.Arguments[0].ToValue().(string)
@@ -79,6 +86,7 @@ Will read values from stdin (or ﹅--from﹅ a file) and store it at the ﹅PATH
 		input := cmd.Options["input"].ToValue().(string)
 		parseJSON := cmd.Options["json"].ToValue().(bool)
 		flush := cmd.Options["flush"].ToValue().(bool)
+		generate := cmd.Options["generate"].ToValue().(string)
 
 		if secret && delete {
 			return fmt.Errorf("cannot --delete and set a --secret at the same time")
@@ -88,22 +96,51 @@ Will read values from stdin (or ﹅--from﹅ a file) and store it at the ﹅PATH
 			return fmt.Errorf("cannot set a --secret that is JSON encoded, encode individual values instead")
 		}
 
+		if generate != "" && (delete || parseJSON) {
+			return fmt.Errorf("cannot --generate a value while using --delete or --json")
+		}
+
+		var generator *config.Generator
+		if generate != "" {
+			if generator, err = config.ParseGenerator(generate); err != nil {
+				return err
+			}
+		}
+
 		if delete && input != "/dev/stdin" {
 			logrus.Warn("Ignoring --input while deleting")
 		}
 
-		cfg, err = config.Load(path, false)
+		file, err := config.LoadFile(path)
 		if err != nil {
 			return err
 		}
 
-		parts := strings.Split(query, ".")
+		cfg, err = file.Select(cmd.Options["document"].ToValue().(string))
+		if err != nil {
+			return err
+		}
+
+		parts, err := config.SplitPath(query)
+		if err != nil {
+			return err
+		}
 
-		if delete {
+		switch {
+		case delete:
 			if err := cfg.Delete(parts); err != nil {
 				return err
 			}
-		} else {
+		case generator != nil:
+			values, err := generator.Generate()
+			if err != nil {
+				return err
+			}
+
+			if err := cfg.SetGenerated(parts, values); err != nil {
+				return err
+			}
+		default:
 			var valueBytes []byte
 			if input == "/dev/stdin" {
 				valueBytes, err = io.ReadAll(cmd.Cobra.InOrStdin())
@@ -118,12 +155,27 @@ Will read values from stdin (or ﹅--from﹅ a file) and store it at the ﹅PATH
 			}
 		}
 
-		if err := cfg.AsFile(path); err != nil {
+		if flush {
+			if _, err := cfg.Materialize(); err != nil {
+				return err
+			}
+		}
+
+		if err := file.Validate(cfg); err != nil {
+			return err
+		}
+
+		if err := file.Save(); err != nil {
 			return err
 		}
 
 		if flush {
-			if err := opclient.Update(cfg.Vault, cfg.Name, cfg.ToOP()); err != nil {
+			flushed, err := file.Flushed(cfg)
+			if err != nil {
+				return err
+			}
+
+			if err := flushed.Flush(); err != nil {
 				return fmt.Errorf("could not flush to 1password: %w", err)
 			}
 		}
@@ -2,4 +2,4 @@
 // SPDX-License-Identifier: Apache-2.0
 package cmd
 
-var fileExtensions = []string{"joao.yaml", "yaml", "yml"}
+var fileExtensions = []string{"joao.yaml", "yaml", "yml", "joao.json", "joao.toml"}
@@ -0,0 +1,124 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"git.rob.mx/nidito/chinampa/pkg/command"
+	"git.rob.mx/nidito/joao/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+var Validate = &command.Command{
+	Path:    []string{"validate"},
+	Summary: "checks configuration files against their schema",
+	Description: `Validates every ﹅CONFIG﹅ file provided, with the values it inherits, against its schema, printing every problem found with the line and column it's at.
+
+Schemas are set with ﹅schema﹅ in a config's ﹅_config﹅ (relative to it), or in ﹅.joao.yaml﹅ (relative to it), either for every file or for files matching a glob:
+
+﹅﹅﹅yaml
+schema: schemas/default.yaml
+schemas:
+  - match: "host/*.yaml"
+    schema: schemas/host.yaml
+﹅﹅﹅
+
+Schemas can be JSON Schema documents, written in JSON or YAML, where ﹅writeOnly﹅ or ﹅x-secret﹅ tells if values must be secret. Or they can use joao's compact format, where keys are dot-delimited paths and ﹅*﹅ matches any key or list index:
+
+﹅﹅﹅yaml
+# reject keys not listed here, i.e. typos
+strict: true
+keys:
+  smtp:
+    type: map
+    required: true
+    strict: true
+  smtp.port:
+    type: int
+    required: true
+  smtp.password:
+    secret: true
+  smtp.tls:
+    enum: [none, starttls, tls]
+  servers.*.host:
+    pattern: "^[a-z0-9.-]+$"
+﹅﹅﹅
+
+Required keys must be present whenever their parent is. ﹅joao set﹅, ﹅joao flush﹅ and the ﹅git-filter clean﹅ refuse to persist configs that don't validate.`,
+	Arguments: command.Arguments{
+		{
+			Name:        "config",
+			Description: "The configuration file(s) to validate",
+			Required:    false,
+			Variadic:    true,
+			Values: &command.ValueSource{
+				Files: &fileExtensions,
+			},
+		},
+	},
+	Options: command.Options{
+		"schema": {
+			Description: "A schema to validate against, instead of the configured one",
+		},
+	},
+	Action: func(cmd *command.Command) error {
+		paths := cmd.Arguments[0].ToValue().([]string)
+
+		var schema *config.Schema
+		if path := cmd.Options["schema"].ToValue().(string); path != "" {
+			var err error
+			if schema, err = config.LoadSchema(path); err != nil {
+				return err
+			}
+		}
+
+		invalid := 0
+		total := 0
+		for _, path := range paths {
+			file, err := config.LoadFile(path)
+			if err != nil {
+				return err
+			}
+
+			for _, cfg := range file.Documents {
+				total++
+				docSchema := schema
+				if docSchema == nil {
+					schemaPath, err := file.SchemaPath(cfg)
+					if err != nil {
+						return err
+					}
+					if schemaPath == "" {
+						logrus.Warnf("No schema found for %s", file.Label(cfg))
+						continue
+					}
+					if docSchema, err = config.LoadSchema(schemaPath); err != nil {
+						return err
+					}
+				}
+
+				err := file.ValidateWith(docSchema, cfg)
+				var errs config.ValidationErrors
+				if errors.As(err, &errs) {
+					invalid++
+					if _, err := fmt.Fprintln(cmd.Cobra.OutOrStdout(), err); err != nil {
+						return err
+					}
+					continue
+				} else if err != nil {
+					return err
+				}
+				logrus.Infof("%s is valid", file.Label(cfg))
+			}
+		}
+
+		if invalid > 0 {
+			return fmt.Errorf("%d of %d configs are invalid", invalid, total)
+		}
+
+		logrus.Info("Done")
+		return nil
+	},
+}
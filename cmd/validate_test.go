@@ -0,0 +1,46 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "git.rob.mx/nidito/joao/cmd"
+	"github.com/spf13/cobra"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"schema.yaml": "strict: true\nkeys:\n  port:\n    type: int\n    required: true\n",
+		"valid.yaml":  "_config: !!joao\n  vault: example\n  name: valid\n  schema: schema.yaml\nport: 80\n",
+		"typo.yaml":   "_config: !!joao\n  vault: example\n  name: typo\n  schema: schema.yaml\nprot: 80\n",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := bytes.Buffer{}
+	Validate.SetBindings()
+	cmd := &cobra.Command{}
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	Validate.Cobra = cmd
+
+	err := Validate.Run(cmd, []string{filepath.Join(dir, "valid.yaml"), filepath.Join(dir, "typo.yaml")})
+	if err == nil || err.Error() != "1 of 2 configs are invalid" {
+		t.Fatalf("expected one invalid config, got %v", err)
+	}
+
+	expected := filepath.Join(dir, "typo.yaml") + " is invalid:\n" +
+		filepath.Join(dir, "typo.yaml") + ":1:1: port: missing required key port\n" +
+		filepath.Join(dir, "typo.yaml") + ":5:1: prot: unknown key prot\n"
+	if got := out.String(); got != expected {
+		t.Fatalf("unexpected output.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
@@ -30,7 +30,16 @@ export VERSION="$($VAULT_PLUGIN_DIR/joao --version)"
 vault plugin register -sha256="$PLUGIN_SHA" -command=joao -args="vault-plugin" -version="$VERSION" secret joao
 
 # configure, add ﹅vault﹅ to set a default vault for querying
+# credentials are verified by listing vaults before saving, add ﹅skip_verify=true﹅ to save them anyway
 vault write config/1password "host=$OP_CONNECT_HOST" "token=$OP_CONNECT_TOKEN" # vault=my-default-vault
+# the token is write-only, reading config/1password returns its fingerprint and when it was last set
+# rotate the token, requests in-flight finish with the previous one
+vault write config/1password/rotate "token=$NEW_OP_CONNECT_TOKEN"
+# optionally, keep some items cached and refreshed in the background every refresh_interval seconds
+# reads for these are served from cache, and config/meta reports when their contents last changed
+vault write config/1password refresh_interval=300 refresh_items=service:api,prod/host:juazeiro
+# optionally, refuse to serve items modified without updating their checksum (i.e. edited outside of joao)
+vault write config/1password verify_checksum=true
 
 if !(vault plugin list secret | grep -c -m1 '^joao ' >/dev/null); then
   # first time, let's enable the secrets backend
@@ -47,13 +56,26 @@ fi
 ﹅﹅﹅sh
 # VAULT is optional if configured with a default ﹅vault﹅. See above
 
+# check 1Password Connect is reachable, the token is valid, which vaults are accessible and cache stats
+vault read config/health
+
 # vault read config/tree/[VAULT/]ITEM
 vault read config/tree/service:api
 vault read config/tree/prod/service:api
 
-# vault list config/trees/[VAULT/]
+# vault read config/meta/[VAULT/]ITEM
+# returns the item's id, version, timestamps, category, tags and whether its checksum matches its contents
+vault read config/meta/service:api
+
+# vault list config/trees/[VAULT/][PREFIX]
+# item titles are split into directories by the configured ﹅separator﹅ (defaults to ﹅:﹅)
+# so ﹅service:api﹅ is listed as ﹅service/﹅ at the root, and ﹅api﹅ within it
 vault list config/trees
 vault list config/trees/prod
+vault list config/trees/prod/service/
+# configure the separator to use (for example, with a nameTemplate of ﹅{{ DirName }}/{{ FileName }}﹅)
+# items can then be read with an explicit vault: vault read config/tree/prod/service/api
+vault write config/1password separator=/
 ﹅﹅﹅
 
 See:
@@ -5,6 +5,7 @@ go 1.21
 require (
 	git.rob.mx/nidito/chinampa v0.1.4
 	github.com/1Password/connect-sdk-go v1.5.3
+	github.com/BurntSushi/toml v1.3.2
 	github.com/alessio/shellescape v1.4.2
 	github.com/hashicorp/go-hclog v1.5.0
 	github.com/hashicorp/go-version v1.6.0
@@ -0,0 +1,112 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultListen is the address joao serve listens at when none is configured.
+const DefaultListen = "localhost:7200"
+
+// Config configures joao serve.
+type Config struct {
+	// Listen is the address to listen at, defaults to DefaultListen
+	Listen string `yaml:"listen"`
+	// Vault is the default vault to read from when requests don't specify one
+	Vault string `yaml:"vault"`
+	// Separator is treated as a directory delimiter in item titles when listing trees
+	Separator string `yaml:"separator"`
+	// VerifyChecksum refuses serving items whose checksum does not match their contents
+	VerifyChecksum bool          `yaml:"verify-checksum"`
+	Refresh        RefreshConfig `yaml:"refresh"`
+	// TLS enables HTTPS and, with a client CA, authenticating clients by certificate
+	TLS     *TLSConfig `yaml:"tls"`
+	Clients []*Client  `yaml:"clients"`
+}
+
+// RefreshConfig lists items to keep cached and refreshed in the background.
+type RefreshConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	// Items are either `ITEM` (from the default vault) or `VAULT/ITEM`
+	Items []string `yaml:"items"`
+}
+
+type TLSConfig struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	// ClientCA is a PEM bundle used to verify client certificates
+	ClientCA string `yaml:"client-ca"`
+}
+
+// Client is allowed to read items whose `VAULT/TITLE` starts with any of its Allow prefixes, or every item with `*`.
+type Client struct {
+	Name string `yaml:"name"`
+	// TokenSHA256 is the hex-encoded sha256 of the bearer token this client authenticates with
+	TokenSHA256 string `yaml:"token-sha256"`
+	// CommonName is the subject common name of the certificate this client authenticates with
+	CommonName string   `yaml:"common-name"`
+	Allow      []string `yaml:"allow"`
+}
+
+// Allows tells if a client can read the item named name from vault.
+func (c *Client) Allows(vault, name string) bool {
+	ref := vault + "/" + name
+	for _, prefix := range c.Allow {
+		if prefix == "*" || strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigFromFile reads a server config from the yaml file at path.
+func ConfigFromFile(path string) (*Config, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read server config at %s: %w", path, err)
+	}
+
+	cfg := &Config{}
+	if err := yaml.Unmarshal(bytes, cfg); err != nil {
+		return nil, fmt.Errorf("could not parse server config at %s: %w", path, err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid server config at %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func (cfg *Config) validate() error {
+	if cfg.Listen == "" {
+		cfg.Listen = DefaultListen
+	}
+
+	if len(cfg.Clients) == 0 {
+		return fmt.Errorf("no clients configured")
+	}
+
+	for idx, client := range cfg.Clients {
+		if client.TokenSHA256 == "" && client.CommonName == "" {
+			return fmt.Errorf("client %d (%s) needs either a token-sha256 or a common-name", idx, client.Name)
+		}
+		client.TokenSHA256 = strings.ToLower(client.TokenSHA256)
+
+		if client.CommonName != "" && (cfg.TLS == nil || cfg.TLS.ClientCA == "") {
+			return fmt.Errorf("client %d (%s) authenticates with a certificate, but no tls.client-ca is configured", idx, client.Name)
+		}
+	}
+
+	if cfg.TLS != nil && (cfg.TLS.Cert == "" || cfg.TLS.Key == "") {
+		return fmt.Errorf("tls needs both a cert and a key")
+	}
+
+	return nil
+}
@@ -0,0 +1,367 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"git.rob.mx/nidito/joao/internal/vault/middleware"
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
+	"git.rob.mx/nidito/joao/pkg/version"
+	"github.com/1Password/connect-sdk-go/onepassword"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrorUnauthorized = fmt.Errorf("missing or invalid credentials")
+var ErrorForbidden = fmt.Errorf("permission denied")
+
+// Server serves the vault plugin's tree, trees and meta paths over HTTP, reading items from the configured
+// op-client backend.
+type Server struct {
+	config *Config
+	cache  *middleware.ItemCache
+	source middleware.ItemSource
+}
+
+// opSource reads items with the op-client backend in use.
+type opSource struct{}
+
+func (opSource) GetItem(itemQuery, vaultQuery string) (*onepassword.Item, error) {
+	return opclient.Get(vaultQuery, itemQuery)
+}
+
+func (opSource) GetItems(vaultQuery string) ([]onepassword.Item, error) {
+	return opclient.Items(vaultQuery)
+}
+
+func New(config *Config) *Server {
+	cache := middleware.NewItemCache()
+	return &Server{
+		config: config,
+		cache:  cache,
+		source: cache.Source(opSource{}),
+	}
+}
+
+// Refresh fetches the configured refresh items into the cache.
+func (s *Server) Refresh() {
+	// keep items around a little longer than the interval, so failing refreshes eventually hit 1Password
+	changed, err := s.cache.Refresh(opSource{}, s.config.Refresh.Items, s.config.Vault, 2*s.config.Refresh.Interval)
+	for _, ref := range changed {
+		logrus.Infof("item %s changed", ref)
+	}
+	if err != nil {
+		logrus.Warnf("could not refresh items: %s", err)
+	}
+}
+
+// ListenAndServe serves requests until ctx is done, refreshing the configured items in the background.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              s.config.Listen,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if s.config.Refresh.Interval > 0 && len(s.config.Refresh.Items) > 0 {
+		s.Refresh()
+		go func() {
+			ticker := time.NewTicker(s.config.Refresh.Interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					s.Refresh()
+				}
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logrus.Errorf("could not shut down cleanly: %s", err)
+		}
+	}()
+
+	var err error
+	if s.config.TLS != nil {
+		if srv.TLSConfig, err = s.tlsConfig(); err != nil {
+			return err
+		}
+		logrus.Infof("Listening at https://%s", s.config.Listen)
+		err = srv.ListenAndServeTLS(s.config.TLS.Cert, s.config.TLS.Key)
+	} else {
+		logrus.Warnf("Listening at http://%s, tokens will be sent in plain text", s.config.Listen)
+		err = srv.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.config.TLS.ClientCA == "" {
+		return cfg, nil
+	}
+
+	bundle, err := os.ReadFile(s.config.TLS.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates found in client CA %s", s.config.TLS.ClientCA)
+	}
+	cfg.ClientCAs = pool
+	// clients may still use tokens
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return cfg, nil
+}
+
+// authenticate finds the client for a request's bearer token or, failing that, its verified certificate.
+func (s *Server) authenticate(r *http.Request) (*Client, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return nil, ErrorUnauthorized
+		}
+
+		sum := sha256.Sum256([]byte(token))
+		digest := []byte(hex.EncodeToString(sum[:]))
+		for _, client := range s.config.Clients {
+			if client.TokenSHA256 != "" && subtle.ConstantTimeCompare(digest, []byte(client.TokenSHA256)) == 1 {
+				return client, nil
+			}
+		}
+		return nil, ErrorUnauthorized
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, client := range s.config.Clients {
+			if client.CommonName != "" && client.CommonName == cn {
+				return client, nil
+			}
+		}
+	}
+
+	return nil, ErrorUnauthorized
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// vault clients list with the LIST method
+	if r.Method != http.MethodGet && r.Method != "LIST" {
+		respondError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	client, err := s.authenticate(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/v1/")
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+		return
+	}
+
+	var data map[string]any
+	var status int
+	switch {
+	case path == middleware.HealthPath:
+		data, status, err = s.health()
+	case path == "trees" || strings.HasPrefix(path, "trees/"):
+		data, status, err = s.listTrees(client, strings.TrimPrefix(strings.TrimPrefix(path, "trees"), "/"))
+	case strings.HasPrefix(path, "tree/"):
+		data, status, err = s.readTree(client, strings.TrimPrefix(path, "tree/"))
+	case strings.HasPrefix(path, "meta/"):
+		data, status, err = s.readMetadata(client, strings.TrimPrefix(path, "meta/"))
+	default:
+		status, err = http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path)
+	}
+
+	if err != nil {
+		logrus.Debugf("%s %s (%s): %s", r.Method, r.URL.Path, client.Name, err)
+		respondError(w, status, err)
+		return
+	}
+
+	respond(w, http.StatusOK, data)
+}
+
+// splitRef splits `VAULT/ITEM` into its parts, using the default vault when ref has no slash. Slashes within ITEM
+// stand in for the separator, as they do when listing trees, so refs holding a slash always start with a vault.
+func (s *Server) splitRef(ref string) (vault, title string) {
+	vault, title, ok := strings.Cut(ref, "/")
+	if !ok {
+		return s.config.Vault, ref
+	}
+
+	separator := s.config.Separator
+	if separator == "" {
+		separator = middleware.DefaultSeparator
+	}
+	return vault, strings.ReplaceAll(title, "/", separator)
+}
+
+// allows tells if client may read the item with id, either a title or uuid, from vault. Uuids are resolved to titles
+// by listing the vault, so items clients are not allowed to read are never fetched.
+func (s *Server) allows(client *Client, vault, id string) bool {
+	if client.Allows(vault, id) {
+		return true
+	}
+
+	items, err := s.source.GetItems(vault)
+	if err != nil {
+		logrus.Debugf("could not list items in %s: %s", vault, err)
+		return false
+	}
+
+	for _, item := range items {
+		if item.ID == id {
+			return client.Allows(vault, item.Title)
+		}
+	}
+	return false
+}
+
+// item reads an item for client, refusing to let clients find out about items they're not allowed to read.
+func (s *Server) item(client *Client, vault, id string) (*onepassword.Item, int, error) {
+	if vault == "" {
+		return nil, http.StatusBadRequest, middleware.ErrorNoVaultProvided
+	}
+
+	if id == "" {
+		return nil, http.StatusNotFound, fmt.Errorf("no item specified")
+	}
+
+	if !s.allows(client, vault, id) {
+		return nil, http.StatusForbidden, ErrorForbidden
+	}
+
+	item, err := s.source.GetItem(id, vault)
+	if err != nil {
+		if opclient.ItemMissingError(id, err) {
+			return nil, http.StatusNotFound, fmt.Errorf("item %s/%s not found", vault, id)
+		}
+		return nil, http.StatusBadGateway, fmt.Errorf("could not retrieve item: %w", err)
+	}
+
+	return item, http.StatusOK, nil
+}
+
+// clientSource reads the items referenced by a tree, as long as client is allowed to read them.
+type clientSource struct {
+	server *Server
+	client *Client
+}
+
+func (cs *clientSource) GetItem(itemQuery, vaultQuery string) (*onepassword.Item, error) {
+	item, _, err := cs.server.item(cs.client, vaultQuery, itemQuery)
+	return item, err
+}
+
+func (cs *clientSource) GetItems(vaultQuery string) ([]onepassword.Item, error) {
+	return cs.server.source.GetItems(vaultQuery)
+}
+
+func (s *Server) readTree(client *Client, ref string) (map[string]any, int, error) {
+	vault, id := s.splitRef(ref)
+	item, status, err := s.item(client, vault, id)
+	if err != nil {
+		return nil, status, err
+	}
+
+	tree, err := middleware.Tree(&clientSource{s, client}, vault, item, s.config.VerifyChecksum)
+	if err != nil {
+		if errors.Is(err, middleware.ErrorChecksumMismatch) {
+			return nil, http.StatusConflict, err
+		}
+		if errors.Is(err, ErrorForbidden) {
+			return nil, http.StatusForbidden, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return tree, http.StatusOK, nil
+}
+
+func (s *Server) readMetadata(client *Client, ref string) (map[string]any, int, error) {
+	vault, id := s.splitRef(ref)
+	item, status, err := s.item(client, vault, id)
+	if err != nil {
+		return nil, status, err
+	}
+
+	return middleware.Metadata(s.source, vault, id, item), http.StatusOK, nil
+}
+
+func (s *Server) listTrees(client *Client, ref string) (map[string]any, int, error) {
+	vault, prefix := s.config.Vault, ""
+	if ref != "" {
+		vault, prefix, _ = strings.Cut(ref, "/")
+	}
+
+	if vault == "" {
+		return nil, http.StatusBadRequest, middleware.ErrorNoVaultProvided
+	}
+
+	items, err := s.source.GetItems(vault)
+	if err != nil {
+		return nil, http.StatusBadGateway, fmt.Errorf("could not list items: %w", err)
+	}
+
+	allowed := []onepassword.Item{}
+	for _, item := range items {
+		if client.Allows(vault, item.Title) {
+			allowed = append(allowed, item)
+		}
+	}
+
+	keys, keyInfo := middleware.Trees(allowed, prefix, s.config.Separator)
+	return logical.ListResponseWithInfo(keys, keyInfo).Data, http.StatusOK, nil
+}
+
+func (s *Server) health() (map[string]any, int, error) {
+	return map[string]any{
+		"version": version.Version,
+		"cache":   s.cache.Stats(),
+	}, http.StatusOK, nil
+}
+
+func respond(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logrus.Errorf("could not write response: %s", err)
+	}
+}
+
+// respondError replies with errors formatted like vault's.
+func respondError(w http.ResponseWriter, status int, err error) {
+	respond(w, status, map[string]any{"errors": []string{err.Error()}})
+}
@@ -0,0 +1,175 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package server_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.rob.mx/nidito/joao/internal/server"
+	"git.rob.mx/nidito/joao/internal/testdata"
+	"git.rob.mx/nidito/joao/internal/testdata/opconnect"
+	"git.rob.mx/nidito/joao/internal/vault/middleware"
+)
+
+func tokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func testServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	testdata.MockOPConnect(t)
+	opconnect.Add(testdata.NewTestConfig("service:test"))
+	opconnect.Add(testdata.NewTestConfig("service:other"))
+	opconnect.Add(testdata.NewTestConfig("host:test"))
+
+	srv := httptest.NewServer(server.New(&server.Config{
+		Vault: "example",
+		Clients: []*server.Client{
+			{Name: "admin", TokenSHA256: tokenDigest("admin-token"), Allow: []string{"*"}},
+			{Name: "service", TokenSHA256: tokenDigest("service-token"), Allow: []string{"example/service:test"}},
+		},
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func request(t *testing.T, srv *httptest.Server, method, path, token string) (int, map[string]any) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, nil)
+	if err != nil {
+		t.Fatalf("could not build request: %s", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("could not read response: %s", err)
+	}
+
+	data := map[string]any{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("invalid json response %s: %s", body, err)
+	}
+	return res.StatusCode, data
+}
+
+func TestServeTree(t *testing.T) {
+	srv := testServer(t)
+	expected, err := middleware.Tree(nil, "example", testdata.NewTestConfig("service:test"), false)
+	if err != nil {
+		t.Fatalf("could not build expected tree: %s", err)
+	}
+	expectedJSON, _ := json.Marshal(expected)
+
+	for _, path := range []string{"/v1/tree/service:test", "/v1/tree/example/service:test", "/v1/tree/example/service/test"} {
+		status, data := request(t, srv, http.MethodGet, path, "service-token")
+		if status != http.StatusOK {
+			t.Fatalf("unexpected status reading %s: %d %v", path, status, data)
+		}
+
+		gotJSON, _ := json.Marshal(data)
+		if string(gotJSON) != string(expectedJSON) {
+			t.Fatalf("unexpected tree at %s.\nwanted: %s\ngot: %s", path, expectedJSON, gotJSON)
+		}
+	}
+}
+
+func TestServeAuth(t *testing.T) {
+	srv := testServer(t)
+
+	cases := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"no token", "/v1/tree/service:test", "", http.StatusUnauthorized},
+		{"bad token", "/v1/tree/service:test", "nope", http.StatusUnauthorized},
+		{"not allowed", "/v1/tree/service:other", "service-token", http.StatusForbidden},
+		{"not allowed missing", "/v1/tree/service:missing", "service-token", http.StatusForbidden},
+		{"allowed missing", "/v1/tree/service:missing", "admin-token", http.StatusNotFound},
+		{"slashes without vault", "/v1/tree/service/test", "admin-token", http.StatusNotFound},
+		{"slashes without vault not allowed", "/v1/tree/service/test", "service-token", http.StatusForbidden},
+		{"no vault", "/v1/tree/", "admin-token", http.StatusNotFound},
+		{"metadata", "/v1/meta/service:test", "service-token", http.StatusOK},
+		{"metadata not allowed", "/v1/meta/host:test", "service-token", http.StatusForbidden},
+		{"health", "/v1/health", "service-token", http.StatusOK},
+		{"unknown", "/v1/secret/service:test", "admin-token", http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, data := request(t, srv, http.MethodGet, c.path, c.token)
+			if status != c.status {
+				t.Fatalf("wanted status %d, got %d: %v", c.status, status, data)
+			}
+
+			if status != http.StatusOK {
+				if errs, ok := data["errors"].([]any); !ok || len(errs) == 0 {
+					t.Fatalf("expected errors in response, got %v", data)
+				}
+			}
+		})
+	}
+}
+
+func TestServeTrees(t *testing.T) {
+	srv := testServer(t)
+
+	cases := []struct {
+		path     string
+		token    string
+		expected string
+	}{
+		{"/v1/trees", "admin-token", `["host/","service/"]`},
+		{"/v1/trees/example/service/", "admin-token", `["other","test"]`},
+		{"/v1/trees", "service-token", `["service/"]`},
+		{"/v1/trees/example/service/", "service-token", `["test"]`},
+	}
+
+	for _, c := range cases {
+		status, data := request(t, srv, "LIST", c.path, c.token)
+		if status != http.StatusOK {
+			t.Fatalf("unexpected status listing %s: %d %v", c.path, status, data)
+		}
+
+		got, _ := json.Marshal(data["keys"])
+		if string(got) != c.expected {
+			t.Fatalf("unexpected keys listing %s as %s.\nwanted: %s\ngot: %s", c.path, c.token, c.expected, got)
+		}
+	}
+}
+
+func TestServeTreeByID(t *testing.T) {
+	srv := testServer(t)
+
+	_, data := request(t, srv, "LIST", "/v1/trees/example/service/", "admin-token")
+	info, _ := data["key_info"].(map[string]any)
+	ids := map[string]string{}
+	for key, value := range info {
+		ids[key], _ = value.(map[string]any)["id"].(string)
+	}
+
+	if status, data := request(t, srv, http.MethodGet, "/v1/tree/example/"+ids["test"], "service-token"); status != http.StatusOK {
+		t.Fatalf("unexpected status reading allowed item by id: %d %v", status, data)
+	}
+
+	if status, data := request(t, srv, http.MethodGet, "/v1/tree/example/"+ids["other"], "service-token"); status != http.StatusForbidden {
+		t.Fatalf("unexpected status reading forbidden item by id: %d %v", status, data)
+	}
+}
@@ -271,6 +271,13 @@ func NewTestConfig(title string) *onepassword.Item {
 				Label:   "2",
 				Value:   "three",
 			},
+			{
+				ID:      "~annotations.~labels",
+				Section: &onepassword.ItemSection{ID: "~annotations", Label: "~annotations"},
+				Type:    "STRING",
+				Label:   "~labels",
+				Value:   "escaped",
+			},
 		},
 	}
 }
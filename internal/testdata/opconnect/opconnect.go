@@ -156,7 +156,14 @@ func (m *Client) GetFile(uuid string, itemQuery string, vaultQuery string) (*one
 }
 
 func (m *Client) GetFileContent(file *onepassword.File) ([]byte, error) {
-	return nil, nil
+	for _, item := range items {
+		for _, attached := range item.Files {
+			if attached.ID == file.ID {
+				return attached.Content()
+			}
+		}
+	}
+	return nil, &onepassword.Error{StatusCode: 404, Message: fmt.Sprintf("could not retrieve file with id %s", file.ID)}
 }
 
 func (m *Client) DownloadFile(file *onepassword.File, targetDirectory string, overwrite bool) (string, error) {
@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"git.rob.mx/nidito/joao/internal/vault/middleware"
@@ -13,7 +14,6 @@ import (
 	"github.com/1Password/connect-sdk-go/connect"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
-	ttlcache "github.com/jellydator/ttlcache/v3"
 )
 
 const (
@@ -22,11 +22,16 @@ const (
 
 type backend struct {
 	*framework.Backend
-	configCache *ttlcache.Cache[string, string]
-	client      *connect.Client
+	cache  *middleware.ItemCache
+	client *connect.Client
+	// clientLock guards client, so it can be swapped while requests are in-flight
+	clientLock sync.RWMutex
+	// refreshLock guards lastRefresh, so only one refresh runs at a time
+	refreshLock sync.Mutex
+	lastRefresh time.Time
 }
 
-var ConnectClientFactory func(s logical.Storage) (connect.Client, error) = onePasswordConnectClient
+var ConnectClientFactory func(config *middleware.Config) (connect.Client, error) = onePasswordConnectClient
 
 // Factory returns a new backend as logical.Backend.
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
@@ -37,7 +42,7 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 	return b, nil
 }
 
-type clientCallback func(client connect.Client, r *logical.Request, fd *framework.FieldData) (*logical.Response, error)
+type clientCallback func(source middleware.ItemSource, r *logical.Request, fd *framework.FieldData) (*logical.Response, error)
 
 func withClient(b *backend, callback clientCallback) framework.OperationFunc {
 	return func(ctx context.Context, r *logical.Request, fd *framework.FieldData) (*logical.Response, error) {
@@ -46,12 +51,16 @@ func withClient(b *backend, callback clientCallback) framework.OperationFunc {
 			return nil, fmt.Errorf("plugin is not configured: %s", err)
 		}
 
-		return callback(client, r, fd)
+		return callback(b.cache.Source(client), r, fd)
 	}
 }
 
 func itemPattern(name string) string {
-	return fmt.Sprintf("(?P<%s>\\w(([\\w-.:]+)?\\w)?)", name)
+	return fmt.Sprintf("(?P<%s>\\w(([\\w-.:/]+)?\\w)?)", name)
+}
+
+func prefixPattern() string {
+	return "(/(?P<prefix>[\\w-.:/]*))?"
 }
 
 func optionalVaultPattern(suffix string) string {
@@ -60,9 +69,7 @@ func optionalVaultPattern(suffix string) string {
 
 func newBackend() *backend {
 	var b = &backend{
-		configCache: ttlcache.New(
-			ttlcache.WithTTL[string, string](5 * time.Minute),
-		),
+		cache: middleware.NewItemCache(),
 	}
 
 	b.Backend = &framework.Backend{
@@ -78,7 +85,7 @@ func newBackend() *backend {
 				{
 					Pattern:         middleware.ConfigPath,
 					HelpSynopsis:    "Configures the connection to a 1Password Connect Server",
-					HelpDescription: "Provide a `host` and `token`, with an optional default `vault` to query 1Password Connect at",
+					HelpDescription: "Provide a `host` and `token`, with an optional default `vault` to query 1Password Connect at. Set `verify_checksum` to refuse serving items modified outside of joao",
 					Fields: map[string]*framework.FieldSchema{
 						"host": {
 							Type:        framework.TypeString,
@@ -86,36 +93,80 @@ func newBackend() *backend {
 						},
 						"token": {
 							Type:        framework.TypeString,
-							Description: "A 1Password Connect token",
+							Description: "A 1Password Connect token, it can be written but never read back",
 						},
 						"vault": {
 							Type:        framework.TypeString,
 							Description: "An optional vault id or name to use for queries",
 						},
+						"verify_checksum": {
+							Type:        framework.TypeBool,
+							Description: "Refuse to serve items whose checksum does not match their contents",
+						},
+						"separator": {
+							Type:        framework.TypeString,
+							Description: "Treat this string in item titles as a directory when listing trees, defaults to `:`",
+						},
+						"skip_verify": {
+							Type:        framework.TypeBool,
+							Description: "Save the configuration without verifying it can list vaults from 1Password Connect",
+						},
+						"refresh_interval": {
+							Type:        framework.TypeDurationSecond,
+							Description: "How often to refresh `refresh_items` in the background, 0 disables refreshing",
+						},
+						"refresh_items": {
+							Type:        framework.TypeCommaStringSlice,
+							Description: "Items to keep cached and refreshed in the background, as `ITEM` (from the default vault) or `VAULT/ITEM`",
+						},
 					},
 					Operations: map[logical.Operation]framework.OperationHandler{
 						logical.ReadOperation: &framework.PathOperation{
 							Callback: middleware.ReadConfig,
 						},
 						logical.UpdateOperation: &framework.PathOperation{
-							Callback: func(ctx context.Context, r *logical.Request, fd *framework.FieldData) (*logical.Response, error) {
-								res, err := middleware.WriteConfig(ctx, r, fd)
-								if err != nil {
-									return nil, err
-								}
-
-								b.client = nil
-								if _, err := b.Client(r.Storage); err != nil {
-									return nil, err
-								}
-								return res, nil
-							},
+							Callback: b.writeConfig,
+						},
+					},
+				},
+				{
+					Pattern:         middleware.RotatePath,
+					HelpSynopsis:    "Rotates the 1Password Connect token",
+					HelpDescription: "Verifies and stores a new `token`, swapping the client used for new requests while in-flight requests finish with the previous one",
+					Fields: map[string]*framework.FieldSchema{
+						"token": {
+							Type:        framework.TypeString,
+							Description: "The new 1Password Connect token",
+							Required:    true,
+						},
+						"skip_verify": {
+							Type:        framework.TypeBool,
+							Description: "Save the token without verifying it can list vaults from 1Password Connect",
+						},
+					},
+					Operations: map[logical.Operation]framework.OperationHandler{
+						logical.UpdateOperation: &framework.PathOperation{
+							Callback: b.rotateToken,
+							Summary:  "Rotate the 1Password Connect token",
+						},
+					},
+				},
+				{
+					Pattern:         middleware.HealthPath,
+					HelpSynopsis:    "Reports the status of the connection to 1Password Connect",
+					HelpDescription: "Checks 1Password Connect is reachable, the configured token is valid, and lists the vaults it can access, along with cache statistics",
+					Operations: map[logical.Operation]framework.OperationHandler{
+						logical.ReadOperation: &framework.PathOperation{
+							Callback: b.health,
+							Summary:  "Check connectivity to 1Password Connect",
 						},
 					},
 				},
 				{
-					Pattern:      "trees/" + optionalVaultPattern(""),
+					Pattern:      "trees/" + optionalVaultPattern("") + prefixPattern(),
 					HelpSynopsis: `List configuration trees`,
+					HelpDescription: "Lists the default vault, or `VAULT/PREFIX`. Paths holding a slash always start with a vault, " +
+						"and further slashes stand in for the configured `separator`",
 					Operations: map[logical.Operation]framework.OperationHandler{
 						logical.ListOperation: &framework.PathOperation{
 							Callback: withClient(b, middleware.ListTrees),
@@ -128,11 +179,17 @@ func newBackend() *backend {
 							Description: "Specifies the id of the vault to list from.",
 							Required:    true,
 						},
+						"prefix": {
+							Type:        framework.TypeString,
+							Description: "Lists only items whose title starts with this prefix, with slashes standing in for the separator",
+						},
 					},
 				},
 				{
 					Pattern:      "tree/" + optionalVaultPattern("/") + itemPattern("id"),
 					HelpSynopsis: `Returns a configuration tree`,
+					HelpDescription: "Reads `ITEM` from the default vault, or `VAULT/ITEM`. Paths holding a slash always start with a vault, " +
+						"and further slashes stand in for the configured `separator`, so `tree/prod/service/api` reads `service:api` from `prod`",
 					Operations: map[logical.Operation]framework.OperationHandler{
 						logical.ReadOperation: &framework.PathOperation{
 							Callback: withClient(b, middleware.ReadTree),
@@ -152,20 +209,60 @@ func newBackend() *backend {
 						},
 					},
 				},
+				{
+					Pattern:      "meta/" + optionalVaultPattern("/") + itemPattern("id"),
+					HelpSynopsis: `Returns metadata for a configuration tree`,
+					HelpDescription: "Reads the metadata of `ITEM` from the default vault, or `VAULT/ITEM`, with slashes after the vault " +
+						"standing in for the configured `separator`",
+					Operations: map[logical.Operation]framework.OperationHandler{
+						logical.ReadOperation: &framework.PathOperation{
+							Callback: withClient(b, middleware.ReadMetadata),
+							Summary:  "Retrieve the id, version, timestamps, category, tags and checksum status of the specified item",
+						},
+					},
+					Fields: map[string]*framework.FieldSchema{
+						"id": {
+							Type:        framework.TypeString,
+							Description: "The item name or id to read",
+							Required:    true,
+						},
+						"vault": {
+							Type:        framework.TypeString,
+							Description: "The vault name or id to read from",
+							Required:    true,
+						},
+					},
+				},
 			},
 		),
-		Secrets: []*framework.Secret{},
+		Secrets:      []*framework.Secret{},
+		PeriodicFunc: b.refresh,
 	}
 
 	return b
 }
 
 func (b *backend) Client(s logical.Storage) (connect.Client, error) {
+	b.clientLock.RLock()
+	if b.client != nil {
+		defer b.clientLock.RUnlock()
+		return *b.client, nil
+	}
+	b.clientLock.RUnlock()
+
+	b.clientLock.Lock()
+	defer b.clientLock.Unlock()
+	// another request might have beaten us to it
 	if b.client != nil {
 		return *b.client, nil
 	}
 
-	client, err := ConnectClientFactory(s)
+	config, err := middleware.ConfigFromStorage(context.Background(), s)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving config for client: %w", err)
+	}
+
+	client, err := ConnectClientFactory(config)
 	if err != nil {
 		return nil, err
 	}
@@ -173,16 +270,121 @@ func (b *backend) Client(s logical.Storage) (connect.Client, error) {
 	return client, nil
 }
 
-func onePasswordConnectClient(s logical.Storage) (connect.Client, error) {
-	config, err := middleware.ConfigFromStorage(context.Background(), s)
+// saveConfig persists config after optionally verifying it, and swaps the backend's client for one using it.
+func (b *backend) saveConfig(ctx context.Context, s logical.Storage, config *middleware.Config, verify bool) error {
+	client, err := ConnectClientFactory(config)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving config for client: %w", err)
+		return err
+	}
+
+	if verify {
+		if _, err := middleware.VerifyClient(client); err != nil {
+			return fmt.Errorf("refusing to save config, write skip_verify=true to save it anyway: %w", err)
+		}
+	}
+
+	if err := middleware.SaveConfig(ctx, s, config); err != nil {
+		return err
+	}
+
+	b.clientLock.Lock()
+	b.client = &client
+	b.clientLock.Unlock()
+	return nil
+}
+
+func (b *backend) writeConfig(ctx context.Context, r *logical.Request, fd *framework.FieldData) (*logical.Response, error) {
+	config, err := middleware.UpdatedConfig(ctx, r, fd)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, b.saveConfig(ctx, r.Storage, config, !fd.Get("skip_verify").(bool))
+}
+
+func (b *backend) rotateToken(ctx context.Context, r *logical.Request, fd *framework.FieldData) (*logical.Response, error) {
+	config, err := middleware.ConfigFromStorage(ctx, r.Storage)
+	if err != nil {
+		return nil, err
 	}
 
 	if config == nil {
 		return nil, fmt.Errorf("no config set for backend, write host, token and vault to [mount]/1password")
 	}
 
+	token := fd.Get("token").(string)
+	if token == "" {
+		return nil, fmt.Errorf("a token is required to rotate")
+	}
+	config.SetToken(token)
+
+	if err := b.saveConfig(ctx, r.Storage, config, !fd.Get("skip_verify").(bool)); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{Data: config.TokenInfo()}, nil
+}
+
+func (b *backend) health(ctx context.Context, r *logical.Request, fd *framework.FieldData) (*logical.Response, error) {
+	data := map[string]any{
+		"version":    version.Version,
+		"configured": false,
+		"cache":      b.cache.Stats(),
+	}
+
+	client, err := b.Client(r.Storage)
+	if err != nil {
+		data["error"] = err.Error()
+		return &logical.Response{Data: data}, nil
+	}
+
+	data["configured"] = true
+	data["connect"] = middleware.ConnectStatus(client)
+	return &logical.Response{Data: data}, nil
+}
+
+// refresh fetches the configured items from 1Password Connect into the cache, recording when their contents change.
+// It's called by vault about every minute, but only does work once the configured interval has elapsed.
+func (b *backend) refresh(ctx context.Context, req *logical.Request) error {
+	config, err := middleware.ConfigFromStorage(ctx, req.Storage)
+	if err != nil {
+		return fmt.Errorf("could not get config from storage: %w", err)
+	}
+
+	if config == nil || config.RefreshInterval == 0 || len(config.RefreshItems) == 0 {
+		return nil
+	}
+
+	b.refreshLock.Lock()
+	defer b.refreshLock.Unlock()
+	now := time.Now()
+	if now.Sub(b.lastRefresh) < config.RefreshInterval {
+		return nil
+	}
+	b.lastRefresh = now
+
+	client, err := b.Client(req.Storage)
+	if err != nil {
+		return fmt.Errorf("plugin is not configured: %s", err)
+	}
+
+	// keep items around a little longer than the interval, so failing refreshes eventually hit Connect
+	changed, err := b.cache.Refresh(client, config.RefreshItems, config.Vault, 2*config.RefreshInterval)
+	for _, ref := range changed {
+		b.Logger().Info("item changed", "item", ref)
+	}
+	if err != nil {
+		b.Logger().Warn("could not refresh items", "error", err)
+	}
+
+	return nil
+}
+
+func onePasswordConnectClient(config *middleware.Config) (connect.Client, error) {
+	if config == nil {
+		return nil, fmt.Errorf("no config set for backend, write host, token and vault to [mount]/1password")
+	}
+
 	http.DefaultClient.Timeout = 15 * time.Second
 	client := connect.NewClientWithUserAgent(config.Host, config.Token, fmt.Sprintf(userAgent, version.Version))
 
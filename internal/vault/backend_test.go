@@ -14,7 +14,7 @@ import (
 )
 
 func init() {
-	vault.ConnectClientFactory = func(s logical.Storage) (connect.Client, error) {
+	vault.ConnectClientFactory = func(config *middleware.Config) (connect.Client, error) {
 		return &opconnect.Client{}, nil
 	}
 }
@@ -32,8 +32,12 @@ func TestConfiguredBackend(t *testing.T) {
 		t.Fatalf("Unexpected error with config set: %s => %v", err, resp)
 	}
 
-	if resp.Data["token"] != opconnect.Token {
-		t.Errorf("Found unknown token: %s", resp.Data["token"])
+	if _, ok := resp.Data["token"]; ok {
+		t.Errorf("Found token in config response: %s", resp.Data["token"])
+	}
+
+	if resp.Data["token_fingerprint"] != middleware.TokenFingerprint(opconnect.Token) {
+		t.Errorf("Found unknown token fingerprint: %s", resp.Data["token_fingerprint"])
 	}
 
 	if resp.Data["host"] != opconnect.Host {
@@ -77,3 +81,64 @@ func TestUnconfiguredBackend(t *testing.T) {
 		t.Fatalf("unconfigured client threw wrong error: \nwanted: %s\ngot: %s", expected, actual)
 	}
 }
+
+func TestHealth(t *testing.T) {
+	t.Run("healthy", func(t *testing.T) {
+		b, reqStorage := getBackend(t)
+		opconnect.Clear()
+		opconnect.Add(generateConfigItem("service:test"))
+		if _, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "tree/service:test",
+			Storage:   reqStorage,
+		}); err != nil {
+			t.Fatalf("could not read tree: %s", err)
+		}
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      middleware.HealthPath,
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatalf("could not issue health request: %s", err)
+		}
+
+		if resp.Data["configured"] != true {
+			t.Fatalf("expected backend to be configured: %v", resp.Data)
+		}
+
+		status := resp.Data["connect"].(map[string]any)
+		mapsEqual(t, status, map[string]any{"reachable": true, "token_valid": true})
+		if vaults := status["vaults"].([]map[string]string); len(vaults) != len(opconnect.Vaults) {
+			t.Fatalf("expected %d vaults, got %v", len(opconnect.Vaults), vaults)
+		}
+
+		cache, ok := resp.Data["cache"].(map[string]any)
+		if !ok {
+			t.Fatalf("expected cache stats, got %v", resp.Data)
+		}
+
+		if misses := cache["misses"].(uint64); misses == 0 {
+			t.Fatalf("item reads were not looked up in the cache: %v", cache)
+		}
+	})
+
+	t.Run("bad token", func(t *testing.T) {
+		b, reqStorage := getBackend(t)
+		setUnauthorizedConnectMocks()
+		defer setOnePassswordConnectMocks()
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      middleware.HealthPath,
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatalf("could not issue health request: %s", err)
+		}
+
+		status := resp.Data["connect"].(map[string]any)
+		mapsEqual(t, status, map[string]any{"reachable": true, "token_valid": false})
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package vault_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"git.rob.mx/nidito/joao/internal/testdata/opconnect"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestPeriodicRefresh(t *testing.T) {
+	b, reqStorage := getBackend(t)
+	opconnect.Clear()
+	item := opconnect.Add(generateConfigItem("service:test"))
+
+	refresh := func() {
+		t.Helper()
+		if _, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RollbackOperation,
+			Storage:   reqStorage,
+		}); err != nil {
+			t.Fatalf("could not refresh: %s", err)
+		}
+	}
+
+	read := func(path string) map[string]any {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatalf("could not read %s: %s", path, err)
+		}
+		return resp.Data
+	}
+
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "1password",
+		Data: map[string]any{
+			"refresh_interval": 1,
+			"refresh_items":    "service:test",
+		},
+		Storage: reqStorage,
+	}); err != nil {
+		t.Fatalf("could not configure refresh: %s", err)
+	}
+
+	refresh()
+	meta := read("meta/service:test")
+	firstChange, ok := meta["changed_at"]
+	if !ok {
+		t.Fatalf("refreshed item has no changed_at: %v", meta)
+	}
+
+	health := read("health")
+	if size := health["cache"].(map[string]any)["size"]; size == 0 {
+		t.Fatalf("cache was not warmed: %v", health)
+	}
+
+	updated := generateConfigItem(item.Title)
+	updated.ID = item.ID
+	updated.Fields[0].Value = "changed"
+	opconnect.Update(updated)
+
+	if value := read("tree/service:test")["nested"].(map[string]any)["string"]; value != "this is a string" {
+		t.Fatalf("read did not come from cache, got %s", value)
+	}
+
+	// refresh interval has not elapsed yet
+	refresh()
+	if value := read("tree/service:test")["nested"].(map[string]any)["string"]; value != "this is a string" {
+		t.Fatalf("refreshed before interval elapsed, got %s", value)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	refresh()
+	if value := read("tree/service:test")["nested"].(map[string]any)["string"]; value != "changed" {
+		t.Fatalf("did not refresh item, got %s", value)
+	}
+
+	meta = read("meta/service:test")
+	if meta["changed_at"] == firstChange {
+		t.Fatalf("change was not recorded: %v", meta)
+	}
+}
@@ -4,9 +4,13 @@ package vault_test
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 
 	"git.rob.mx/nidito/joao/internal/testdata/opconnect"
+	"git.rob.mx/nidito/joao/internal/vault/middleware"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -49,21 +53,25 @@ func TestConfigDefault(t *testing.T) {
 		t.Fatal("got no response, expected something!")
 	}
 
-	mapsEqual(t, resp.Data, map[string]any{"host": opconnect.Host, "token": opconnect.Token, "vault": opconnect.Vaults[0].ID})
+	mapsEqual(t, resp.Data, map[string]any{"host": opconnect.Host, "token_fingerprint": middleware.TokenFingerprint(opconnect.Token), "vault": opconnect.Vaults[0].ID})
 }
 
 func TestConfigUpdate(t *testing.T) {
 	b, reqStorage := getBackend(t)
 	expected := map[string]any{
-		"host":  "mira",
-		"token": "un",
-		"vault": "salmón",
+		"host":              "mira",
+		"token_fingerprint": middleware.TokenFingerprint("un"),
+		"vault":             "salmón",
 	}
 	resp, err := b.HandleRequest(context.Background(), &logical.Request{
 		Operation: logical.UpdateOperation,
 		Path:      "1password",
-		Data:      expected,
-		Storage:   reqStorage,
+		Data: map[string]any{
+			"host":  "mira",
+			"token": "un",
+			"vault": "salmón",
+		},
+		Storage: reqStorage,
 	})
 
 	if err != nil {
@@ -92,4 +100,126 @@ func TestConfigUpdate(t *testing.T) {
 	}
 
 	mapsEqual(t, resp.Data, expected)
+
+	if _, ok := resp.Data["token"]; ok {
+		t.Fatalf("token was returned after update: %v", resp.Data)
+	}
+
+	if resp.Data["token_set_at"] == "" {
+		t.Fatalf("token_set_at was not recorded after update: %v", resp.Data)
+	}
+}
+
+func TestConfigUpdateVerifies(t *testing.T) {
+	b, reqStorage := getBackend(t)
+	setUnauthorizedConnectMocks()
+	defer setOnePassswordConnectMocks()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "1password",
+		Data:      map[string]any{"token": "bad"},
+		Storage:   reqStorage,
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "Invalid token signature") {
+		t.Fatalf("expected verification error, got %v", err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "1password",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("Could not issue read after update request: %s", err)
+	}
+
+	mapsEqual(t, resp.Data, map[string]any{"token_fingerprint": middleware.TokenFingerprint(opconnect.Token)})
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "1password",
+		Data:      map[string]any{"token": "bad", "skip_verify": true},
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("Could not issue update request skipping verification: %s", err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "1password",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("Could not issue read after update request: %s", err)
+	}
+
+	mapsEqual(t, resp.Data, map[string]any{"token_fingerprint": middleware.TokenFingerprint("bad")})
+}
+
+func TestConfigRotate(t *testing.T) {
+	b, reqStorage := getBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      middleware.RotatePath,
+		Data:      map[string]any{"token": "rotated"},
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("Could not issue rotate request: %s", err)
+	}
+
+	mapsEqual(t, resp.Data, map[string]any{"token_fingerprint": middleware.TokenFingerprint("rotated")})
+
+	cfg, err := middleware.ConfigFromStorage(context.Background(), reqStorage)
+	if err != nil {
+		t.Fatalf("Could not read config from storage: %s", err)
+	}
+
+	if cfg.Token != "rotated" || cfg.Host != opconnect.Host {
+		t.Fatalf("unexpected config after rotation: %+v", cfg)
+	}
+
+	setUnauthorizedConnectMocks()
+	defer setOnePassswordConnectMocks()
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      middleware.RotatePath,
+		Data:      map[string]any{"token": "bad"},
+		Storage:   reqStorage,
+	})
+	if err == nil {
+		t.Fatal("rotated to a token that could not be verified")
+	}
+}
+
+func TestConfigRotateConcurrently(t *testing.T) {
+	b, reqStorage := getBackend(t)
+	opconnect.Clear()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _ = b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.ListOperation,
+				Path:      "trees/",
+				Storage:   reqStorage,
+			})
+		}()
+		go func(i int) {
+			defer wg.Done()
+			_, _ = b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      middleware.RotatePath,
+				Data:      map[string]any{"token": fmt.Sprintf("token-%d", i)},
+				Storage:   reqStorage,
+			})
+		}(i)
+	}
+	wg.Wait()
 }
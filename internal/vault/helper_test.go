@@ -12,6 +12,7 @@ import (
 	"git.rob.mx/nidito/joao/internal/vault"
 	"git.rob.mx/nidito/joao/internal/vault/middleware"
 	"github.com/1Password/connect-sdk-go/connect"
+	"github.com/1Password/connect-sdk-go/onepassword"
 	hclog "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -76,7 +77,21 @@ func getUnconfiguredBackend(tb testing.TB) (logical.Backend, logical.Storage) {
 }
 
 func setOnePassswordConnectMocks() {
-	vault.ConnectClientFactory = func(s logical.Storage) (connect.Client, error) {
+	vault.ConnectClientFactory = func(config *middleware.Config) (connect.Client, error) {
 		return &opconnect.Client{}, nil
 	}
 }
+
+type unauthorizedClient struct {
+	opconnect.Client
+}
+
+func (c *unauthorizedClient) GetVaults() ([]onepassword.Vault, error) {
+	return nil, &onepassword.Error{StatusCode: 401, Message: "Invalid token signature"}
+}
+
+func setUnauthorizedConnectMocks() {
+	vault.ConnectClientFactory = func(config *middleware.Config) (connect.Client, error) {
+		return &unauthorizedClient{}, nil
+	}
+}
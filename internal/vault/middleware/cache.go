@@ -0,0 +1,145 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
+	"github.com/1Password/connect-sdk-go/onepassword"
+	ttlcache "github.com/jellydator/ttlcache/v3"
+)
+
+// ItemSource reads items from 1Password, as a 1Password Connect client does.
+type ItemSource interface {
+	GetItem(itemQuery, vaultQuery string) (*onepassword.Item, error)
+	GetItems(vaultQuery string) ([]onepassword.Item, error)
+}
+
+// RefreshTracker is implemented by sources that keep items fresh in the background.
+type RefreshTracker interface {
+	RefreshStatus(vault, item string) (changedAt time.Time, refreshedAt time.Time, ok bool)
+}
+
+// cachedItem is an item kept fresh by a periodic refresh.
+type cachedItem struct {
+	item        *onepassword.Item
+	checksum    string
+	changedAt   time.Time
+	refreshedAt time.Time
+}
+
+func cacheKey(vault, item string) string {
+	return vault + "/" + item
+}
+
+// ItemCache keeps a set of items refreshed in the background, recording when their contents change.
+type ItemCache struct {
+	items *ttlcache.Cache[string, *cachedItem]
+	// lock makes sure only one refresh runs at a time
+	lock sync.Mutex
+}
+
+func NewItemCache() *ItemCache {
+	return &ItemCache{
+		items: ttlcache.New(
+			ttlcache.WithDisableTouchOnHit[string, *cachedItem](),
+		),
+	}
+}
+
+// Source wraps source, serving refreshed items from the cache and everything else from source.
+func (c *ItemCache) Source(source ItemSource) ItemSource {
+	return &cachingSource{ItemSource: source, cache: c}
+}
+
+// Stats reports the size of the cache and how it's been used.
+func (c *ItemCache) Stats() map[string]any {
+	metrics := c.items.Metrics()
+	return map[string]any{
+		"size":       c.items.Len(),
+		"insertions": metrics.Insertions,
+		"hits":       metrics.Hits,
+		"misses":     metrics.Misses,
+		"evictions":  metrics.Evictions,
+	}
+}
+
+// Refresh fetches refs, either `ITEM` from defaultVault or `VAULT/ITEM`, from source into the cache for ttl, returning
+// the refs whose contents changed since the last refresh. It keeps going when an item fails to refresh, returning
+// every error found along the way.
+func (c *ItemCache) Refresh(source ItemSource, refs []string, defaultVault string, ttl time.Duration) (changed []string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	errs := []error{}
+	for _, ref := range refs {
+		vault := defaultVault
+		name := ref
+		if parts := strings.SplitN(ref, "/", 2); len(parts) == 2 {
+			vault = parts[0]
+			name = parts[1]
+		}
+
+		item, err := source.GetItem(name, vault)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not refresh %s/%s: %w", vault, name, err))
+			continue
+		}
+
+		entry := &cachedItem{
+			item:        item,
+			checksum:    opclient.Checksum(item.Fields),
+			changedAt:   item.UpdatedAt,
+			refreshedAt: now,
+		}
+
+		if previous := c.items.Get(cacheKey(vault, name)); previous != nil {
+			entry.changedAt = previous.Value().changedAt
+			if previous.Value().checksum != entry.checksum {
+				changed = append(changed, ref)
+				entry.changedAt = now
+			}
+		}
+
+		if entry.changedAt.IsZero() {
+			entry.changedAt = now
+		}
+
+		c.items.Set(cacheKey(vault, name), entry, ttl)
+		if item.ID != "" && item.ID != name {
+			c.items.Set(cacheKey(vault, item.ID), entry, ttl)
+		}
+	}
+
+	return changed, errors.Join(errs...)
+}
+
+// cachingSource serves refreshed items from the cache, and everything else from its source.
+type cachingSource struct {
+	ItemSource
+	cache *ItemCache
+}
+
+var _ RefreshTracker = &cachingSource{}
+
+func (c *cachingSource) GetItem(itemQuery, vaultQuery string) (*onepassword.Item, error) {
+	if cached := c.cache.items.Get(cacheKey(vaultQuery, itemQuery)); cached != nil {
+		return cached.Value().item, nil
+	}
+
+	return c.ItemSource.GetItem(itemQuery, vaultQuery)
+}
+
+func (c *cachingSource) RefreshStatus(vault, item string) (changedAt time.Time, refreshedAt time.Time, ok bool) {
+	cached := c.cache.items.Get(cacheKey(vault, item))
+	if cached == nil {
+		return changedAt, refreshedAt, false
+	}
+
+	return cached.Value().changedAt, cached.Value().refreshedAt, true
+}
@@ -4,6 +4,9 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -11,12 +14,54 @@ import (
 
 const (
 	ConfigPath = "1password"
+	RotatePath = ConfigPath + "/rotate"
+	// DefaultSeparator splits item titles into directories when listing trees,
+	// matching the default repo-mode nameTemplate.
+	DefaultSeparator = ":"
 )
 
 type Config struct {
 	Host  string `json:"host"`
 	Token string `json:"token"`
 	Vault string `json:"vault"`
+	// VerifyChecksum refuses to serve items whose checksum does not match their fields
+	VerifyChecksum bool `json:"verify_checksum"`
+	// Separator splits item titles into directories when listing trees
+	Separator string `json:"separator"`
+	// TokenSetAt records the last time the token was written
+	TokenSetAt time.Time `json:"token_set_at"`
+	// RefreshInterval sets how often RefreshItems are refreshed in the background
+	RefreshInterval time.Duration `json:"refresh_interval"`
+	// RefreshItems are kept cached, as ITEM or VAULT/ITEM
+	RefreshItems []string `json:"refresh_items"`
+}
+
+// TokenFingerprint identifies a token without revealing it.
+func TokenFingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("sha256:%x", sum[0:8])
+}
+
+// SetToken updates the token, recording when it was set.
+func (cfg *Config) SetToken(token string) {
+	cfg.Token = token
+	cfg.TokenSetAt = time.Now().UTC()
+}
+
+// TokenInfo describes the token without revealing it.
+func (cfg *Config) TokenInfo() map[string]any {
+	setAt := ""
+	if !cfg.TokenSetAt.IsZero() {
+		setAt = cfg.TokenSetAt.Format(time.RFC3339)
+	}
+
+	return map[string]any{
+		"token_fingerprint": TokenFingerprint(cfg.Token),
+		"token_set_at":      setAt,
+	}
 }
 
 func ConfigFromStorage(ctx context.Context, s logical.Storage) (*Config, error) {
@@ -39,16 +84,28 @@ func ReadConfig(ctx context.Context, req *logical.Request, data *framework.Field
 		return nil, err
 	}
 
-	return &logical.Response{
-		Data: map[string]any{
-			"host":  cfg.Host,
-			"token": cfg.Token,
-			"vault": cfg.Vault,
-		},
-	}, nil
+	refreshItems := cfg.RefreshItems
+	if refreshItems == nil {
+		refreshItems = []string{}
+	}
+
+	res := map[string]any{
+		"host":             cfg.Host,
+		"vault":            cfg.Vault,
+		"verify_checksum":  cfg.VerifyChecksum,
+		"separator":        cfg.Separator,
+		"refresh_interval": int64(cfg.RefreshInterval.Seconds()),
+		"refresh_items":    refreshItems,
+	}
+	for key, value := range cfg.TokenInfo() {
+		res[key] = value
+	}
+
+	return &logical.Response{Data: res}, nil
 }
 
-func WriteConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+// UpdatedConfig returns the stored config, updated with the request's fields.
+func UpdatedConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*Config, error) {
 	existing, err := ConfigFromStorage(ctx, req.Storage)
 	if err != nil {
 		return nil, err
@@ -62,21 +119,38 @@ func WriteConfig(ctx context.Context, req *logical.Request, data *framework.Fiel
 	}
 
 	if token, ok := data.GetOk("token"); ok {
-		existing.Token = token.(string)
+		existing.SetToken(token.(string))
 	}
 
 	if opVault, ok := data.GetOk("vault"); ok {
 		existing.Vault = opVault.(string)
 	}
 
-	entry, err := logical.StorageEntryJSON(ConfigPath, existing)
-	if err != nil {
-		return nil, err
+	if verify, ok := data.GetOk("verify_checksum"); ok {
+		existing.VerifyChecksum = verify.(bool)
 	}
 
-	if err := req.Storage.Put(ctx, entry); err != nil {
-		return nil, err
+	if separator, ok := data.GetOk("separator"); ok {
+		existing.Separator = separator.(string)
+	}
+
+	if interval, ok := data.GetOk("refresh_interval"); ok {
+		existing.RefreshInterval = time.Duration(interval.(int)) * time.Second
+	}
+
+	if items, ok := data.GetOk("refresh_items"); ok {
+		existing.RefreshItems = items.([]string)
+	}
+
+	return existing, nil
+}
+
+// SaveConfig persists a config to storage.
+func SaveConfig(ctx context.Context, s logical.Storage, cfg *Config) error {
+	entry, err := logical.StorageEntryJSON(ConfigPath, cfg)
+	if err != nil {
+		return err
 	}
 
-	return nil, nil
+	return s.Put(ctx, entry)
 }
@@ -0,0 +1,56 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package middleware
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/1Password/connect-sdk-go/connect"
+	"github.com/1Password/connect-sdk-go/onepassword"
+)
+
+const (
+	HealthPath = "health"
+)
+
+// VerifyClient makes sure a client can reach 1Password Connect and list vaults.
+func VerifyClient(client connect.Client) ([]onepassword.Vault, error) {
+	vaults, err := client.GetVaults()
+	if err != nil {
+		return nil, fmt.Errorf("could not list vaults from 1Password Connect: %w", err)
+	}
+
+	return vaults, nil
+}
+
+// ConnectStatus reports 1Password Connect's reachability, whether the token is accepted and the vaults it can access.
+func ConnectStatus(client connect.Client) map[string]any {
+	status := map[string]any{
+		"reachable":   false,
+		"token_valid": false,
+		"vaults":      []map[string]string{},
+	}
+
+	vaults, err := VerifyClient(client)
+	if err != nil {
+		var opErr *onepassword.Error
+		// 1Password Connect answered, just not with what we wanted
+		status["reachable"] = errors.As(err, &opErr)
+		status["error"] = err.Error()
+		return status
+	}
+
+	accessible := []map[string]string{}
+	for _, vault := range vaults {
+		accessible = append(accessible, map[string]string{
+			"id":   vault.ID,
+			"name": vault.Name,
+		})
+	}
+
+	status["reachable"] = true
+	status["token_valid"] = true
+	status["vaults"] = accessible
+	return status
+}
@@ -0,0 +1,66 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
+	"github.com/1Password/connect-sdk-go/onepassword"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func ReadMetadata(source ItemSource, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	vault, err := vaultName(data, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := ConfigFromStorage(context.Background(), req.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("could not get config from storage: %w", err)
+	}
+
+	id := itemTitle(data.Get("id").(string), cfg)
+	item, err := source.GetItem(id, vault)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve item: %w", err)
+	}
+
+	return &logical.Response{Data: Metadata(source, vault, id, item)}, nil
+}
+
+// Metadata describes item, as read from source with id, along with its refresh status if source keeps it fresh.
+func Metadata(source ItemSource, vault, id string, item *onepassword.Item) map[string]any {
+	_, valid := opclient.VerifyChecksum(item)
+	tags := item.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	meta := map[string]any{
+		"id":             item.ID,
+		"title":          item.Title,
+		"vault":          item.Vault.ID,
+		"version":        item.Version,
+		"category":       string(item.Category),
+		"tags":           tags,
+		"created_at":     item.CreatedAt.Format(time.RFC3339),
+		"updated_at":     item.UpdatedAt.Format(time.RFC3339),
+		"last_edited_by": item.LastEditedBy,
+		"checksum":       item.GetValue("password"),
+		"checksum_valid": valid,
+	}
+
+	if tracker, ok := source.(RefreshTracker); ok {
+		if changedAt, refreshedAt, ok := tracker.RefreshStatus(vault, id); ok {
+			meta["changed_at"] = changedAt.Format(time.RFC3339)
+			meta["refreshed_at"] = refreshedAt.Format(time.RFC3339)
+		}
+	}
+
+	return meta
+}
@@ -5,10 +5,12 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	"git.rob.mx/nidito/joao/pkg/config"
-	"github.com/1Password/connect-sdk-go/connect"
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
+	"github.com/1Password/connect-sdk-go/onepassword"
 	"gopkg.in/yaml.v3"
 
 	"github.com/hashicorp/vault/sdk/framework"
@@ -16,6 +18,7 @@ import (
 )
 
 var ErrorNoVaultProvided = fmt.Errorf("no vault has been specified, provide one reading from MOUNT/tree/VAULT/ITEM, or configure a default writing to MOUNT/1password")
+var ErrorChecksumMismatch = fmt.Errorf("item checksum does not match its contents, refusing to serve it")
 
 func vaultName(data *framework.FieldData, storage logical.Storage) (vault string, err error) {
 	if vaultI, ok := data.GetOk("vault"); ok {
@@ -37,46 +40,155 @@ func vaultName(data *framework.FieldData, storage logical.Storage) (vault string
 	return "", ErrorNoVaultProvided
 }
 
-func ReadTree(client connect.Client, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+// itemTitle returns the title of the item at path. Slashes stand in for the configured separator, as they do when
+// listing trees, so paths need an explicit vault to read items whose title holds it: `tree/prod/service/api` reads
+// `service:api` from the `prod` vault, while `tree/service/api` reads `api` from a vault named `service`.
+func itemTitle(path string, cfg *Config) string {
+	separator := DefaultSeparator
+	if cfg != nil && cfg.Separator != "" {
+		separator = cfg.Separator
+	}
+
+	return strings.ReplaceAll(path, "/", separator)
+}
+
+func ReadTree(source ItemSource, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	vault, err := vaultName(data, req.Storage)
 	if err != nil {
 		return nil, err
 	}
 
-	item, err := client.GetItem(data.Get("id").(string), vault)
+	cfg, err := ConfigFromStorage(context.Background(), req.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("could not get config from storage: %w", err)
+	}
+
+	item, err := source.GetItem(itemTitle(data.Get("id").(string), cfg), vault)
 	if err != nil {
 		return nil, fmt.Errorf("could not retrieve item: %w", err)
 	}
 
-	tree := config.NewEntry("root", yaml.MappingNode)
+	tree, err := Tree(source, vault, item, cfg != nil && cfg.VerifyChecksum)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{Data: tree}, nil
+}
+
+// Tree returns the configuration tree stored in item, optionally refusing items whose checksum does not match.
+// References to other items are resolved reading them from source.
+func Tree(source ItemSource, vault string, item *onepassword.Item, verifyChecksum bool) (map[string]any, error) {
+	if verifyChecksum {
+		if _, ok := opclient.VerifyChecksum(item); !ok {
+			return nil, fmt.Errorf("%s/%s: %w", vault, item.Title, ErrorChecksumMismatch)
+		}
+	}
 
+	tree := config.NewEntry("root", yaml.MappingNode)
 	if err := tree.FromOP(item.Fields); err != nil {
 		return nil, err
 	}
 
-	return &logical.Response{
-		Data: tree.AsMap().(map[string]any),
-	}, nil
+	refs := config.NewRefResolver(false)
+	refs.Items = func(vault, name string) (*onepassword.Item, error) {
+		return source.GetItem(name, vault)
+	}
+	if err := refs.Resolve(tree, ""); err != nil {
+		return nil, err
+	}
+
+	return tree.AsMap().(map[string]any), nil
 }
 
-func ListTrees(client connect.Client, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+func ListTrees(source ItemSource, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	vault, err := vaultName(data, req.Storage)
 	if err != nil {
 		return nil, err
 	}
 
-	items, err := client.GetItems(vault)
+	cfg, err := ConfigFromStorage(context.Background(), req.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("could not get config from storage: %w", err)
+	}
+
+	separator := ""
+	if cfg != nil {
+		separator = cfg.Separator
+	}
+
+	items, err := source.GetItems(vault)
 	if err != nil {
 		return nil, fmt.Errorf("could not list items: %w", err)
 	}
 
-	retMap := map[string]any{}
-	retList := []string{}
+	prefix := ""
+	if prefixI, ok := data.GetOk("prefix"); ok {
+		prefix = prefixI.(string)
+	}
+
+	keys, keyInfo := Trees(items, prefix, separator)
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+// Trees lists items under path, a slash-delimited prefix of their titles, treating separator in item titles as a
+// directory delimiter. It returns the keys under path, along with the id and title of every item listed.
+func Trees(items []onepassword.Item, path, separator string) ([]string, map[string]any) {
+	if separator == "" {
+		separator = DefaultSeparator
+	}
+
+	return listing(items, titlePrefix(path, separator), separator)
+}
+
+// titlePrefix turns a slash-delimited listing path into an item title prefix.
+func titlePrefix(path, separator string) string {
+	parts := []string{}
+	for _, part := range strings.Split(path, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	prefix := strings.Join(parts, separator)
+	if prefix != "" && strings.HasSuffix(path, "/") {
+		prefix += separator
+	}
+	return prefix
+}
+
+// listing returns the keys under the directory of prefix, treating separator in item titles
+// as a directory delimiter. Directories end with a slash, like vault's KV listings.
+func listing(items []onepassword.Item, prefix, separator string) ([]string, map[string]any) {
+	dir := ""
+	if idx := strings.LastIndex(prefix, separator); idx > -1 {
+		dir = prefix[0 : idx+len(separator)]
+	}
+
+	keys := []string{}
+	keyInfo := map[string]any{}
+	seen := map[string]bool{}
 	for _, item := range items {
-		key := fmt.Sprintf("%s %s", item.Title, item.ID)
-		retMap[key] = item.ID
-		retList = append(retList, key)
+		if !strings.HasPrefix(item.Title, prefix) || item.Title == dir {
+			continue
+		}
+
+		key := strings.TrimPrefix(item.Title, dir)
+		if idx := strings.Index(key, separator); idx > -1 {
+			key = key[0:idx] + "/"
+		} else {
+			keyInfo[key] = map[string]any{
+				"id":    item.ID,
+				"title": item.Title,
+			}
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
 	}
+	sort.Strings(keys)
 
-	return logical.ListResponseWithInfo(retList, retMap), nil
+	return keys, keyInfo
 }
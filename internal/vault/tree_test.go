@@ -5,10 +5,13 @@ package vault_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
 
 	"git.rob.mx/nidito/joao/internal/testdata/opconnect"
+	"git.rob.mx/nidito/joao/internal/vault/middleware"
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
 	"github.com/1Password/connect-sdk-go/onepassword"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -85,19 +88,56 @@ func TestReadEntry(t *testing.T) {
 			t.Fatalf("unexpectedJSON response.\nwanted: %s\ngot: %s", string(expectedJSON), string(gotJSON))
 		}
 	})
+
+	t.Run("with explicit vault and slashes for the separator", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      fmt.Sprintf("tree/%s/service/test", item.Vault.ID),
+			Storage:   reqStorage,
+		})
+
+		if err != nil {
+			t.Fatal("read request failed:", err)
+		}
+
+		if resp == nil || resp.IsError() {
+			t.Fatalf("could not read item: %v", resp)
+		}
+
+		gotJSON, _ := json.Marshal(resp.Data)
+
+		if string(expectedJSON) != string(gotJSON) {
+			t.Fatalf("unexpectedJSON response.\nwanted: %s\ngot: %s", string(expectedJSON), string(gotJSON))
+		}
+	})
+
+	t.Run("with default vault and slashes", func(t *testing.T) {
+		// the first segment is always the vault, so this reads "test" from a vault named "service"
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "tree/service/test",
+			Storage:   reqStorage,
+		})
+
+		if err == nil {
+			t.Fatal("expected an error reading from an unknown vault")
+		}
+	})
 }
 
 func TestListEntries(t *testing.T) {
 	b, reqStorage := getTestBackendWithConfig(t)
 	opconnect.Clear()
 	item := opconnect.Add(generateConfigItem("service:test"))
+	top := opconnect.Add(generateConfigItem("test"))
 
 	expected := map[string]any{
 		"keys": []string{
-			"service:test " + item.ID,
+			"service/",
+			"test",
 		},
-		"key_info": map[string]string{
-			"service:test " + item.ID: item.ID,
+		"key_info": map[string]any{
+			"test": map[string]string{"id": top.ID, "title": "test"},
 		},
 	}
 
@@ -169,6 +209,237 @@ func TestListEntries(t *testing.T) {
 	})
 }
 
+func TestListEntriesHierarchy(t *testing.T) {
+	b, reqStorage := getTestBackendWithConfig(t)
+	opconnect.Clear()
+	api := opconnect.Add(generateConfigItem("service:api"))
+	opconnect.Add(generateConfigItem("service:web"))
+	opconnect.Add(generateConfigItem("host:juazeiro"))
+	top := opconnect.Add(generateConfigItem("top"))
+
+	cases := []struct {
+		path     string
+		expected map[string]any
+	}{
+		{
+			path: "trees/",
+			expected: map[string]any{
+				"keys": []string{"host/", "service/", "top"},
+				"key_info": map[string]any{
+					"top": map[string]string{"id": top.ID, "title": "top"},
+				},
+			},
+		},
+		{
+			path: "trees/" + api.Vault.ID + "/service/",
+			expected: map[string]any{
+				"keys": []string{"api", "web"},
+				"key_info": map[string]any{
+					"api": map[string]string{"id": api.ID, "title": "service:api"},
+				},
+			},
+		},
+		{
+			path: "trees/" + api.Vault.ID + "/serv",
+			expected: map[string]any{
+				"keys": []string{"service/"},
+			},
+		},
+		{
+			// paths holding a slash always start with a vault
+			path:     "trees/service/",
+			expected: map[string]any{},
+		},
+		{
+			path: "trees/" + api.Vault.ID + "/service/a",
+			expected: map[string]any{
+				"keys": []string{"api"},
+				"key_info": map[string]any{
+					"api": map[string]string{"id": api.ID, "title": "service:api"},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.ListOperation,
+				Path:      c.path,
+				Storage:   reqStorage,
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.IsError() {
+				t.Fatal(resp.Error())
+			}
+
+			keys, _ := json.Marshal(resp.Data["keys"])
+			expectedKeys, _ := json.Marshal(c.expected["keys"])
+			if string(keys) != string(expectedKeys) {
+				t.Fatalf("unexpected keys.\nwanted: %s\ngot: %s", expectedKeys, keys)
+			}
+
+			if info, ok := c.expected["key_info"].(map[string]any); ok {
+				got, _ := resp.Data["key_info"].(map[string]any)
+				for key, want := range info {
+					gotJSON, _ := json.Marshal(got[key])
+					wantJSON, _ := json.Marshal(want)
+					if string(gotJSON) != string(wantJSON) {
+						t.Fatalf("unexpected key_info for %s.\nwanted: %s\ngot: %s", key, wantJSON, gotJSON)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("with slash separator", func(t *testing.T) {
+		opconnect.Clear()
+		item := opconnect.Add(generateConfigItem("service/api"))
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "1password",
+			Data:      map[string]any{"separator": "/"},
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatalf("Could not issue update request: %s", err)
+		}
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ListOperation,
+			Path:      "trees/" + item.Vault.ID + "/service/",
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys, _ := json.Marshal(resp.Data["keys"])
+		if string(keys) != `["api"]` {
+			t.Fatalf("unexpected keys: %s", keys)
+		}
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "tree/" + item.Vault.ID + "/service/api",
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal("read request failed:", err)
+		}
+
+		if resp == nil || resp.IsError() {
+			t.Fatalf("could not read listed item: %v", resp)
+		}
+	})
+}
+
+func TestReadMetadata(t *testing.T) {
+	b, reqStorage := getTestBackendWithConfig(t)
+	opconnect.Clear()
+	item := opconnect.Add(generateConfigItem("service:test"))
+	item.Version = 3
+	item.Tags = []string{"joao"}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      fmt.Sprintf("meta/%s", item.Title),
+		Storage:   reqStorage,
+	})
+
+	if err != nil {
+		t.Fatal("read request failed:", err)
+	}
+
+	if resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+
+	mapsEqual(t, resp.Data, map[string]any{
+		"id":             item.ID,
+		"title":          item.Title,
+		"vault":          item.Vault.ID,
+		"version":        3,
+		"category":       "password",
+		"checksum":       "",
+		"checksum_valid": false,
+	})
+
+	item.Fields = append(item.Fields, &onepassword.ItemField{
+		ID:      "password",
+		Type:    "CONCEALED",
+		Purpose: "PASSWORD",
+		Label:   "password",
+		Value:   opclient.Checksum(item.Fields),
+	})
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      fmt.Sprintf("meta/%s/%s", item.Vault.ID, item.Title),
+		Storage:   reqStorage,
+	})
+
+	if err != nil {
+		t.Fatal("read request failed:", err)
+	}
+
+	if resp.Data["checksum_valid"] != true {
+		t.Fatalf("expected valid checksum, got %v", resp.Data)
+	}
+}
+
+func TestReadEntryVerifyChecksum(t *testing.T) {
+	b, reqStorage := getTestBackendWithConfig(t)
+	opconnect.Clear()
+	item := opconnect.Add(generateConfigItem("service:test"))
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "1password",
+		Data:      map[string]any{"verify_checksum": true},
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("Could not issue update request: %s", err)
+	}
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      fmt.Sprintf("tree/%s", item.Title),
+		Storage:   reqStorage,
+	})
+
+	if !errors.Is(err, middleware.ErrorChecksumMismatch) {
+		t.Fatalf("expected checksum error, got: %v", err)
+	}
+
+	item.Fields = append(item.Fields, &onepassword.ItemField{
+		ID:      "password",
+		Type:    "CONCEALED",
+		Purpose: "PASSWORD",
+		Label:   "password",
+		Value:   opclient.Checksum(item.Fields),
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      fmt.Sprintf("tree/%s", item.Title),
+		Storage:   reqStorage,
+	})
+
+	if err != nil {
+		t.Fatal("read request failed:", err)
+	}
+
+	if resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+}
+
 func generateConfigItem(title string) *onepassword.Item {
 	return &onepassword.Item{
 		Category: "password",
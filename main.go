@@ -3,6 +3,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"git.rob.mx/nidito/chinampa"
@@ -34,6 +35,16 @@ func main() {
 		cmd.Flush,
 		cmd.Redact,
 		cmd.Plugin,
+		cmd.Serve,
+		cmd.Run,
+		cmd.Inject,
+		cmd.Import,
+		cmd.Validate,
+		cmd.SchemaGroup,
+		cmd.SchemaInfer,
+		cmd.Docs,
+		cmd.Stale,
+		cmd.Rotate,
 	)
 	chinampa.Register(cmd.GitFilters...)
 
@@ -50,6 +61,10 @@ Secret values are specified using the ﹅!!secret﹅ YAML tag.
 `,
 		Version: version.Version,
 	}); err != nil {
+		var exit *cmd.ChildExitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.Code)
+		}
 		logger.Errorf("total failure: %s", err)
 		os.Exit(2)
 	}
@@ -0,0 +1,183 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const yamlTagMerge = "!!merge"
+
+// keepAnchors tells if anchors, aliases and merge keys should be output, instead of the values they resolve to.
+// Sorting keys could place aliases before their anchors, and standard output is meant for comparing values.
+func keepAnchors() bool {
+	return !yamlOutput.Has(OutputModeSorted) && !yamlOutput.Has(OutputModeStandardYAML)
+}
+
+// asAlias marks e as a copy of the value anchored by node, if node is an alias.
+func (e *Entry) asAlias(node *yaml.Node) {
+	if node.Kind != yaml.AliasNode {
+		return
+	}
+	e.clearAnchors()
+	e.Alias = node.Value
+}
+
+func (e *Entry) clearAnchors() {
+	e.Anchor = ""
+	for _, child := range e.Content {
+		child.clearAnchors()
+	}
+}
+
+// mergeKeys copies the keys of maps merged with `<<` into e at index `at` of its contents, unless e defines them
+// already. Earlier maps take precedence over later ones, as per https://yaml.org/type/merge.html.
+func (e *Entry) mergeKeys(values []*yaml.Node, at int) error {
+	for _, value := range values {
+		sources := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+
+		for _, source := range sources {
+			src := NewEntry("", yaml.MappingNode)
+			if err := source.Decode(src); err != nil {
+				return err
+			}
+			if src.Kind != yaml.MappingNode {
+				return fmt.Errorf("line %d: only maps can be merged with <<, found %s", source.Line, src.Type)
+			}
+			src.asAlias(source)
+			e.merges = append(e.merges, src)
+		}
+	}
+
+	defined := map[string]bool{}
+	for idx := 0; idx < len(e.Content); idx += 2 {
+		defined[e.Content[idx].Value] = true
+	}
+
+	merged := []*Entry{}
+	for _, src := range e.merges {
+		for idx := 0; idx < len(src.Content); idx += 2 {
+			key := src.Content[idx]
+			if defined[key.Value] {
+				continue
+			}
+			defined[key.Value] = true
+
+			value := src.Content[idx+1].clone()
+			value.clearAnchors()
+			value.merged = true
+			merged = append(merged, key.clone(), value)
+		}
+	}
+
+	e.Content = append(e.Content[0:at], append(merged, e.Content[at:]...)...)
+	return nil
+}
+
+// clone returns a deep copy of e.
+func (e *Entry) clone() *Entry {
+	c := *e
+	c.Content = make([]*Entry, 0, len(e.Content))
+	for _, child := range e.Content {
+		c.Content = append(c.Content, child.clone())
+	}
+	return &c
+}
+
+// linkAliases points aliases to the entries they were copied from, in document order.
+func (e *Entry) linkAliases(anchors map[string]*Entry) {
+	if e.Anchor != "" {
+		anchors[e.Anchor] = e
+	}
+	if e.Alias != "" {
+		e.aliased = anchors[e.Alias]
+	}
+	for _, src := range e.merges {
+		src.linkAliases(anchors)
+	}
+	for _, child := range e.Content {
+		child.linkAliases(anchors)
+	}
+}
+
+// equal tells if e and other hold the same values, regardless of styles and comments.
+func (e *Entry) equal(other *Entry) bool {
+	if e.Kind != other.Kind || e.Value != other.Value || e.Tag != other.Tag || len(e.Content) != len(other.Content) {
+		return false
+	}
+	for idx, child := range e.Content {
+		if !child.equal(other.Content[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Entry) hasMerged() bool {
+	for idx := 1; idx < len(e.Content); idx += 2 {
+		if e.Content[idx].merged {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSource returns the map merged with `<<`, as it currently is, that e's key would be copied from.
+func (e *Entry) mergeSource(key string) *Entry {
+	for _, src := range e.merges {
+		current := src
+		if src.aliased != nil {
+			current = src.aliased
+		}
+		for idx := 0; idx < len(current.Content); idx += 2 {
+			if current.Content[idx].Value == key {
+				return current.Content[idx+1]
+			}
+		}
+	}
+	return nil
+}
+
+// inherits tells if value at key can be left out of e, since a merge key would set it to the same value.
+func (e *Entry) inherits(key string, value *Entry) bool {
+	source := e.mergeSource(key)
+	return source != nil && value.equal(source)
+}
+
+// mergeKeyNodes returns the `<<` key and value nodes for maps merged into e, if any.
+func (e *Entry) mergeKeyNodes() ([]*yaml.Node, error) {
+	if len(e.merges) == 0 || !keepAnchors() {
+		return nil, nil
+	}
+
+	key := &yaml.Node{Kind: yaml.ScalarNode, Value: "<<"}
+	if e.mergeKey != nil && !yamlOutput.Has(OutputModeNoComments) {
+		key.HeadComment = e.mergeKey.HeadComment
+		key.LineComment = e.mergeKey.LineComment
+		key.FootComment = e.mergeKey.FootComment
+	}
+	values := []*yaml.Node{}
+	for _, src := range e.merges {
+		if src.Alias != "" {
+			// inherited keys are compared to the anchor's current values, so the alias always stays
+			values = append(values, &yaml.Node{Kind: yaml.AliasNode, Value: src.Alias})
+			continue
+		}
+
+		node, err := src.MarshalYAML()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, node)
+	}
+
+	if len(values) == 1 {
+		return []*yaml.Node{key, values[0]}, nil
+	}
+	return []*yaml.Node{key, {Kind: yaml.SequenceNode, Style: yaml.FlowStyle, Content: values}}, nil
+}
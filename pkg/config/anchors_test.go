@@ -0,0 +1,182 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"git.rob.mx/nidito/joao/internal/testdata"
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+func TestAnchorsRoundTrip(t *testing.T) {
+	cfg, err := config.Load(testdata.YAML("anchors"), false)
+	if err != nil {
+		t.Fatalf("could not load fixture: %s", err)
+	}
+
+	expected, err := os.ReadFile(testdata.YAML("anchors"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := cfg.AsYAML()
+	if err != nil {
+		t.Fatalf("could not serialize: %s", err)
+	}
+
+	if string(got) != string(expected) {
+		t.Fatalf("anchors did not round-trip.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
+
+func TestAnchorsFlushConcreteValues(t *testing.T) {
+	cfg, err := config.Load(testdata.YAML("anchors"), false)
+	if err != nil {
+		t.Fatalf("could not load fixture: %s", err)
+	}
+
+	item, err := cfg.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+
+	fields := map[string]string{}
+	concealed := map[string]bool{}
+	for _, field := range item.Fields {
+		if field.Section != nil && field.Section.ID == "~annotations" {
+			continue
+		}
+		fields[field.ID] = field.Value
+		concealed[field.ID] = field.Type == "CONCEALED"
+	}
+
+	for id, value := range map[string]string{
+		"web.port":     "8080",
+		"web.host":     "localhost",
+		"web.password": "hunter2",
+		"api.port":     "80",
+		"api.debug":    "true",
+		"tokens.0":     "very secret",
+		"tokens.1":     "not secret",
+		"copy.1":       "http",
+	} {
+		if fields[id] != value {
+			t.Errorf("expected %s to be %s, got %q", id, value, fields[id])
+		}
+	}
+
+	for _, id := range []string{"web.password", "api.password", "tokens.0"} {
+		if !concealed[id] {
+			t.Errorf("expected %s to be concealed", id)
+		}
+	}
+
+	if _, exists := fields["web.<<"]; exists {
+		t.Errorf("merge keys should not be flushed")
+	}
+}
+
+func TestAnchorsRedacted(t *testing.T) {
+	cfg, err := config.Load(testdata.YAML("anchors"), false)
+	if err != nil {
+		t.Fatalf("could not load fixture: %s", err)
+	}
+
+	for _, modes := range [][]config.OutputMode{
+		{config.OutputModeRedacted},
+		{config.OutputModeRedacted, config.OutputModeSorted, config.OutputModeNoComments},
+	} {
+		got, err := cfg.AsYAML(modes...)
+		if err != nil {
+			t.Fatalf("could not serialize: %s", err)
+		}
+
+		for _, secret := range []string{"hunter2", "very secret"} {
+			if strings.Contains(string(got), secret) {
+				t.Fatalf("redacted output with modes %v leaked %s:\n%s", modes, secret, got)
+			}
+		}
+	}
+}
+
+func TestAnchorsModifiedAlias(t *testing.T) {
+	cfg, err := config.Load(testdata.YAML("anchors"), false)
+	if err != nil {
+		t.Fatalf("could not load fixture: %s", err)
+	}
+
+	if err := cfg.Set([]string{"web", "host"}, []byte("example.com"), false, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set([]string{"copy", "1"}, []byte("nomad-client"), false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := cfg.AsYAML(config.OutputModeNoConfig)
+	if err != nil {
+		t.Fatalf("could not serialize: %s", err)
+	}
+
+	expected := `defaults: &defaults
+  port: 80
+  host: localhost
+  password: !!secret hunter2
+token: &token !!secret very secret
+roles: &roles
+  - consul-client
+  - http
+web:
+  # inherits from defaults
+  <<: *defaults
+  host: example.com
+  port: 8080
+api:
+  <<: [*defaults, {debug: true}]
+tokens:
+  - *token
+  - not secret
+copy:
+  - consul-client
+  - nomad-client
+`
+	if string(got) != expected {
+		t.Fatalf("unexpected output.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
+
+func TestAnchorsKeys(t *testing.T) {
+	keys, err := config.KeysFromYAML([]byte("a: &x 1\nb: *x\nc: &list [1, 2]\nd: *list\n"))
+	if err != nil {
+		t.Fatalf("could not list keys: %s", err)
+	}
+
+	sort.Strings(keys)
+	if expected := []string{"a", "b", "c.0", "c.1", "d.0", "d.1"}; !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("unexpected keys, wanted %v, got %v", expected, keys)
+	}
+
+	buf, err := os.ReadFile(testdata.YAML("anchors"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err = config.KeysFromYAML(buf)
+	if err != nil {
+		t.Fatalf("could not list keys: %s", err)
+	}
+
+	for _, key := range []string{"web.host", "web.port", "web.password", "api.debug", "tokens.0"} {
+		found := false
+		for _, k := range keys {
+			found = found || k == key
+		}
+		if !found {
+			t.Fatalf("expected key %s in %v", key, keys)
+		}
+	}
+}
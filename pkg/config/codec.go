@@ -0,0 +1,484 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SecretKey wraps secret values in formats without tags, i.e. `{"$secret": "value"}` in JSON.
+const SecretKey = "$secret"
+
+// OTPKey wraps the seeds of one-time passwords in formats without tags, i.e. `{"$otp": "otpauth://totp/..."}` in JSON.
+const OTPKey = "$otp"
+
+// FileKey and BinaryKey wrap the contents of files in formats without tags, i.e. `{"$binary": "base64"}` in JSON.
+const (
+	FileKey   = "$file"
+	BinaryKey = "$binary"
+)
+
+// RefKey wraps references in formats without tags, i.e. `{"$ref": "other.joao.json#key"}` in JSON.
+const RefKey = "$ref"
+
+// wrappedTags are the tags of values wrapped in single-key maps by formats without tags.
+var wrappedTags = map[string]string{
+	SecretKey: YAMLTypeSecret,
+	OTPKey:    YAMLTypeOTP,
+	FileKey:   YAMLTypeFile,
+	BinaryKey: YAMLTypeBinary,
+	RefKey:    YAMLTypeRef,
+}
+
+// Codec reads and writes config files in a given format.
+type Codec struct {
+	Name       string
+	Extensions []string
+	// Decode parses data into a yaml node per document, with secrets tagged as `!!secret` and `_config` as `!!joao`.
+	Decode func(data []byte) ([]*yaml.Node, error)
+	// Encode serializes a tree, honoring the current output modes.
+	Encode func(tree *Entry) ([]byte, error)
+}
+
+// CodecYAML reads and writes YAML files, where secrets are tagged with `!!secret`.
+var CodecYAML = &Codec{
+	Name:       "yaml",
+	Extensions: []string{".yaml", ".yml"},
+	Decode: func(data []byte) ([]*yaml.Node, error) {
+		docs := []*yaml.Node{}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			doc := &yaml.Node{}
+			if err := dec.Decode(doc); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, err
+			}
+			// skip empty documents, like the one after a trailing `---`
+			if len(doc.Content) > 0 {
+				docs = append(docs, doc)
+			}
+		}
+
+		if len(docs) == 0 {
+			return []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}, nil
+		}
+		return docs, nil
+	},
+	Encode: encodeYAML,
+}
+
+// CodecJSON reads and writes JSON files, where secrets are wrapped as `{"$secret": "value"}`, and references as
+// `{"$ref": "file#key"}`.
+var CodecJSON = &Codec{
+	Name:       "json",
+	Extensions: []string{".json"},
+	Decode: func(data []byte) ([]*yaml.Node, error) {
+		node, err := importNode(data, "json")
+		if err != nil {
+			return nil, err
+		}
+		return []*yaml.Node{node}, unwrapTags(node, true)
+	},
+	Encode: encodeJSON,
+}
+
+// CodecTOML reads and writes TOML files, where secrets are wrapped as `{ "$secret" = "value" }`, and references as
+// `{ "$ref" = "file#key" }`.
+var CodecTOML = &Codec{
+	Name:       "toml",
+	Extensions: []string{".toml"},
+	Decode: func(data []byte) ([]*yaml.Node, error) {
+		node, err := tomlNode(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*yaml.Node{node}, unwrapTags(node, true)
+	},
+	Encode: encodeTOML,
+}
+
+var codecs = []*Codec{CodecYAML, CodecJSON, CodecTOML}
+
+func codecForExtension(path string) *Codec {
+	ext := filepath.Ext(path)
+	for _, codec := range codecs {
+		for _, candidate := range codec.Extensions {
+			if ext == candidate {
+				return codec
+			}
+		}
+	}
+	return nil
+}
+
+// CodecFor returns the codec for path's extension, defaulting to YAML.
+func CodecFor(path string) *Codec {
+	if codec := codecForExtension(path); codec != nil {
+		return codec
+	}
+	return CodecYAML
+}
+
+// argIsConfigFile tells if path looks like a config file in any known format.
+func argIsConfigFile(path string) bool {
+	return codecForExtension(path) != nil
+}
+
+// unwrapTags turns `{"$secret": value}`, `{"$ref": value}` and other wrapped maps below node into tagged scalars, and tags a
+// top-level `_config` map as `!!joao`.
+func unwrapTags(node *yaml.Node, root bool) error {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for idx, child := range node.Content {
+			if secret := unwrapTag(child); secret != nil {
+				node.Content[idx] = secret
+				continue
+			}
+			if err := unwrapTags(child, false); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for idx := 0; idx < len(node.Content); idx += 2 {
+			key, value := node.Content[idx], node.Content[idx+1]
+			if _, wrapper := wrappedTags[key.Value]; wrapper {
+				return fmt.Errorf("%s must be the only key of a map, and hold a value", key.Value)
+			}
+
+			if root && key.Value == "_config" && value.Kind == yaml.MappingNode {
+				value.Tag = YAMLTypeMetaConfig
+				continue
+			}
+
+			if secret := unwrapTag(value); secret != nil {
+				node.Content[idx+1] = secret
+				continue
+			}
+			if err := unwrapTags(value, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func unwrapTag(node *yaml.Node) *yaml.Node {
+	if node.Kind != yaml.MappingNode || len(node.Content) != 2 || node.Content[1].Kind != yaml.ScalarNode {
+		return nil
+	}
+
+	tag, wrapper := wrappedTags[node.Content[0].Value]
+	if !wrapper {
+		return nil
+	}
+	value := node.Content[1]
+	value.Tag = tag
+	value.Style = 0
+	return value
+}
+
+func encodeYAML(tree *Entry) ([]byte, error) {
+	node, err := tree.MarshalYAML()
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeNode(node)
+}
+
+func encodeNode(node *yaml.Node) ([]byte, error) {
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// pairs returns the key/value pairs of a map in output order, skipping `_config` if so desired.
+func (e *Entry) pairs() [][2]*Entry {
+	pairs := [][2]*Entry{}
+	entries := e.Contents()
+	for i := 0; i < len(entries); i += 2 {
+		if yamlOutput.Has(OutputModeNoConfig) && entries[i+1].Type == YAMLTypeMetaConfig {
+			continue
+		}
+		pairs = append(pairs, [2]*Entry{entries[i], entries[i+1]})
+	}
+	return pairs
+}
+
+func encodeJSON(tree *Entry) ([]byte, error) {
+	var out bytes.Buffer
+	if err := writeJSON(&out, tree, ""); err != nil {
+		return nil, err
+	}
+	out.WriteString("\n")
+	return out.Bytes(), nil
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func jsonScalar(e *Entry) (string, error) {
+	switch {
+	case e.IsOTP():
+		return fmt.Sprintf(`{%s: %s}`, jsonString(OTPKey), jsonString(e.String())), nil
+	case e.Tag == YAMLTypeFile:
+		return fmt.Sprintf(`{%s: %s}`, jsonString(FileKey), jsonString(e.String())), nil
+	case e.Tag == YAMLTypeBinary:
+		return fmt.Sprintf(`{%s: %s}`, jsonString(BinaryKey), jsonString(e.String())), nil
+	case e.IsSecret():
+		return fmt.Sprintf(`{%s: %s}`, jsonString(SecretKey), jsonString(e.String())), nil
+	case e.IsRef():
+		return fmt.Sprintf(`{%s: %s}`, jsonString(RefKey), jsonString(e.Value)), nil
+	case e.Type == "!!null":
+		return "null", nil
+	case e.isLiteral():
+		var value any
+		if err := yaml.Unmarshal([]byte(e.Value), &value); err != nil {
+			return "", fmt.Errorf("could not encode %s: %w", strings.Join(e.Path, "."), err)
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("could not encode %s: %w", strings.Join(e.Path, "."), err)
+		}
+		return string(b), nil
+	}
+	return jsonString(e.Value), nil
+}
+
+func writeJSON(out *bytes.Buffer, e *Entry, indent string) error {
+	switch e.Kind {
+	case yaml.MappingNode, yaml.DocumentNode:
+		pairs := e.pairs()
+		if len(pairs) == 0 {
+			out.WriteString("{}")
+			return nil
+		}
+		out.WriteString("{\n")
+		for idx, pair := range pairs {
+			out.WriteString(indent + "  " + jsonString(pair[0].Value) + ": ")
+			if err := writeJSON(out, pair[1], indent+"  "); err != nil {
+				return err
+			}
+			if idx < len(pairs)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "}")
+	case yaml.SequenceNode:
+		if len(e.Content) == 0 {
+			out.WriteString("[]")
+			return nil
+		}
+		out.WriteString("[\n")
+		for idx, child := range e.Content {
+			out.WriteString(indent + "  ")
+			if err := writeJSON(out, child, indent+"  "); err != nil {
+				return err
+			}
+			if idx < len(e.Content)-1 {
+				out.WriteString(",")
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "]")
+	default:
+		value, err := jsonScalar(e)
+		if err != nil {
+			return err
+		}
+		out.WriteString(value)
+	}
+	return nil
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(key string) string {
+	if tomlBareKey.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+func tomlString(s string) string {
+	var out strings.Builder
+	out.WriteString(`"`)
+	for _, r := range s {
+		switch r {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&out, `\u%04X`, r)
+				continue
+			}
+			out.WriteRune(r)
+		}
+	}
+	out.WriteString(`"`)
+	return out.String()
+}
+
+func tomlScalar(e *Entry) (string, error) {
+	switch {
+	case e.IsOTP():
+		return fmt.Sprintf(`{ %s = %s }`, tomlString(OTPKey), tomlString(e.String())), nil
+	case e.Tag == YAMLTypeFile:
+		return fmt.Sprintf(`{ %s = %s }`, tomlString(FileKey), tomlString(e.String())), nil
+	case e.Tag == YAMLTypeBinary:
+		return fmt.Sprintf(`{ %s = %s }`, tomlString(BinaryKey), tomlString(e.String())), nil
+	case e.IsSecret():
+		return fmt.Sprintf(`{ %s = %s }`, tomlString(SecretKey), tomlString(e.String())), nil
+	case e.IsRef():
+		return fmt.Sprintf(`{ %s = %s }`, tomlString(RefKey), tomlString(e.Value)), nil
+	case e.Type == "!!null":
+		return "", fmt.Errorf("cannot encode null value at %s as toml", strings.Join(e.Path, "."))
+	case e.Type == "!!float":
+		switch strings.ToLower(e.Value) {
+		case ".inf", "+.inf":
+			return "inf", nil
+		case "-.inf":
+			return "-inf", nil
+		case ".nan":
+			return "nan", nil
+		}
+		fallthrough
+	case e.isLiteral():
+		var value any
+		if err := yaml.Unmarshal([]byte(e.Value), &value); err != nil {
+			return "", fmt.Errorf("could not encode %s: %w", strings.Join(e.Path, "."), err)
+		}
+		if f, ok := value.(float64); ok {
+			repr := fmt.Sprintf("%v", f)
+			if !strings.ContainsAny(repr, ".eE") {
+				repr += ".0"
+			}
+			return repr, nil
+		}
+		return fmt.Sprintf("%v", value), nil
+	}
+	return tomlString(e.Value), nil
+}
+
+// tomlInline returns e as an inline toml value.
+func tomlInline(e *Entry) (string, error) {
+	switch e.Kind {
+	case yaml.MappingNode:
+		parts := []string{}
+		for _, pair := range e.pairs() {
+			value, err := tomlInline(pair[1])
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, tomlKey(pair[0].Value)+" = "+value)
+		}
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	case yaml.SequenceNode:
+		parts := []string{}
+		for _, child := range e.Content {
+			value, err := tomlInline(child)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, value)
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	}
+	return tomlScalar(e)
+}
+
+// isTableArray tells if e is a non-empty list made only of maps, output as `[[table]]`s.
+func (e *Entry) isTableArray() bool {
+	if e.Kind != yaml.SequenceNode || len(e.Content) == 0 {
+		return false
+	}
+	for _, child := range e.Content {
+		if child.Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeTOML(tree *Entry) ([]byte, error) {
+	var out bytes.Buffer
+	if err := writeTOMLTable(&out, tree, nil); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// writeTOMLTable writes the values of table, followed by its sub-tables and arrays of tables.
+func writeTOMLTable(out *bytes.Buffer, table *Entry, path []string) error {
+	tables := [][2]*Entry{}
+	for _, pair := range table.pairs() {
+		key, value := pair[0], pair[1]
+		if value.Kind == yaml.MappingNode || value.isTableArray() {
+			tables = append(tables, pair)
+			continue
+		}
+
+		repr, err := tomlInline(value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s = %s\n", tomlKey(key.Value), repr)
+	}
+
+	for _, pair := range tables {
+		key, value := pair[0], pair[1]
+		sub := append(append([]string{}, path...), tomlKey(key.Value))
+		header := strings.Join(sub, ".")
+
+		if value.Kind == yaml.MappingNode {
+			if out.Len() > 0 {
+				out.WriteString("\n")
+			}
+			fmt.Fprintf(out, "[%s]\n", header)
+			if err := writeTOMLTable(out, value, sub); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, item := range value.Content {
+			if out.Len() > 0 {
+				out.WriteString("\n")
+			}
+			fmt.Fprintf(out, "[[%s]]\n", header)
+			if err := writeTOMLTable(out, item, sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
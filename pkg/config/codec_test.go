@@ -0,0 +1,245 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"git.rob.mx/nidito/joao/internal/testdata"
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+func TestCodecJSON(t *testing.T) {
+	cfg, err := config.Load(testdata.YAML("test"), false)
+	if err != nil {
+		t.Fatalf("could not load fixture: %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.joao.json")
+	if err := cfg.AsFile(path); err != nil {
+		t.Fatalf("could not write json: %s", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "_config": {
+    "name": "some:test",
+    "vault": "example"
+  },
+  "int": 1,
+  "string": "pato",
+  "bool": false,
+  "secret": {"$secret": "very secret"},
+  "nested": {
+    "int": 1,
+    "bool": true,
+    "list": [
+      1,
+      2,
+      3
+    ],
+    "secret": {"$secret": "very secret"},
+    "second_secret": {"$secret": "very secret"},
+    "string": "quem"
+  },
+  "list": [
+    "one",
+    "two",
+    "three"
+  ]
+}
+`
+	if string(got) != expected {
+		t.Fatalf("unexpected json.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+
+	assertSameItem(t, cfg, path)
+
+	redacted, err := cfg.Encode(config.CodecJSON, config.OutputModeRedacted, config.OutputModeNoConfig, config.OutputModeSorted)
+	if err != nil {
+		t.Fatalf("could not encode redacted: %s", err)
+	}
+	expected = `{
+  "bool": false,
+  "int": 1,
+  "list": [
+    "one",
+    "two",
+    "three"
+  ],
+  "nested": {
+    "bool": true,
+    "int": 1,
+    "list": [
+      1,
+      2,
+      3
+    ],
+    "second_secret": {"$secret": ""},
+    "secret": {"$secret": ""},
+    "string": "quem"
+  },
+  "secret": {"$secret": ""},
+  "string": "pato"
+}
+`
+	if string(redacted) != expected {
+		t.Fatalf("unexpected redacted json.\nwanted:\n%s\n---\ngot:\n%s", expected, redacted)
+	}
+}
+
+func TestCodecTOML(t *testing.T) {
+	cfg, err := config.Load(testdata.YAML("test"), false)
+	if err != nil {
+		t.Fatalf("could not load fixture: %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.joao.toml")
+	if err := cfg.AsFile(path); err != nil {
+		t.Fatalf("could not write toml: %s", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `int = 1
+string = "pato"
+bool = false
+secret = { "$secret" = "very secret" }
+list = ["one", "two", "three"]
+
+[_config]
+name = "some:test"
+vault = "example"
+
+[nested]
+int = 1
+bool = true
+list = [1, 2, 3]
+secret = { "$secret" = "very secret" }
+second_secret = { "$secret" = "very secret" }
+string = "quem"
+`
+	if string(got) != expected {
+		t.Fatalf("unexpected toml.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+
+	assertSameItem(t, cfg, path)
+
+	redacted, err := cfg.Encode(config.CodecTOML, config.OutputModeRedacted, config.OutputModeNoConfig)
+	if err != nil {
+		t.Fatalf("could not encode redacted: %s", err)
+	}
+	decoded, err := config.Decode(config.CodecTOML, redacted)
+	if err != nil {
+		t.Fatalf("could not decode redacted toml: %s", err)
+	}
+	if secret := decoded.Tree.Lookup([]string{"nested", "secret"}); secret == nil || !secret.IsSecret() || secret.Value != "" {
+		t.Fatalf("expected an empty secret, got %+v", secret)
+	}
+}
+
+func TestCodecTOMLTables(t *testing.T) {
+	path := importFixture(t, "servers.joao.toml", `title = "cluster"
+
+[_config]
+vault = "example"
+name = "servers"
+
+[[servers]]
+host = "a.example.com"
+token = { "$secret" = "abc" }
+
+[servers.tls]
+cert = "a.pem"
+
+[[servers]]
+host = "b.example.com"
+token = { "$secret" = "def" }
+`)
+
+	cfg, err := config.Load(path, false)
+	if err != nil {
+		t.Fatalf("could not load toml: %s", err)
+	}
+
+	if cfg.Name != "servers" || cfg.Vault != "example" {
+		t.Fatalf("unexpected vault and name: %s/%s", cfg.Vault, cfg.Name)
+	}
+
+	yaml, err := cfg.AsYAML(config.OutputModeNoConfig)
+	if err != nil {
+		t.Fatalf("could not serialize: %s", err)
+	}
+	expected := `title: cluster
+servers:
+  - host: a.example.com
+    token: !!secret abc
+    tls:
+      cert: a.pem
+  - host: b.example.com
+    token: !!secret def
+`
+	if string(yaml) != expected {
+		t.Fatalf("unexpected yaml.\nwanted:\n%s\n---\ngot:\n%s", expected, yaml)
+	}
+
+	out, err := cfg.Encode(config.CodecTOML)
+	if err != nil {
+		t.Fatalf("could not encode: %s", err)
+	}
+	again, err := config.Decode(config.CodecTOML, out)
+	if err != nil {
+		t.Fatalf("could not decode %s: %s", out, err)
+	}
+	if !reflect.DeepEqual(again.ToMap(), cfg.ToMap()) {
+		t.Fatalf("toml did not round-trip:\n%s", out)
+	}
+}
+
+func TestCodecJSONInvalidSecret(t *testing.T) {
+	_, err := config.Decode(config.CodecJSON, []byte(`{"password": {"$secret": "a", "other": "b"}}`))
+	if err == nil {
+		t.Fatal("expected an error decoding a $secret with siblings")
+	}
+}
+
+// assertSameItem checks the file at path flushes the same as cfg does.
+func assertSameItem(t *testing.T, cfg *config.Config, path string) {
+	t.Helper()
+	other, err := config.Load(path, false)
+	if err != nil {
+		t.Fatalf("could not load %s: %s", path, err)
+	}
+
+	if other.Name != cfg.Name || other.Vault != cfg.Vault {
+		t.Fatalf("unexpected vault and name: %s/%s", other.Vault, other.Name)
+	}
+
+	expectedItem, err := cfg.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+	gotItem, err := other.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+
+	if expected, got := expectedItem.GetValue("password"), gotItem.GetValue("password"); expected != got {
+		t.Fatalf("items differ, wanted checksum %s, got %s", expected, got)
+	}
+
+	modes := []config.OutputMode{config.OutputModeSorted, config.OutputModeNoComments}
+	expected, _ := cfg.AsYAML(modes...)
+	got, _ := other.AsYAML(modes...)
+	if string(expected) != string(got) {
+		t.Fatalf("trees differ.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
@@ -19,6 +19,14 @@ var annotationsSection = &op.ItemSection{
 	ID:    "~annotations",
 	Label: "~annotations",
 }
+
+// mapAnnotation marks maps with numeric keys, which would be read back as sequences otherwise.
+const mapAnnotation = "map"
+
+// escapedLabelsAnnotation marks items whose labels escape the keys they're joined from, see EscapeKey. Items
+// flushed before keys were escaped lack it, and their labels are split at every dot instead.
+const escapedLabelsAnnotation = "~labels"
+
 var defaultItemFields = []*op.ItemField{
 	{
 		ID:      "password",
@@ -136,7 +144,7 @@ func (cfg *Config) Set(path []string, data []byte, isSecret, parseEntry bool) er
 		}
 
 		kind := yaml.MappingNode
-		if idx+1 == len(path)-1 && isNumeric(path[idx+1]) {
+		if isNumeric(path[idx+1]) {
 			kind = yaml.SequenceNode
 		}
 		sub := NewEntry(key, kind)
@@ -162,7 +170,7 @@ func (cfg *Config) OPURL() string {
 
 func (cfg *Config) DiffRemote(path string, redacted, asFetch bool, stdout, stderr io.Writer) error {
 	logrus.Debugf("loading remote for %s", path)
-	remote, err := Load(path, true)
+	remote, err := Remote(cfg.Vault, cfg.Name)
 	if err != nil {
 		if asFetch {
 			return err
@@ -0,0 +1,217 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeyDoc documents a key of a config.
+type KeyDoc struct {
+	Path        string `json:"path"`
+	Type        string `json:"type"`
+	Secret      bool   `json:"secret"`
+	Comment     string `json:"comment,omitempty"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	// Origin is the file the key was inherited from, if any.
+	Origin string `json:"origin,omitempty"`
+}
+
+// ConfigDoc documents every key of a config.
+type ConfigDoc struct {
+	File  string    `json:"file"`
+	Vault string    `json:"vault"`
+	Name  string    `json:"name"`
+	Keys  []*KeyDoc `json:"keys"`
+}
+
+// Docs documents cfg, a document of f, with the values it inherits. Descriptions are read from its schema, if any.
+func (f *File) Docs(cfg *Config) (*ConfigDoc, error) {
+	effective, err := f.Effective(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema *Schema
+	if path, err := f.SchemaPath(cfg); err != nil {
+		return nil, err
+	} else if path != "" {
+		if schema, err = LoadSchema(path); err != nil {
+			return nil, err
+		}
+	}
+
+	doc := &ConfigDoc{File: f.Label(cfg), Vault: cfg.Vault, Name: cfg.Name, Keys: []*KeyDoc{}}
+	doc.add(effective.Tree, nil, schema)
+
+	// inherited keys point to files relative to this one
+	if dir, err := filepath.Abs(filepath.Dir(f.Path)); err == nil {
+		for _, key := range doc.Keys {
+			if rel, err := filepath.Rel(dir, key.Origin); key.Origin != "" && err == nil {
+				key.Origin = rel
+			}
+		}
+	}
+	return doc, nil
+}
+
+// commentText strips the `#` from yaml comments, joining every one given.
+func commentText(comments ...string) string {
+	lines := []string{}
+	for _, comment := range comments {
+		for _, line := range strings.Split(comment, "\n") {
+			line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#"))
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// scalarList tells if e is a list of scalars, documented as a single key.
+func (e *Entry) scalarList() bool {
+	if e.Kind != yaml.SequenceNode {
+		return false
+	}
+	for _, child := range e.Content {
+		if !child.IsScalar() {
+			return false
+		}
+	}
+	return true
+}
+
+func (doc *ConfigDoc) add(e *Entry, key *Entry, schema *Schema) {
+	if len(e.Path) > 0 {
+		comments := []string{}
+		if key != nil {
+			comments = append(comments, key.HeadComment, key.LineComment)
+		}
+		comments = append(comments, e.HeadComment, e.LineComment)
+
+		kd := &KeyDoc{
+			Path:    JoinPath(e.Path),
+			Type:    e.valueType(),
+			Secret:  e.IsSecret(),
+			Comment: commentText(comments...),
+			Origin:  e.origin,
+		}
+
+		if schema != nil {
+			if ks := schema.Lookup(e.Path); ks != nil {
+				kd.Description = ks.Description
+			}
+		}
+
+		switch {
+		case e.IsRef():
+			kd.Type = "ref"
+			kd.Default = e.Value
+		case e.IsScalar() && !e.IsSecret():
+			kd.Default = e.Value
+		case e.scalarList() && !e.hasSecrets():
+			values := []any{}
+			for _, child := range e.Content {
+				values = append(values, child.AsMap())
+			}
+			if data, err := json.Marshal(values); err == nil {
+				kd.Default = string(data)
+			}
+		}
+
+		doc.Keys = append(doc.Keys, kd)
+		if e.scalarList() {
+			return
+		}
+	}
+
+	switch e.Kind {
+	case yaml.SequenceNode:
+		for _, child := range e.Content {
+			doc.add(child, nil, schema)
+		}
+	case yaml.MappingNode, yaml.DocumentNode:
+		for idx := 1; idx < len(e.Content); idx += 2 {
+			child := e.Content[idx]
+			if len(e.Path) == 0 && child.Type == YAMLTypeMetaConfig {
+				continue
+			}
+			doc.add(child, e.Content[idx-1], schema)
+		}
+	}
+}
+
+func (e *Entry) hasSecrets() bool {
+	if e.IsSecret() {
+		return true
+	}
+	for _, child := range e.Content {
+		if child.hasSecrets() {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownCell escapes text for a markdown table cell.
+func markdownCell(text string, code bool) string {
+	if text == "" {
+		return ""
+	}
+
+	text = strings.ReplaceAll(text, "|", `\|`)
+	if code {
+		text = strings.ReplaceAll(text, "\n", " ")
+		if strings.Contains(text, "`") {
+			return "`` " + text + " ``"
+		}
+		return "`" + text + "`"
+	}
+	return strings.ReplaceAll(text, "\n", "<br>")
+}
+
+// Markdown renders doc as a markdown section, with a table listing every key.
+func (doc *ConfigDoc) Markdown() []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "## %s\n\n", doc.File)
+	fmt.Fprintf(&out, "Stored at `op://%s/%s`.\n\n", doc.Vault, doc.Name)
+
+	if len(doc.Keys) == 0 {
+		out.WriteString("This config holds no keys.\n")
+		return out.Bytes()
+	}
+
+	out.WriteString("| Key | Type | Secret | Default | Description |\n")
+	out.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, key := range doc.Keys {
+		secret := "no"
+		if key.Secret {
+			secret = "yes"
+		}
+
+		description := key.Comment
+		if key.Description != "" {
+			description = commentText(key.Description, key.Comment)
+		}
+		if key.Origin != "" {
+			description = commentText(description, "inherited from "+key.Origin)
+		}
+
+		fmt.Fprintf(&out, "| %s | %s | %s | %s | %s |\n",
+			markdownCell(key.Path, true),
+			key.Type,
+			secret,
+			markdownCell(key.Default, true),
+			markdownCell(description, false),
+		)
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,53 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+func TestDocs(t *testing.T) {
+	dir := refFixtures(t, map[string]string{
+		"schema.yaml": "keys:\n  smtp.port:\n    description: The port to submit mail to\n",
+		"smtp.yaml": `_config: !!joao
+  vault: example
+  name: smtp
+  schema: schema.yaml
+# how we send mail
+smtp:
+  # the relay we use
+  server: smtp.example.com
+  port: 587 # submission
+  password: !!secret hunter2
+  # who can send
+  senders: [ops, "on|call"]
+`,
+	})
+
+	file, err := config.LoadFile(filepath.Join(dir, "smtp.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := file.Docs(file.Documents[0])
+	if err != nil {
+		t.Fatalf("could not document: %s", err)
+	}
+
+	got := string(doc.Markdown())
+	expected := "## " + filepath.Join(dir, "smtp.yaml") + "\n\n" + "Stored at `op://example/smtp`.\n\n" +
+		`| Key | Type | Secret | Default | Description |
+| --- | --- | --- | --- | --- |
+| ` + "`smtp`" + ` | map | no |  | how we send mail |
+| ` + "`smtp.server`" + ` | string | no | ` + "`smtp.example.com`" + ` | the relay we use |
+| ` + "`smtp.port`" + ` | int | no | ` + "`587`" + ` | The port to submit mail to<br>submission |
+| ` + "`smtp.password`" + ` | string | yes |  |  |
+| ` + "`smtp.senders`" + ` | list | no | ` + "`[\"ops\",\"on\\|call\"]`" + ` | who can send |
+`
+	if got != expected {
+		t.Fatalf("unexpected docs.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
@@ -5,6 +5,7 @@ package config
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	op "github.com/1Password/connect-sdk-go/onepassword"
@@ -28,6 +29,22 @@ type Entry struct {
 	Column      int
 	// The ShortTag
 	Type string
+	// Anchor names this entry, so others may refer to it with an alias.
+	Anchor string
+	// Alias is the name of the anchor this entry was copied from, if any.
+	Alias string
+	// aliased is the entry anchored as Alias.
+	aliased *Entry
+	// merges are the maps whose keys were merged into this one with `<<`.
+	merges []*Entry
+	// mergeKey is the `<<` key itself, holding its comments.
+	mergeKey *yaml.Node
+	// refTarget is the `op://` reference a file reference points to.
+	refTarget string
+	// origin is the file an entry of an effective tree was inherited from.
+	origin string
+	// merged tells this entry was copied from a map merged with `<<`.
+	merged bool
 }
 
 func NewEntry(name string, kind yaml.Kind) *Entry {
@@ -53,6 +70,7 @@ func (e *Entry) copyFromNode(n *yaml.Node) {
 	e.Line = n.Line
 	e.Column = n.Column
 	e.Type = n.ShortTag()
+	e.Anchor = n.Anchor
 }
 
 func (e *Entry) String() string {
@@ -91,6 +109,18 @@ func (e *Entry) ChildNamed(name string) *Entry {
 	return nil
 }
 
+// Lookup returns the entry at path below e, or nil if there's none.
+func (e *Entry) Lookup(path []string) *Entry {
+	entry := e
+	for _, part := range path {
+		entry = entry.ChildNamed(part)
+		if entry == nil {
+			return nil
+		}
+	}
+	return entry
+}
+
 func (e *Entry) SetPath(parent []string, current string) {
 	if current != "." {
 		e.Path = append([]string{}, parent...)
@@ -118,6 +148,11 @@ func (e *Entry) UnmarshalYAML(node *yaml.Node) error {
 	e.copyFromNode(node)
 
 	switch node.Kind {
+	case yaml.AliasNode:
+		if err := e.UnmarshalYAML(node.Alias); err != nil {
+			return err
+		}
+		e.asAlias(node)
 	case yaml.SequenceNode, yaml.ScalarNode:
 		for _, n := range node.Content {
 			sub := &Entry{}
@@ -125,12 +160,22 @@ func (e *Entry) UnmarshalYAML(node *yaml.Node) error {
 			if err := n.Decode(&sub); err != nil {
 				return err
 			}
+			sub.asAlias(n)
 			e.Content = append(e.Content, sub)
 		}
 	case yaml.DocumentNode, yaml.MappingNode:
+		var merges []*yaml.Node
+		mergeAt := 0
 		for idx := 0; idx < len(node.Content); idx += 2 {
 			keyNode := node.Content[idx]
 			valueNode := node.Content[idx+1]
+			if keyNode.ShortTag() == yamlTagMerge {
+				merges = append(merges, valueNode)
+				e.mergeKey = &yaml.Node{HeadComment: keyNode.HeadComment, LineComment: keyNode.LineComment, FootComment: keyNode.FootComment}
+				mergeAt = len(e.Content)
+				continue
+			}
+
 			key := NewEntry("", keyNode.Kind)
 			value := NewEntry(keyNode.Value, keyNode.Kind)
 			if err := keyNode.Decode(key); err != nil {
@@ -142,11 +187,16 @@ func (e *Entry) UnmarshalYAML(node *yaml.Node) error {
 				logrus.Errorf("decode map key: %s", keyNode.Value)
 				return err
 			}
+			value.asAlias(valueNode)
 			if valueNode.Tag == YAMLTypeMetaConfig {
 				key.Type = YAMLTypeMetaConfig
 			}
 			e.Content = append(e.Content, key, value)
 		}
+
+		if len(merges) > 0 {
+			return e.mergeKeys(merges, mergeAt)
+		}
 	default:
 		return fmt.Errorf("unknown yaml type: %v", node.Kind)
 	}
@@ -157,15 +207,31 @@ func (e *Entry) IsScalar() bool {
 	return e.Kind != yaml.DocumentNode && e.Kind != yaml.MappingNode && e.Kind != yaml.SequenceNode
 }
 
+// IsSecret tells if e holds a secret value, including the seeds of one-time passwords and files.
 func (e *Entry) IsSecret() bool {
-	return e.Tag == YAMLTypeSecret
+	return e.Tag == YAMLTypeSecret || e.Tag == YAMLTypeOTP || e.IsFile()
 }
 
 func (e *Entry) TypeStr() string {
+	if e.IsOTP() {
+		return "otp"
+	}
+
+	switch e.Tag {
+	case YAMLTypeFile:
+		return "file"
+	case YAMLTypeBinary:
+		return "binary"
+	}
+
 	if e.IsSecret() {
 		return "secret"
 	}
 
+	if e.IsRef() {
+		return "ref"
+	}
+
 	switch e.Type {
 	case "!!bool":
 		return "bool"
@@ -189,6 +255,15 @@ func (e *Entry) asNode() *yaml.Node {
 		Content: []*yaml.Node{},
 	}
 
+	if keepAnchors() {
+		n.Anchor = e.Anchor
+	}
+
+	if e.IsSecret() && n.Value == "" {
+		// block scalars can't be empty, redacted multi-line secrets would be quoted otherwise
+		n.Style &^= yaml.LiteralStyle | yaml.FoldedStyle
+	}
+
 	if !yamlOutput.Has(OutputModeNoComments) {
 		n.HeadComment = e.HeadComment
 		n.LineComment = e.LineComment
@@ -216,6 +291,10 @@ func (e *Entry) asNode() *yaml.Node {
 }
 
 func (e *Entry) MarshalYAML() (*yaml.Node, error) {
+	if keepAnchors() && e.aliased != nil && e.equal(e.aliased) {
+		return &yaml.Node{Kind: yaml.AliasNode, Value: e.Alias}, nil
+	}
+
 	n := e.asNode()
 
 	if e.Kind == yaml.SequenceNode {
@@ -232,6 +311,16 @@ func (e *Entry) MarshalYAML() (*yaml.Node, error) {
 			return nil, fmt.Errorf("cannot decode odd numbered contents list: %s", e.Path)
 		}
 
+		// the merge key goes where the first key it merged is, or first if there's none left
+		mergeKey, err := e.mergeKeyNodes()
+		if err != nil {
+			return nil, err
+		}
+		if !e.hasMerged() {
+			n.Content = append(n.Content, mergeKey...)
+			mergeKey = nil
+		}
+
 		for i := 0; i < len(entries); i += 2 {
 			key := entries[i]
 			value := entries[i+1]
@@ -239,6 +328,14 @@ func (e *Entry) MarshalYAML() (*yaml.Node, error) {
 				continue
 			}
 
+			if value.merged && keepAnchors() {
+				n.Content = append(n.Content, mergeKey...)
+				mergeKey = nil
+				if e.inherits(key.Value, value) {
+					continue
+				}
+			}
+
 			if key.Type == "" {
 				key.Kind = yaml.ScalarNode
 				key.Type = "!!map"
@@ -263,23 +360,41 @@ func (e *Entry) MarshalYAML() (*yaml.Node, error) {
 func (e *Entry) FromOP(fields []*op.ItemField) error {
 	annotations := map[string]string{}
 	data := map[string]string{}
+	otp := map[string]bool{}
 	entryKeys := []string{}
 
+	splitLabel, escapeSection := SplitPath, EscapeKey
+	if !hasEscapedLabels(fields) {
+		splitLabel = func(label string) ([]string, error) { return strings.Split(label, "."), nil }
+		escapeSection = func(section string) string { return section }
+	}
+
 	for _, field := range fields {
 		label := field.Label
 		if field.Section != nil {
 			if field.Section.Label == "~annotations" {
-				annotations[label] = field.Value
+				path, err := splitLabel(label)
+				if err != nil {
+					return fmt.Errorf("could not read annotation %s: %w", label, err)
+				}
+				annotations[JoinPath(path)] = field.Value
 				continue
 			} else {
-				label = field.Section.Label + "." + label
+				label = escapeSection(field.Section.Label) + "." + label
 			}
 		}
 		if label == "password" || label == "notesPlain" {
 			continue
 		}
+
+		path, err := splitLabel(label)
+		if err != nil {
+			return fmt.Errorf("could not read field %s: %w", label, err)
+		}
+		label = JoinPath(path)
 		entryKeys = append(entryKeys, label)
 		data[label] = field.Value
+		otp[label] = field.Type == op.FieldTypeOTP
 	}
 
 	for _, label := range entryKeys {
@@ -287,15 +402,32 @@ func (e *Entry) FromOP(fields []*op.ItemField) error {
 		var style yaml.Style
 		var tag string
 		kind := ""
+		refTarget, isRef := parseRefAnnotation(annotations[label])
+		fileTag, isFile := parseFileAnnotation(annotations[label])
 
-		if annotations[label] == "secret" {
+		if isFile {
+			style = yaml.TaggedStyle
+			tag = fileTag
+			if strings.Contains(valueStr, "\n") {
+				style |= yaml.LiteralStyle
+			}
+		} else if otp[label] || annotations[label] == "otp" {
+			style = yaml.TaggedStyle
+			tag = YAMLTypeOTP
+		} else if annotations[label] == "secret" {
 			style = yaml.TaggedStyle
 			tag = YAMLTypeSecret
+		} else if isRef {
+			style = yaml.TaggedStyle
+			tag = YAMLTypeRef
 		} else if k, ok := annotations[label]; ok {
 			kind = "!!" + k
 		}
 
-		path := strings.Split(label, ".")
+		path, err := SplitPath(label)
+		if err != nil {
+			return fmt.Errorf("could not read field %s: %w", label, err)
+		}
 		container := e
 
 		for idx, key := range path {
@@ -307,27 +439,20 @@ func (e *Entry) FromOP(fields []*op.ItemField) error {
 					existing.Kind = yaml.ScalarNode
 					existing.Path = path
 					existing.Type = kind
+					existing.refTarget = refTarget
 					break
 				}
 
-				newEntry := &Entry{
-					Path:  path,
-					Kind:  yaml.ScalarNode,
-					Value: valueStr,
-					Style: style,
-					Tag:   tag,
-					Type:  kind,
-				}
-				if isNumeric(key) {
-					logrus.Debugf("hydrating sequence value at %s", path)
-					container.Kind = yaml.SequenceNode
-					container.Content = append(container.Content, newEntry)
-				} else {
-					logrus.Debugf("hydrating map value at %s", path)
-					keyEntry := NewEntry(key, yaml.ScalarNode)
-					keyEntry.Value = key
-					container.Content = append(container.Content, keyEntry, newEntry)
-				}
+				logrus.Debugf("hydrating value at %s", path)
+				container.appendChild(key, &Entry{
+					Path:      path,
+					Kind:      yaml.ScalarNode,
+					Value:     valueStr,
+					Style:     style,
+					Tag:       tag,
+					Type:      kind,
+					refTarget: refTarget,
+				})
 				break
 			}
 
@@ -337,18 +462,15 @@ func (e *Entry) FromOP(fields []*op.ItemField) error {
 				continue
 			}
 
+			// numeric keys are sequence indices, unless annotated as belonging to a map
 			kind := yaml.MappingNode
-			if idx+1 == len(path)-1 && isNumeric(path[idx+1]) {
+			if isNumeric(path[idx+1]) && annotations[JoinPath(path[0:idx+1])] != mapAnnotation {
 				logrus.Debugf("creating sequence container for key %s at %s", key, path)
 				kind = yaml.SequenceNode
 			}
 			child := NewEntry(key, kind)
-			child.Path = append([]string{}, container.Path...)
-			child.Path = append(child.Path, key)
-
-			keyEntry := NewEntry(child.Name(), yaml.ScalarNode)
-			keyEntry.Value = key
-			container.Content = append(container.Content, keyEntry, child)
+			child.Path = append([]string{}, path[0:idx+1]...)
+			container.appendChild(key, child)
 			container = child
 		}
 	}
@@ -356,24 +478,81 @@ func (e *Entry) FromOP(fields []*op.ItemField) error {
 	return nil
 }
 
+// hasEscapedLabels tells if fields were flushed escaping keys within their labels.
+func hasEscapedLabels(fields []*op.ItemField) bool {
+	for _, field := range fields {
+		if field.Section != nil && field.Section.Label == annotationsSection.Label && field.Label == escapedLabelsAnnotation {
+			return true
+		}
+	}
+	return false
+}
+
+// appendChild adds child to e under key, keeping the items of sequences sorted by their index.
+func (e *Entry) appendChild(key string, child *Entry) {
+	if e.Kind != yaml.SequenceNode {
+		keyEntry := NewEntry(key, yaml.ScalarNode)
+		keyEntry.Value = key
+		if isNumeric(key) {
+			// keeps numeric keys from being output as ints
+			keyEntry.Tag = "!!str"
+		}
+		e.Content = append(e.Content, keyEntry, child)
+		return
+	}
+
+	index, _ := strconv.Atoi(key)
+	at := len(e.Content)
+	for at > 0 {
+		if previous, _ := strconv.Atoi(e.Content[at-1].Name()); previous < index {
+			break
+		}
+		at--
+	}
+	e.Content = append(e.Content[:at], append([]*Entry{child}, e.Content[at:]...)...)
+}
+
+// hasNumericKeys tells if e is a map with keys that would be read back from 1Password as sequence indices.
+func (e *Entry) hasNumericKeys() bool {
+	if e.Kind != yaml.MappingNode || len(e.Path) == 0 {
+		return false
+	}
+
+	for idx := 0; idx < len(e.Content); idx += 2 {
+		if isNumeric(e.Content[idx].Value) {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Entry) ToOP() []*op.ItemField {
 	ret := []*op.ItemField{}
 	var section *op.ItemSection
 
 	if e.IsScalar() {
 		name := e.Path[len(e.Path)-1]
-		fullPath := strings.Join(e.Path, ".")
+		fullPath := JoinPath(e.Path)
 		if len(e.Path) > 1 {
 			section = &op.ItemSection{ID: e.Path[0], Label: e.Path[0]}
-			name = strings.Join(e.Path[1:], ".")
+			name = JoinPath(e.Path[1:])
 		}
 
 		fieldType := op.FieldTypeString
-		if e.IsSecret() {
+		if e.IsOTP() {
+			fieldType = op.FieldTypeOTP
+		} else if e.IsSecret() {
 			fieldType = op.FieldTypeConcealed
 		}
 
-		if annotationType := e.TypeStr(); annotationType != "" {
+		annotationType := e.TypeStr()
+		if e.IsRef() {
+			annotationType = e.refAnnotationValue()
+		} else if e.IsFile() {
+			annotationType = e.fileAnnotationValue()
+		}
+
+		if annotationType != "" {
 			ret = append(ret, &op.ItemField{
 				ID:      "~annotations." + fullPath,
 				Section: annotationsSection,
@@ -383,6 +562,11 @@ func (e *Entry) ToOP() []*op.ItemField {
 			})
 		}
 
+		if e.IsFile() {
+			// stored as file attachments instead
+			return ret
+		}
+
 		ret = append(ret, &op.ItemField{
 			ID:      fullPath,
 			Section: section,
@@ -400,6 +584,17 @@ func (e *Entry) ToOP() []*op.ItemField {
 		return ret
 	}
 
+	if e.hasNumericKeys() {
+		fullPath := JoinPath(e.Path)
+		ret = append(ret, &op.ItemField{
+			ID:      "~annotations." + fullPath,
+			Section: annotationsSection,
+			Label:   fullPath,
+			Type:    op.FieldTypeString,
+			Value:   mapAnnotation,
+		})
+	}
+
 	for i := 0; i < len(e.Content); i += 2 {
 		child := e.Content[i+1]
 		if child.Type == YAMLTypeMetaConfig {
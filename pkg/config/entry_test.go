@@ -0,0 +1,181 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"testing"
+
+	"git.rob.mx/nidito/joao/internal/testdata"
+	"git.rob.mx/nidito/joao/pkg/config"
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
+	op "github.com/1Password/connect-sdk-go/onepassword"
+)
+
+func TestOPRoundTrip(t *testing.T) {
+	modes := []config.OutputMode{config.OutputModeNoComments, config.OutputModeSorted, config.OutputModeNoConfig, config.OutputModeStandardYAML}
+
+	// multi is left out, as top-level password keys clash with the item's own password field
+	for _, fixture := range []string{"test", "deeply-nested.test", "anchors", "lists"} {
+		t.Run(fixture, func(t *testing.T) {
+			file, err := config.LoadFile(testdata.YAML(fixture))
+			if err != nil {
+				t.Fatalf("could not load fixture: %s", err)
+			}
+
+			for _, cfg := range file.Documents {
+				expected, err := cfg.AsYAML(modes...)
+				if err != nil {
+					t.Fatalf("could not encode %s: %s", cfg.Name, err)
+				}
+
+				item, err := cfg.ToOP()
+				if err != nil {
+					t.Fatalf("could not convert %s to item: %s", cfg.Name, err)
+				}
+				item.Vault = op.ItemVault{ID: cfg.Vault}
+				remote, err := config.FromOP(item)
+				if err != nil {
+					t.Fatalf("could not read item %s: %s", cfg.Name, err)
+				}
+
+				got, err := remote.AsYAML(modes...)
+				if err != nil {
+					t.Fatalf("could not encode remote %s: %s", cfg.Name, err)
+				}
+
+				if string(got) != string(expected) {
+					t.Fatalf("%s did not round-trip.\nwanted:\n%s\ngot:\n%s", cfg.Name, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestOPRoundTripLabels(t *testing.T) {
+	cfg, err := config.Load(testdata.YAML("lists"), false)
+	if err != nil {
+		t.Fatalf("could not load fixture: %s", err)
+	}
+
+	item, err := cfg.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+
+	fields := map[string]*op.ItemField{}
+	for _, field := range item.Fields {
+		fields[field.ID] = field
+	}
+
+	for id, label := range map[string]string{
+		"servers.0.host":          "0.host",
+		"servers.1.tags.1":        "1.tags.1",
+		"matrix.1.1.0":            "1.1.0",
+		"users.0.keys.0.key":      "0.keys.0.key",
+		"~annotations.ports":      "ports",
+		"~annotations.matrix.0.1": "matrix.0.1",
+	} {
+		if field, ok := fields[id]; !ok || field.Label != label {
+			t.Fatalf("expected field %s labeled %s, got %+v", id, label, field)
+		}
+	}
+
+	if fields["~annotations.ports"].Value != "map" {
+		t.Fatalf("expected ports to be annotated as a map, got %+v", fields["~annotations.ports"])
+	}
+
+	if _, ok := fields["~annotations.servers"]; ok {
+		t.Fatal("sequences should not be annotated")
+	}
+}
+
+func TestOPRoundTripDottedKeys(t *testing.T) {
+	cfg, err := config.FromYAML([]byte(`_config: !!joao
+  vault: example
+  name: dotted
+example.com:
+  address: 10.0.0.1
+labels:
+  app.kubernetes.io/name: joao
+  nested:
+    back\slash: !!secret very secret
+`))
+	if err != nil {
+		t.Fatalf("could not parse config: %s", err)
+	}
+
+	item, err := cfg.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+	fields := map[string]*op.ItemField{}
+	for _, field := range item.Fields {
+		fields[field.ID] = field
+	}
+
+	for id, label := range map[string]string{
+		`example\.com.address`:                   "address",
+		`labels.app\.kubernetes\.io/name`:        `app\.kubernetes\.io/name`,
+		`labels.nested.back\\slash`:              `nested.back\\slash`,
+		`~annotations.labels.nested.back\\slash`: `labels.nested.back\\slash`,
+	} {
+		if field, ok := fields[id]; !ok || field.Label != label {
+			t.Fatalf("expected field %s labeled %s, got %+v", id, label, field)
+		}
+	}
+
+	remote, err := config.FromOP(item)
+	if err != nil {
+		t.Fatalf("could not read item: %s", err)
+	}
+
+	for _, path := range [][]string{{"example.com", "address"}, {"labels", "app.kubernetes.io/name"}, {"labels", "nested", `back\slash`}} {
+		local, found := cfg.Tree.Lookup(path), remote.Tree.Lookup(path)
+		if found == nil || found.Value != local.Value || found.IsSecret() != local.IsSecret() {
+			t.Fatalf("%q did not round-trip, got %+v", path, found)
+		}
+	}
+
+	if remote.Tree.Lookup([]string{"example"}) != nil {
+		t.Fatal("dotted keys should not be split into maps")
+	}
+}
+
+func TestOPLegacyLabels(t *testing.T) {
+	// flushed before keys were escaped within labels, lacking the ~labels annotation
+	section := &op.ItemSection{ID: "dir[1]", Label: "dir[1]"}
+	annotations := &op.ItemSection{ID: "~annotations", Label: "~annotations"}
+	fields := []*op.ItemField{
+		{ID: "dir[1].back\\slash", Section: section, Label: "back\\slash", Type: op.FieldTypeConcealed, Value: "very secret"},
+		{ID: "dir[1].nested.key", Section: section, Label: "nested.key", Type: op.FieldTypeString, Value: "42"},
+		{ID: "~annotations.dir[1].back\\slash", Section: annotations, Label: "dir[1].back\\slash", Type: op.FieldTypeString, Value: "secret"},
+		{ID: "~annotations.dir[1].nested.key", Section: annotations, Label: "dir[1].nested.key", Type: op.FieldTypeString, Value: "int"},
+	}
+	// sections were prefixed to labels as they were
+	legacyChecksum := opclient.Checksum([]*op.ItemField{
+		{Label: "dir[1].back\\slash", Value: "very secret"},
+		{Label: "dir[1].nested.key", Value: "42"},
+	})
+	item := &op.Item{
+		Title:  "legacy",
+		Vault:  op.ItemVault{ID: "example"},
+		Fields: append([]*op.ItemField{{ID: "password", Label: "password", Value: legacyChecksum}}, fields...),
+	}
+
+	cfg, err := config.FromOP(item)
+	if err != nil {
+		t.Fatalf("could not read item: %s", err)
+	}
+
+	if secret := cfg.Tree.Lookup([]string{"dir[1]", `back\slash`}); secret == nil || secret.Value != "very secret" || !secret.IsSecret() {
+		t.Fatalf("unexpected legacy secret %+v", secret)
+	}
+
+	if integer := cfg.Tree.Lookup([]string{"dir[1]", "nested", "key"}); integer == nil || integer.Value != "42" || integer.Type != "!!int" {
+		t.Fatalf("unexpected legacy integer %+v", integer)
+	}
+
+	if cs, ok := opclient.VerifyChecksum(item); !ok || cs == legacyChecksum {
+		t.Fatalf("expected the legacy checksum to verify, along with a different escaped one, got %s", cs)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"regexp"
+	"strings"
+)
+
+// EnvNaming turns the path of an entry into an environment variable name.
+type EnvNaming struct {
+	// Prefix is prepended to every name.
+	Prefix string
+	// Separator joins path segments, defaults to `_`.
+	Separator string
+	// Case is one of `upper` (the default), `lower` or `keep`.
+	Case string
+}
+
+var invalidEnvChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Name returns the environment variable name for path, i.e. `smtp.password` => `SMTP_PASSWORD`.
+func (naming *EnvNaming) Name(path []string) string {
+	separator := naming.Separator
+	if separator == "" {
+		separator = "_"
+	}
+
+	parts := make([]string, len(path))
+	for idx, part := range path {
+		parts[idx] = invalidEnvChars.ReplaceAllString(part, "_")
+	}
+
+	name := naming.Prefix + strings.Join(parts, separator)
+	switch naming.Case {
+	case "", "upper":
+		name = strings.ToUpper(name)
+	case "lower":
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// AsEnv flattens the scalars in e into environment variables named after their full paths.
+func (e *Entry) AsEnv(naming *EnvNaming) (map[string]string, error) {
+	_, leaves, err := e.flatten(naming.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{}
+	for name, leaf := range leaves {
+		env[name] = leaf.String()
+	}
+	return env, nil
+}
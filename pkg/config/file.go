@@ -0,0 +1,189 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// File is a config file, holding a config for every document in it, each stored at its own 1Password item.
+type File struct {
+	Path      string
+	Codec     *Codec
+	Documents []*Config
+}
+
+// LoadFile reads a config file from path, looking up the 1Password item of every document in it.
+func LoadFile(path string) (*File, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s", path)
+	}
+
+	file, err := ParseFile(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, file.ResolveItems()
+}
+
+// ParseFile decodes data as the contents of the config file at path, without looking up 1Password items.
+func ParseFile(path string, data []byte) (*File, error) {
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+
+	codec := CodecFor(path)
+	nodes, err := codec.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse file %s as %w", path, err)
+	}
+
+	docs, err := configsFrom(nodes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse file %s: %w", path, err)
+	}
+
+	return &File{Path: path, Codec: codec, Documents: docs}, nil
+}
+
+// ResolveItems sets the vault and name of every document from its `_config`, or the repo config, and errors if
+// two documents would be stored at the same item.
+func (f *File) ResolveItems() error {
+	seen := map[string]int{}
+	for idx, cfg := range f.Documents {
+		name, vault, err := vaultAndNameFor(f.Path, cfg.metaConfig())
+		if err != nil {
+			return err
+		}
+		logrus.Debugf("Found name: %s and vault: %s for document %d", name, vault, idx)
+		cfg.Name = name
+		cfg.Vault = vault
+		cfg.Tree.linkRefs(f.Path)
+
+		if previous, exists := seen[cfg.OPURL()]; exists {
+			return fmt.Errorf("documents %d and %d of %s would both be stored at %s, set a different _config.name for each", previous, idx, f.Path, cfg.OPURL())
+		}
+		seen[cfg.OPURL()] = idx
+	}
+	return nil
+}
+
+// metaConfig returns the vault and name embedded in `_config`, if any.
+func (cfg *Config) metaConfig() *opDetails {
+	meta := cfg.Tree.ChildNamed("_config")
+	if meta == nil {
+		return nil
+	}
+
+	details := &opDetails{}
+	if vault := meta.ChildNamed("vault"); vault != nil {
+		details.Vault = vault.Value
+	}
+	if name := meta.ChildNamed("name"); name != nil {
+		details.Name = name.Value
+	}
+	if schema := meta.ChildNamed("schema"); schema != nil {
+		details.Schema = schema.Value
+	}
+	if flush := meta.ChildNamed("flush"); flush != nil {
+		details.Flush = flush.Value
+	}
+	if maxAge := meta.ChildNamed("maxAge"); maxAge != nil {
+		details.MaxAge = maxAge.Value
+	}
+	if extends := meta.ChildNamed("extends"); extends != nil {
+		if extends.IsScalar() {
+			details.Extends = []string{extends.Value}
+		}
+		for _, base := range extends.Content {
+			details.Extends = append(details.Extends, base.Value)
+		}
+	}
+	return details
+}
+
+// Select returns the document at index or with item name (or VAULT/NAME) of document, or the only document in the
+// file if document is empty.
+func (f *File) Select(document string) (*Config, error) {
+	if document == "" {
+		if len(f.Documents) > 1 {
+			return nil, fmt.Errorf("%s holds %d documents, select one by index or item name", f.Path, len(f.Documents))
+		}
+		return f.Documents[0], nil
+	}
+
+	if idx, err := strconv.Atoi(document); err == nil {
+		if idx < 0 || idx >= len(f.Documents) {
+			return nil, fmt.Errorf("%s holds %d documents, no document at index %d", f.Path, len(f.Documents), idx)
+		}
+		return f.Documents[idx], nil
+	}
+
+	for _, cfg := range f.Documents {
+		if cfg.Name == document || cfg.Vault+"/"+cfg.Name == document {
+			return cfg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no document in %s is stored at %s", f.Path, document)
+}
+
+// Label names a document for humans, adding its item name if the file holds many.
+func (f *File) Label(cfg *Config) string {
+	if len(f.Documents) > 1 {
+		return fmt.Sprintf("%s#%s", f.Path, cfg.Name)
+	}
+	return f.Path
+}
+
+// Encode returns every document encoded with the file's codec.
+func (f *File) Encode(modes ...OutputMode) ([]byte, error) {
+	if len(f.Documents) > 1 && f.Codec != CodecYAML {
+		return nil, fmt.Errorf("only yaml files can hold multiple documents")
+	}
+
+	var out bytes.Buffer
+	for idx, cfg := range f.Documents {
+		if idx > 0 {
+			out.WriteString("---\n")
+		}
+
+		data, err := cfg.Encode(f.Codec, modes...)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+	}
+	return out.Bytes(), nil
+}
+
+// Save writes every document back to the file, keeping its permissions.
+func (f *File) Save(modes ...OutputMode) error {
+	data, err := f.Encode(modes...)
+	if err != nil {
+		return err
+	}
+
+	return writeConfigFile(f.Path, data)
+}
+
+func writeConfigFile(path string, data []byte) error {
+	var mode fs.FileMode = 0644
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return fmt.Errorf("could not save config to file %s: %w", path, err)
+	}
+
+	return nil
+}
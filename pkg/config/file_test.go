@@ -0,0 +1,95 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"git.rob.mx/nidito/joao/internal/testdata"
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+func TestFileDocuments(t *testing.T) {
+	file, err := config.LoadFile(testdata.YAML("multi"))
+	if err != nil {
+		t.Fatalf("could not load fixture: %s", err)
+	}
+
+	if len(file.Documents) != 2 {
+		t.Fatalf("expected 2 documents, got %d", len(file.Documents))
+	}
+
+	for idx, name := range []string{"multi:prod", "multi:staging"} {
+		cfg := file.Documents[idx]
+		if cfg.Vault != "example" || cfg.Name != name {
+			t.Fatalf("unexpected item for document %d: %s", idx, cfg.OPURL())
+		}
+	}
+
+	expected, err := os.ReadFile(testdata.YAML("multi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := file.Encode()
+	if err != nil {
+		t.Fatalf("could not encode: %s", err)
+	}
+	if string(got) != string(expected) {
+		t.Fatalf("documents did not round-trip.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+
+	redacted, err := file.Encode(config.OutputModeRedacted)
+	if err != nil {
+		t.Fatalf("could not encode: %s", err)
+	}
+	if strings.Contains(string(redacted), "prod secret") || strings.Contains(string(redacted), "staging secret") || strings.Count(string(redacted), "---\n") != 1 {
+		t.Fatalf("unexpected redacted output:\n%s", redacted)
+	}
+}
+
+func TestFileSelect(t *testing.T) {
+	file, err := config.LoadFile(testdata.YAML("multi"))
+	if err != nil {
+		t.Fatalf("could not load fixture: %s", err)
+	}
+
+	for _, selector := range []string{"1", "multi:staging", "example/multi:staging"} {
+		cfg, err := file.Select(selector)
+		if err != nil {
+			t.Fatalf("could not select %s: %s", selector, err)
+		}
+		if cfg.Name != "multi:staging" {
+			t.Fatalf("selected %s with %s", cfg.Name, selector)
+		}
+	}
+
+	for _, selector := range []string{"", "2", "multi:dev"} {
+		if _, err := file.Select(selector); err == nil {
+			t.Fatalf("expected an error selecting %q", selector)
+		}
+	}
+
+	if _, err := config.Load(testdata.YAML("multi"), false); err == nil {
+		t.Fatalf("expected an error loading a file with many documents without selecting one")
+	}
+}
+
+func TestFileDuplicateItems(t *testing.T) {
+	path := importFixture(t, "dupes.yaml", `_config: !!joao
+  name: dupe
+  vault: example
+a: 1
+---
+_config: !!joao
+  name: dupe
+  vault: example
+a: 2
+`)
+
+	if _, err := config.LoadFile(path); err == nil || !strings.Contains(err.Error(), "would both be stored at op://example/dupe") {
+		t.Fatalf("expected an error about duplicate items, got %v", err)
+	}
+}
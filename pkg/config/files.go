@@ -0,0 +1,115 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	opClient "git.rob.mx/nidito/joao/pkg/op-client"
+	op "github.com/1Password/connect-sdk-go/onepassword"
+	"gopkg.in/yaml.v3"
+)
+
+// IsFile tells if e holds the contents of a file, stored as a 1Password file attachment: text tagged `!!file`, or
+// base64-encoded data tagged `!!binary`.
+func (e *Entry) IsFile() bool {
+	return e.Tag == YAMLTypeFile || e.Tag == YAMLTypeBinary
+}
+
+// FileContent returns the contents of the file held by e, decoding `!!binary` values.
+func (e *Entry) FileContent() ([]byte, error) {
+	if e.Tag != YAMLTypeBinary {
+		return []byte(e.Value), nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(e.Value), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid binary value at %s: %w", strings.Join(e.Path, "."), err)
+	}
+	return data, nil
+}
+
+// fileAnnotationValue annotates files with their kind and a checksum of their contents, so changes to them are
+// flushed.
+func (e *Entry) fileAnnotationValue() string {
+	content, err := e.FileContent()
+	if err != nil {
+		content = []byte(e.Value)
+	}
+	return fmt.Sprintf("%s:%x", e.TypeStr(), sha256.Sum256(content))
+}
+
+// parseFileAnnotation returns the tag of files, given their annotation.
+func parseFileAnnotation(annotation string) (tag string, isFile bool) {
+	kind, _, _ := strings.Cut(annotation, ":")
+	switch kind {
+	case "file":
+		return YAMLTypeFile, true
+	case "binary":
+		return YAMLTypeBinary, true
+	}
+	return "", false
+}
+
+// opFiles returns the files held below e as 1Password file attachments, named by their dot-delimited path.
+func (e *Entry) opFiles() ([]*op.File, error) {
+	if e.IsFile() {
+		content, err := e.FileContent()
+		if err != nil {
+			return nil, err
+		}
+
+		file := &op.File{Name: JoinPath(e.Path), Size: len(content)}
+		file.SetContent(content)
+		return []*op.File{file}, nil
+	}
+
+	files := []*op.File{}
+	for idx, child := range e.Content {
+		if (e.Kind == yaml.MappingNode || e.Kind == yaml.DocumentNode) && (idx%2 == 0 || child.Type == YAMLTypeMetaConfig) {
+			continue
+		}
+
+		found, err := child.opFiles()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// fileFields downloads the files attached to item as fields, to be read along the rest of them. Binary files are
+// base64-encoded.
+func fileFields(item *op.Item) ([]*op.ItemField, error) {
+	kinds := map[string]string{}
+	for _, field := range item.Fields {
+		if field.Section != nil && field.Section.ID == annotationsSection.ID {
+			kinds[field.Label] = field.Value
+		}
+	}
+
+	fields := []*op.ItemField{}
+	for _, file := range item.Files {
+		tag, isFile := parseFileAnnotation(kinds[file.Name])
+		if !isFile {
+			// attached by hand, not by joao
+			continue
+		}
+
+		content, err := opClient.FileContent(item.Vault.ID, item, file)
+		if err != nil {
+			return nil, fmt.Errorf("could not download %s from %s/%s: %w", file.Name, item.Vault.ID, item.Title, err)
+		}
+
+		value := string(content)
+		if tag == YAMLTypeBinary {
+			value = base64.StdEncoding.EncodeToString(content)
+		}
+		fields = append(fields, &op.ItemField{ID: file.Name, Label: file.Name, Type: op.FieldTypeString, Value: value})
+	}
+	return fields, nil
+}
@@ -0,0 +1,378 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatOptions changes how entries are formatted.
+type FormatOptions struct {
+	// Redacted outputs empty secret values.
+	Redacted bool
+	// Naming changes how nested keys are flattened by formats that don't support nesting. Empty fields take the
+	// format's defaults.
+	Naming EnvNaming
+}
+
+// Formatter renders an entry and everything below it.
+type Formatter func(entry *Entry, opts *FormatOptions) ([]byte, error)
+
+var formats = map[string]Formatter{
+	"dotenv":     formatDotenv,
+	"shell":      formatShell,
+	"properties": formatProperties,
+	"toml":       formatTOML,
+	"hcl":        formatHCL,
+	"tfvars":     formatHCL,
+}
+
+// RegisterFormat makes a formatter available by name.
+func RegisterFormat(name string, formatter Formatter) {
+	formats[name] = formatter
+}
+
+// Formats lists the names of the registered formats.
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Format renders entry with the formatter registered as name.
+func Format(name string, entry *Entry, opts *FormatOptions) ([]byte, error) {
+	formatter, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %s", name)
+	}
+
+	if opts == nil {
+		opts = &FormatOptions{}
+	}
+
+	if opts.Redacted {
+		defer setOutputMode([]OutputMode{OutputModeRedacted})()
+	}
+
+	return formatter(entry, opts)
+}
+
+// As renders the config with the formatter registered as name.
+func (cfg *Config) As(name string, opts *FormatOptions) ([]byte, error) {
+	return Format(name, cfg.Tree, opts)
+}
+
+// children returns the values of a map, or the items of a sequence, skipping joao's own config.
+func (e *Entry) children() []*Entry {
+	if e.Kind != yaml.MappingNode && e.Kind != yaml.DocumentNode {
+		return e.Content
+	}
+
+	children := []*Entry{}
+	for idx := 1; idx < len(e.Content); idx += 2 {
+		if child := e.Content[idx]; child.Type != YAMLTypeMetaConfig {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// walkScalars calls visit for every scalar at or below e, in order.
+func (e *Entry) walkScalars(visit func(leaf *Entry) error) error {
+	if e.Type == YAMLTypeMetaConfig {
+		return nil
+	}
+
+	if e.IsScalar() {
+		return visit(e)
+	}
+
+	for _, child := range e.children() {
+		if err := child.walkScalars(visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLiteral tells if a scalar can be output unquoted, as it's not a string.
+func (e *Entry) isLiteral() bool {
+	switch e.TypeStr() {
+	case "int", "bool", "float":
+		return true
+	}
+	return false
+}
+
+// flatten returns leaves of e keyed by naming, and in the order they're found.
+func (e *Entry) flatten(name func(path []string) string) ([]string, map[string]*Entry, error) {
+	keys := []string{}
+	leaves := map[string]*Entry{}
+	err := e.walkScalars(func(leaf *Entry) error {
+		if len(leaf.Path) == 0 {
+			return fmt.Errorf("cannot name a value without a key")
+		}
+
+		key := name(leaf.Path)
+		if previous, exists := leaves[key]; exists {
+			return fmt.Errorf("both %s and %s would be named %s", strings.Join(previous.Path, "."), strings.Join(leaf.Path, "."), key)
+		}
+		keys = append(keys, key)
+		leaves[key] = leaf
+		return nil
+	})
+	return keys, leaves, err
+}
+
+var envIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// flattenEnv flattens e into environment variable names, erroring out on names format can't declare, i.e. those
+// built with a custom separator or prefix.
+func (e *Entry) flattenEnv(format string, naming *EnvNaming) ([]string, map[string]*Entry, error) {
+	keys, leaves, err := e.flatten(naming.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, key := range keys {
+		if !envIdentifier.MatchString(key) {
+			return nil, nil, fmt.Errorf("%s is not a valid %s variable name for %s", key, format, strings.Join(leaves[key].Path, "."))
+		}
+	}
+	return keys, leaves, nil
+}
+
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`)
+
+func formatDotenv(entry *Entry, opts *FormatOptions) ([]byte, error) {
+	keys, leaves, err := entry.flattenEnv("dotenv", &opts.Naming)
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.Buffer{}
+	for _, key := range keys {
+		leaf := leaves[key]
+		value := leaf.String()
+		if !leaf.isLiteral() {
+			value = `"` + dotenvEscaper.Replace(value) + `"`
+		}
+		fmt.Fprintf(&out, "%s=%s\n", key, value)
+	}
+	return out.Bytes(), nil
+}
+
+func formatShell(entry *Entry, opts *FormatOptions) ([]byte, error) {
+	keys, leaves, err := entry.flattenEnv("shell", &opts.Naming)
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.Buffer{}
+	for _, key := range keys {
+		leaf := leaves[key]
+		value := leaf.String()
+		if !leaf.isLiteral() {
+			// single quotes keep everything as-is, except single quotes themselves
+			value = "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+		}
+		fmt.Fprintf(&out, "export %s=%s\n", key, value)
+	}
+	return out.Bytes(), nil
+}
+
+// propertiesEscape escapes s as a java properties key or value.
+func propertiesEscape(s string, isKey bool) string {
+	out := strings.Builder{}
+	for idx, r := range s {
+		switch {
+		case r == '\\':
+			out.WriteString(`\\`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r == '\f':
+			out.WriteString(`\f`)
+		case r == '=' || r == ':' || ((r == '#' || r == '!') && (isKey || idx == 0)):
+			out.WriteRune('\\')
+			out.WriteRune(r)
+		case r == ' ' && (isKey || idx == 0):
+			out.WriteString(`\ `)
+		case r < 0x20 || r > 0x7e:
+			if r > 0xffff {
+				// properties are latin-1, so anything else is escaped as utf-16
+				for _, surrogate := range utf16Surrogates(r) {
+					fmt.Fprintf(&out, `\u%04x`, surrogate)
+				}
+				continue
+			}
+			fmt.Fprintf(&out, `\u%04x`, r)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+func utf16Surrogates(r rune) []rune {
+	r -= 0x10000
+	return []rune{0xd800 + (r>>10)&0x3ff, 0xdc00 + r&0x3ff}
+}
+
+func formatProperties(entry *Entry, opts *FormatOptions) ([]byte, error) {
+	separator := opts.Naming.Separator
+	if separator == "" {
+		separator = "."
+	}
+
+	keys, leaves, err := entry.flatten(func(path []string) string {
+		name := opts.Naming.Prefix + strings.Join(path, separator)
+		switch opts.Naming.Case {
+		case "upper":
+			name = strings.ToUpper(name)
+		case "lower":
+			name = strings.ToLower(name)
+		}
+		return name
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.Buffer{}
+	for _, key := range keys {
+		fmt.Fprintf(&out, "%s=%s\n", propertiesEscape(key, true), propertiesEscape(leaves[key].String(), false))
+	}
+	return out.Bytes(), nil
+}
+
+// treeMap returns the values at or below e, without joao's own config.
+func (e *Entry) treeMap() (map[string]any, error) {
+	if e.Kind != yaml.MappingNode && e.Kind != yaml.DocumentNode {
+		return nil, fmt.Errorf("only maps can be formatted as a document, found a %s", e.Type)
+	}
+
+	tree := map[string]any{}
+	for _, child := range e.children() {
+		tree[child.Name()] = child.AsMap()
+	}
+	return tree, nil
+}
+
+func formatTOML(entry *Entry, opts *FormatOptions) ([]byte, error) {
+	tree, err := entry.treeMap()
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.Buffer{}
+	if err := toml.NewEncoder(&out).Encode(tree); err != nil {
+		return nil, fmt.Errorf("could not serialize as toml: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+var hclIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+var hclEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", "$${", "%{", "%%{")
+
+func hclString(s string) string {
+	return `"` + hclEscaper.Replace(s) + `"`
+}
+
+func hclKey(key string) string {
+	if hclIdentifier.MatchString(key) {
+		return key
+	}
+	return hclString(key)
+}
+
+// hclLiteral returns the HCL spelling of a yaml int, float or bool, since yaml allows spellings like `0x1F`, `1_000`
+// or `.inf` that HCL doesn't. Values HCL can't spell are returned quoted.
+func hclLiteral(entry *Entry) string {
+	value := entry.String()
+	switch entry.TypeStr() {
+	case "int":
+		if i, err := strconv.ParseInt(value, 0, 64); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+		if u, err := strconv.ParseUint(value, 0, 64); err == nil {
+			return strconv.FormatUint(u, 10)
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(strings.ReplaceAll(value, "_", ""), 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	case "bool":
+		if b, err := strconv.ParseBool(strings.ToLower(value)); err == nil {
+			return strconv.FormatBool(b)
+		}
+	}
+	return hclString(value)
+}
+
+func writeHCL(out *bytes.Buffer, entry *Entry, indent string) {
+	switch {
+	case entry.IsScalar():
+		if entry.isLiteral() {
+			out.WriteString(hclLiteral(entry))
+		} else if entry.Type == "!!null" {
+			out.WriteString("null")
+		} else {
+			out.WriteString(hclString(entry.String()))
+		}
+	case entry.Kind == yaml.SequenceNode:
+		if len(entry.Content) == 0 {
+			out.WriteString("[]")
+			return
+		}
+		out.WriteString("[\n")
+		for _, child := range entry.Content {
+			out.WriteString(indent + "  ")
+			writeHCL(out, child, indent+"  ")
+			out.WriteString(",\n")
+		}
+		out.WriteString(indent + "]")
+	default:
+		children := entry.children()
+		if len(children) == 0 {
+			out.WriteString("{}")
+			return
+		}
+		out.WriteString("{\n")
+		for _, child := range children {
+			out.WriteString(indent + "  " + hclKey(child.Name()) + " = ")
+			writeHCL(out, child, indent+"  ")
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "}")
+	}
+}
+
+func formatHCL(entry *Entry, opts *FormatOptions) ([]byte, error) {
+	if entry.Kind != yaml.MappingNode && entry.Kind != yaml.DocumentNode {
+		return nil, fmt.Errorf("only maps can be formatted as a document, found a %s", entry.Type)
+	}
+
+	out := bytes.Buffer{}
+	for _, child := range entry.children() {
+		out.WriteString(hclKey(child.Name()) + " = ")
+		writeHCL(&out, child, "")
+		out.WriteString("\n")
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,191 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"testing"
+
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+const formatsYAML = `
+_config: !!joao
+  vault: example
+  name: test
+string: "it's \"quoted\" $HOME"
+int: 1
+float: 3.14
+bool: true
+secret: !!secret --secret--
+multiline: |
+  one
+  two
+list:
+  - zero
+  - one
+map:
+  key: value
+  with space: =value
+  nested:
+    deep: ${var}
+`
+
+func TestFormats(t *testing.T) {
+	cfg, err := config.FromYAML([]byte(formatsYAML))
+	if err != nil {
+		t.Fatalf("Could not initialize test config: %s", err)
+	}
+
+	cases := []struct {
+		format   string
+		opts     *config.FormatOptions
+		expected string
+	}{
+		{
+			format: "dotenv",
+			expected: `STRING="it's \"quoted\" \$HOME"
+INT=1
+FLOAT=3.14
+BOOL=true
+SECRET="--secret--"
+MULTILINE="one\ntwo\n"
+LIST_0="zero"
+LIST_1="one"
+MAP_KEY="value"
+MAP_WITH_SPACE="=value"
+MAP_NESTED_DEEP="\${var}"
+`,
+		},
+		{
+			format: "shell",
+			opts:   &config.FormatOptions{Redacted: true, Naming: config.EnvNaming{Prefix: "app_", Case: "lower"}},
+			expected: `export app_string='it'\''s "quoted" $HOME'
+export app_int=1
+export app_float=3.14
+export app_bool=true
+export app_secret=''
+export app_multiline='one
+two
+'
+export app_list_0='zero'
+export app_list_1='one'
+export app_map_key='value'
+export app_map_with_space='=value'
+export app_map_nested_deep='${var}'
+`,
+		},
+		{
+			format: "properties",
+			expected: `string=it's "quoted" $HOME
+int=1
+float=3.14
+bool=true
+secret=--secret--
+multiline=one\ntwo\n
+list.0=zero
+list.1=one
+map.key=value
+map.with\ space=\=value
+map.nested.deep=${var}
+`,
+		},
+		{
+			format: "toml",
+			expected: `bool = true
+float = 3.14
+int = 1
+list = ["zero", "one"]
+multiline = "one\ntwo\n"
+secret = "--secret--"
+string = "it's \"quoted\" $HOME"
+
+[map]
+  key = "value"
+  "with space" = "=value"
+  [map.nested]
+    deep = "${var}"
+`,
+		},
+		{
+			format: "tfvars",
+			opts:   &config.FormatOptions{Redacted: true},
+			expected: `string = "it's \"quoted\" $HOME"
+int = 1
+float = 3.14
+bool = true
+secret = ""
+multiline = "one\ntwo\n"
+list = [
+  "zero",
+  "one",
+]
+map = {
+  key = "value"
+  "with space" = "=value"
+  nested = {
+    deep = "$${var}"
+  }
+}
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.format, func(t *testing.T) {
+			got, err := cfg.As(c.format, c.opts)
+			if err != nil {
+				t.Fatalf("could not format: %s", err)
+			}
+
+			if string(got) != c.expected {
+				t.Fatalf("unexpected output.\nwanted:\n%s\n---\ngot:\n%s", c.expected, got)
+			}
+		})
+	}
+
+	if _, err := cfg.As("unknown", nil); err == nil {
+		t.Fatalf("did not fail on an unknown format")
+	}
+}
+
+func TestFormatsHCLLiterals(t *testing.T) {
+	cfg, err := config.FromYAML([]byte("hex: 0x1F\noctal: 0o17\nunderscored: 1_000\nexp: 1e3\ninf: .inf\nyes: True\n"))
+	if err != nil {
+		t.Fatalf("Could not initialize test config: %s", err)
+	}
+
+	got, err := cfg.As("hcl", nil)
+	if err != nil {
+		t.Fatalf("could not format: %s", err)
+	}
+
+	expected := `hex = 31
+octal = 15
+underscored = 1000
+exp = 1000
+inf = ".inf"
+yes = true
+`
+	if string(got) != expected {
+		t.Fatalf("unexpected output.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
+
+func TestFormatsEnvNames(t *testing.T) {
+	cfg, err := config.FromYAML([]byte("smtp:\n  password: secret\nlist:\n  - one\n"))
+	if err != nil {
+		t.Fatalf("Could not initialize test config: %s", err)
+	}
+
+	for _, format := range []string{"dotenv", "shell"} {
+		for _, naming := range []config.EnvNaming{
+			{Separator: "."},
+			{Separator: "-"},
+			{Prefix: "1"},
+		} {
+			if got, err := cfg.As(format, &config.FormatOptions{Naming: naming}); err == nil {
+				t.Fatalf("%s did not fail with naming %+v, got:\n%s", format, naming, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,460 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// charsets are the named character sets passwords can be generated from.
+var charsets = map[string]string{
+	"alphanumeric": "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+	"alpha":        "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"lower":        "abcdefghijklmnopqrstuvwxyz",
+	"upper":        "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"numeric":      "0123456789",
+	"symbols":      "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&()*+,-./:;<=>?@[]^_{|}~",
+}
+
+// Generator describes a value to generate, either from `set --generate=kind,key=value` or a `!!generate` map.
+type Generator struct {
+	// Kind is one of password, hex, base64, base64url, uuid, ed25519, rsa or certificate.
+	Kind string `yaml:"kind"`
+	// Length is the number of characters of passwords, or the number of random bytes of tokens.
+	Length int `yaml:"length,omitempty"`
+	// Charset names a character set for passwords, or lists the characters to use.
+	Charset string `yaml:"charset,omitempty"`
+	// Version is 4 or 7, for uuids.
+	Version int `yaml:"version,omitempty"`
+	// Bits is the size of rsa keys.
+	Bits int `yaml:"bits,omitempty"`
+	// Format is either pem or openssh, for keypairs.
+	Format string `yaml:"format,omitempty"`
+	// CommonName is the subject of certificates.
+	CommonName string `yaml:"common-name,omitempty"`
+	// Hosts are the DNS names and IP addresses certificates are valid for.
+	Hosts []string `yaml:"hosts,omitempty"`
+	// Days certificates are valid for.
+	Days int `yaml:"days,omitempty"`
+}
+
+// GeneratedValue is a value produced by a generator, stored at Key below the generated entry, if set.
+type GeneratedValue struct {
+	Key    string
+	Value  string
+	Secret bool
+}
+
+// ParseGenerator reads a generator from `kind,key=value,...`, i.e. `password,length=32,charset=alphanumeric`.
+// Commas within values are escaped as `\,`, i.e. `password,charset=abc\,.` generates passwords out of `abc,.`.
+func ParseGenerator(spec string) (*Generator, error) {
+	parts := splitSpec(spec)
+	gen := &Generator{Kind: strings.TrimSpace(parts[0])}
+	for _, part := range parts[1:] {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid generator option %s, expected key=value", part)
+		}
+
+		var err error
+		switch strings.TrimSpace(key) {
+		case "length":
+			gen.Length, err = positiveInt(value)
+		case "charset":
+			gen.Charset = value
+		case "version":
+			gen.Version, err = strconv.Atoi(value)
+		case "bits":
+			gen.Bits, err = positiveInt(value)
+		case "format":
+			gen.Format = value
+		case "common-name":
+			gen.CommonName = value
+		case "hosts", "host":
+			gen.Hosts = append(gen.Hosts, value)
+		case "days":
+			gen.Days, err = positiveInt(value)
+		default:
+			return nil, fmt.Errorf("unknown generator option %s", key)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for generator option %s: %w", key, err)
+		}
+	}
+
+	return gen, nil
+}
+
+// splitSpec splits a generator spec at commas, except those escaped as `\,`. A double backslash stands for one.
+func splitSpec(spec string) []string {
+	parts := []string{}
+	part := strings.Builder{}
+	for idx := 0; idx < len(spec); idx++ {
+		switch char := spec[idx]; {
+		case char == '\\' && idx+1 < len(spec) && (spec[idx+1] == ',' || spec[idx+1] == '\\'):
+			idx++
+			part.WriteByte(spec[idx])
+		case char == ',':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(char)
+		}
+	}
+
+	return append(parts, part.String())
+}
+
+func positiveInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if n <= 0 {
+		return 0, fmt.Errorf("expected a number greater than zero, got %d", n)
+	}
+	return n, nil
+}
+
+// generatorFrom reads the generator declared by a `!!generate` entry, either as a map or a scalar spec.
+func generatorFrom(e *Entry) (*Generator, error) {
+	if e.IsScalar() {
+		return ParseGenerator(e.Value)
+	}
+
+	node, err := e.MarshalYAML()
+	if err != nil {
+		return nil, err
+	}
+
+	gen := &Generator{}
+	node.Tag = "!!map"
+	if err := node.Decode(gen); err != nil {
+		return nil, fmt.Errorf("invalid generator at %s: %w", strings.Join(e.Path, "."), err)
+	}
+	return gen, nil
+}
+
+// Generate produces the values for g.
+func (g *Generator) Generate() ([]GeneratedValue, error) {
+	// zero values mean defaults, as generators declared as maps omit them
+	for option, value := range map[string]int{"length": g.Length, "bits": g.Bits, "days": g.Days} {
+		if value < 0 {
+			return nil, fmt.Errorf("invalid value for generator option %s: expected a number greater than zero, got %d", option, value)
+		}
+	}
+
+	switch g.Kind {
+	case "password":
+		value, err := g.password()
+		return []GeneratedValue{{Value: value, Secret: true}}, err
+	case "hex", "base64", "base64url":
+		value, err := g.token()
+		return []GeneratedValue{{Value: value, Secret: true}}, err
+	case "uuid", "uuidv4", "uuidv7":
+		value, err := g.uuid()
+		// uuids are identifiers more often than not, but are generated as secrets to be safe
+		return []GeneratedValue{{Value: value, Secret: true}}, err
+	case "ed25519", "rsa":
+		return g.keypair()
+	case "certificate":
+		return g.certificate()
+	}
+
+	return nil, fmt.Errorf("unknown generator %s, use one of password, hex, base64, base64url, uuid, ed25519, rsa or certificate", g.Kind)
+}
+
+func randomInt(max int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, err
+	}
+	return int(n.Int64()), nil
+}
+
+func (g *Generator) password() (string, error) {
+	length := g.Length
+	if length == 0 {
+		length = 32
+	}
+
+	charset := charsets["alphanumeric"]
+	if g.Charset != "" {
+		charset = g.Charset
+		if named, ok := charsets[g.Charset]; ok {
+			charset = named
+		}
+	}
+
+	chars := []rune(charset)
+	password := make([]rune, length)
+	for idx := range password {
+		n, err := randomInt(len(chars))
+		if err != nil {
+			return "", err
+		}
+		password[idx] = chars[n]
+	}
+	return string(password), nil
+}
+
+func (g *Generator) token() (string, error) {
+	length := g.Length
+	if length == 0 {
+		length = 32
+	}
+
+	data := make([]byte, length)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	switch g.Kind {
+	case "hex":
+		return hex.EncodeToString(data), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(data), nil
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (g *Generator) uuid() (string, error) {
+	version := g.Version
+	switch {
+	case g.Kind == "uuidv7":
+		version = 7
+	case version == 0:
+		version = 4
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	switch version {
+	case 4:
+	case 7:
+		// the first 48 bits hold the unix timestamp in milliseconds
+		ts := make([]byte, 8)
+		binary.BigEndian.PutUint64(ts, uint64(time.Now().UnixMilli()))
+		copy(id[0:6], ts[2:8])
+	default:
+		return "", fmt.Errorf("unsupported uuid version %d, use 4 or 7", version)
+	}
+
+	id[6] = (id[6] & 0x0f) | byte(version<<4)
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16]), nil
+}
+
+func (g *Generator) keypair() ([]GeneratedValue, error) {
+	var private crypto.Signer
+	switch g.Kind {
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case "rsa":
+		bits := g.Bits
+		if bits == 0 {
+			bits = 4096
+		}
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	}
+
+	var privatePEM, public []byte
+	switch g.Format {
+	case "", "pem":
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			return nil, err
+		}
+		privatePEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+		der, err = x509.MarshalPKIXPublicKey(private.Public())
+		if err != nil {
+			return nil, err
+		}
+		public = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	case "openssh":
+		block, err := ssh.MarshalPrivateKey(private, "")
+		if err != nil {
+			return nil, err
+		}
+		privatePEM = pem.EncodeToMemory(block)
+
+		key, err := ssh.NewPublicKey(private.Public())
+		if err != nil {
+			return nil, err
+		}
+		public = ssh.MarshalAuthorizedKey(key)
+	default:
+		return nil, fmt.Errorf("unsupported keypair format %s, use pem or openssh", g.Format)
+	}
+
+	return []GeneratedValue{
+		{Key: "private", Value: string(privatePEM), Secret: true},
+		{Key: "public", Value: string(public)},
+	}, nil
+}
+
+func (g *Generator) certificate() ([]GeneratedValue, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	days := g.Days
+	if days == 0 {
+		days = 365
+	}
+
+	commonName := g.CommonName
+	if commonName == "" && len(g.Hosts) > 0 {
+		commonName = g.Hosts[0]
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now,
+		NotAfter:              now.AddDate(0, 0, days),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range g.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("could not create certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return []GeneratedValue{
+		{Key: "cert", Value: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))},
+		{Key: "key", Value: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})), Secret: true},
+	}, nil
+}
+
+// generatedEntry turns a generated value into an entry, multi-line values as literal blocks.
+func generatedEntry(value GeneratedValue) *Entry {
+	entry := NewEntry(value.Key, yaml.ScalarNode)
+	entry.Value = strings.TrimSuffix(value.Value, "\n")
+	entry.Type = "!!str"
+	if value.Secret {
+		entry.Tag = YAMLTypeSecret
+		entry.Type = YAMLTypeSecret
+	}
+	if strings.Contains(entry.Value, "\n") {
+		entry.Style = yaml.LiteralStyle
+	}
+	return entry
+}
+
+// materialize replaces every `!!generate` entry below e with the values it declares, calling generated with the
+// path and generator of each. Once materialized, values are regular secrets, and are never generated again.
+func (e *Entry) materialize(generated func(path string, gen *Generator) error) error {
+	if e.Tag != YAMLTypeGenerate {
+		for _, child := range e.Content {
+			if err := child.materialize(generated); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	gen, err := generatorFrom(e)
+	if err != nil {
+		return err
+	}
+
+	values, err := gen.Generate()
+	if err != nil {
+		return fmt.Errorf("could not generate %s: %w", strings.Join(e.Path, "."), err)
+	}
+
+	if len(values) == 1 && values[0].Key == "" {
+		generated := generatedEntry(values[0])
+		e.Kind = generated.Kind
+		e.Value = generated.Value
+		e.Tag = generated.Tag
+		e.Type = generated.Type
+		e.Style = generated.Style
+		e.Content = []*Entry{}
+	} else {
+		e.Kind = yaml.MappingNode
+		e.Value = ""
+		e.Tag = "!!map"
+		e.Type = "!!map"
+		e.Style = 0
+		e.Content = []*Entry{}
+		for _, value := range values {
+			key := NewEntry(value.Key, yaml.ScalarNode)
+			key.Value = value.Key
+			e.Content = append(e.Content, key, generatedEntry(value))
+		}
+	}
+
+	if len(e.Path) > 0 {
+		e.SetPath(e.Path[0:len(e.Path)-1], e.Path[len(e.Path)-1])
+	}
+	return generated(JoinPath(e.Path), gen)
+}
+
+// Materialize generates the values of every `!!generate` entry in cfg, returning their paths. Generators are kept
+// in `_config.secrets`, so secrets can be rotated later.
+func (cfg *Config) Materialize() ([]string, error) {
+	paths := []string{}
+	err := cfg.Tree.materialize(func(path string, gen *Generator) error {
+		paths = append(paths, path)
+		return cfg.recordGenerator(path, gen)
+	})
+	return paths, err
+}
@@ -0,0 +1,413 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// ImportOptions changes how files in other formats are imported.
+type ImportOptions struct {
+	// Format is one of dotenv, json, toml or yaml, detected from the file's extension if empty.
+	Format string
+	// DetectSecrets marks values as secret with DefaultSecretRules.
+	DetectSecrets bool
+	// SecretRules are matched against the dot-delimited path of every value, marking matches as secret.
+	SecretRules []*regexp.Regexp
+	// Vault and Name are written to the `_config` of the imported config, when set.
+	Vault string
+	Name  string
+}
+
+// DefaultSecretKeys matches the names of keys usually holding secrets.
+var DefaultSecretKeys = regexp.MustCompile(`(?i)(passw(or)?d|pwd|passphrase|secret|token|api[-_]?key|access[-_]?key|private[-_]?key|signing[-_]?key|encryption[-_]?key|credentials?$|salt|dsn|cookie)`)
+
+// DefaultSecretValues matches values that look like secrets, no matter their key.
+var DefaultSecretValues = []*regexp.Regexp{
+	// private keys
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	// urls with credentials
+	regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]+:[^@\s]+@`),
+	// well known token formats: github, slack, stripe, aws
+	regexp.MustCompile(`^(gh[pousr]_[A-Za-z0-9]{36,}|xox[abpr]-[A-Za-z0-9-]+|[sr]k_live_[A-Za-z0-9]+|AKIA[0-9A-Z]{16})$`),
+}
+
+// SOPSPath points to the sops binary.
+var SOPSPath = "sops"
+
+// SOPSDecrypt decrypts a sops-encrypted file at path with format, using whatever keys are available to sops,
+// like an age key at `SOPS_AGE_KEY_FILE`.
+var SOPSDecrypt = func(path, format string) ([]byte, error) {
+	cmd := exec.Command(SOPSPath, "--decrypt", "--input-type", format, "--output-type", format, path) // nolint: gosec
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("sops exited with %s:\n%s", err, stderr.Bytes())
+	}
+	return stdout.Bytes(), nil
+}
+
+// ImportFormat detects the format of a file from its name.
+func ImportFormat(path string) (string, error) {
+	base := filepath.Base(path)
+	switch ext := filepath.Ext(base); {
+	case ext == ".env" || strings.HasPrefix(base, ".env") || ext == ".dotenv":
+		return "dotenv", nil
+	case ext == ".json":
+		return "json", nil
+	case ext == ".toml":
+		return "toml", nil
+	case ext == ".yaml" || ext == ".yml":
+		return "yaml", nil
+	}
+	return "", fmt.Errorf("could not detect the format of %s, specify one", path)
+}
+
+// Import reads a dotenv, json, toml or yaml file, decrypting it first if encrypted with sops, and returns it as a
+// config with secrets marked as such.
+func Import(path string, opts *ImportOptions) (*Config, error) {
+	format := opts.Format
+	if format == "" {
+		var err error
+		if format, err = ImportFormat(path); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s: %w", path, err)
+	}
+
+	root, err := importNode(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s as %s: %w", path, format, err)
+	}
+
+	// values sops encrypted are secret, regardless of any other rule
+	encrypted := map[string]bool{}
+	if sopsMetadata(root) != nil {
+		logrus.Infof("Decrypting %s with sops", path)
+		walkScalarNodes(root, nil, func(path []string, node *yaml.Node) {
+			if strings.HasPrefix(node.Value, "ENC[") {
+				encrypted[strings.Join(path, ".")] = true
+			}
+		})
+
+		if data, err = SOPSDecrypt(path, format); err != nil {
+			return nil, fmt.Errorf("could not decrypt %s: %w", path, err)
+		}
+
+		if root, err = importNode(data, format); err != nil {
+			return nil, fmt.Errorf("could not parse decrypted %s as %s: %w", path, format, err)
+		}
+
+		if idx := sopsMetadata(root); idx != nil {
+			root.Content = append(root.Content[0:*idx], root.Content[*idx+2:]...)
+		}
+	}
+
+	walkScalarNodes(root, nil, func(path []string, node *yaml.Node) {
+		if encrypted[strings.Join(path, ".")] || opts.isSecret(path, node.Value) {
+			node.Tag = YAMLTypeSecret
+		}
+	})
+
+	if opts.Vault != "" || opts.Name != "" {
+		meta := &yaml.Node{Kind: yaml.MappingNode, Tag: YAMLTypeMetaConfig}
+		for _, kv := range [][]string{{"vault", opts.Vault}, {"name", opts.Name}} {
+			if kv[1] != "" {
+				meta.Content = append(meta.Content, scalarNode(kv[0], "!!str"), scalarNode(kv[1], "!!str"))
+			}
+		}
+		root.Content = append([]*yaml.Node{scalarNode("_config", "!!str"), meta}, root.Content...)
+	}
+
+	out, err := yaml.Marshal(root)
+	if err != nil {
+		return nil, fmt.Errorf("could not serialize %s: %w", path, err)
+	}
+
+	cfg, err := FromYAML(out)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Vault = opts.Vault
+	cfg.Name = opts.Name
+	return cfg, nil
+}
+
+func (opts *ImportOptions) isSecret(path []string, value string) bool {
+	dotted := strings.Join(path, ".")
+	for _, rule := range opts.SecretRules {
+		if rule.MatchString(dotted) {
+			return true
+		}
+	}
+
+	if !opts.DetectSecrets {
+		return false
+	}
+
+	if DefaultSecretKeys.MatchString(path[len(path)-1]) {
+		return true
+	}
+
+	for _, rule := range DefaultSecretValues {
+		if rule.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// sopsMetadata returns the index of the key holding sops' metadata in root, if any.
+func sopsMetadata(root *yaml.Node) *int {
+	for idx := 0; idx < len(root.Content); idx += 2 {
+		key := root.Content[idx].Value
+		if key == "sops" && root.Content[idx+1].Kind == yaml.MappingNode {
+			return &idx
+		}
+		// sops stores its metadata in dotenv files as sops_* keys
+		if key == "sops_mac" {
+			return &idx
+		}
+	}
+	return nil
+}
+
+func walkScalarNodes(node *yaml.Node, path []string, visit func(path []string, node *yaml.Node)) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		visit(path, node)
+	case yaml.SequenceNode:
+		for idx, child := range node.Content {
+			walkScalarNodes(child, append(append([]string{}, path...), fmt.Sprintf("%d", idx)), visit)
+		}
+	case yaml.MappingNode:
+		for idx := 0; idx < len(node.Content); idx += 2 {
+			if node.Content[idx].Value == "sops" && len(path) == 0 {
+				continue
+			}
+			walkScalarNodes(node.Content[idx+1], append(append([]string{}, path...), node.Content[idx].Value), visit)
+		}
+	}
+}
+
+func scalarNode(value, tag string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+// importNode parses data in format into a yaml mapping node.
+func importNode(data []byte, format string) (*yaml.Node, error) {
+	switch format {
+	case "dotenv":
+		return dotenvNode(data)
+	case "toml":
+		return tomlNode(data)
+	case "json", "yaml":
+		doc := &yaml.Node{}
+		if err := yaml.Unmarshal(data, doc); err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("expected a map at the top level")
+		}
+		root := doc.Content[0]
+		if format == "json" {
+			plainStyle(root)
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown format %s", format)
+}
+
+// plainStyle drops json's quotes and flow styles, leaving it to the encoder to quote strings when needed.
+func plainStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		plainStyle(child)
+	}
+}
+
+var (
+	dotenvInt   = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	dotenvFloat = regexp.MustCompile(`^-?(0|[1-9][0-9]*)\.[0-9]+$`)
+	dotenvLine  = regexp.MustCompile(`^(export\s+)?([A-Za-z_][A-Za-z0-9_.-]*)\s*=\s*(.*)$`)
+)
+
+// dotenvValueTag infers the type of unquoted dotenv values.
+func dotenvValueTag(value string) string {
+	switch {
+	case dotenvInt.MatchString(value):
+		return "!!int"
+	case dotenvFloat.MatchString(value):
+		return "!!float"
+	case value == "true" || value == "false":
+		return "!!bool"
+	}
+	return "!!str"
+}
+
+var dotenvUnescaper = strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\"`, `"`, `\\`, `\`, `\$`, "$")
+
+func dotenvNode(data []byte) (*yaml.Node, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	comments := []string{}
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			comments = []string{}
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			comments = append(comments, line)
+			continue
+		}
+
+		match := dotenvLine.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNumber)
+		}
+		key, raw := match[2], match[3]
+
+		value := scalarNode("", "!!str")
+		switch {
+		case strings.HasPrefix(raw, "'"):
+			end := strings.Index(raw[1:], "'")
+			if end == -1 {
+				return nil, fmt.Errorf("line %d: unterminated single quote", lineNumber)
+			}
+			value.Value = raw[1 : end+1]
+		case strings.HasPrefix(raw, `"`):
+			// double quoted values may span multiple lines
+			for !dotenvClosed(raw) && scanner.Scan() {
+				lineNumber++
+				raw += "\n" + scanner.Text()
+			}
+			if !dotenvClosed(raw) {
+				return nil, fmt.Errorf("line %d: unterminated double quote", lineNumber)
+			}
+			value.Value = dotenvUnescaper.Replace(raw[1:dotenvClosingQuote(raw)])
+		default:
+			if idx := strings.Index(raw, " #"); idx > -1 {
+				raw = raw[0:idx]
+			}
+			value.Value = strings.TrimSpace(raw)
+			value.Tag = dotenvValueTag(value.Value)
+		}
+
+		keyNode := scalarNode(key, "!!str")
+		if len(comments) > 0 {
+			keyNode.HeadComment = strings.Join(comments, "\n")
+			comments = []string{}
+		}
+		root.Content = append(root.Content, keyNode, value)
+	}
+
+	return root, scanner.Err()
+}
+
+// dotenvClosingQuote returns the index of the unescaped double quote closing raw, or -1.
+func dotenvClosingQuote(raw string) int {
+	escaped := false
+	for idx := 1; idx < len(raw); idx++ {
+		switch {
+		case escaped:
+			escaped = false
+		case raw[idx] == '\\':
+			escaped = true
+		case raw[idx] == '"':
+			return idx
+		}
+	}
+	return -1
+}
+
+func dotenvClosed(raw string) bool {
+	return dotenvClosingQuote(raw) > -1
+}
+
+func tomlNode(data []byte) (*yaml.Node, error) {
+	tree := map[string]any{}
+	md, err := toml.Decode(string(data), &tree)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep keys in the order they're defined, since maps don't
+	order := map[string]int{}
+	for idx, key := range md.Keys() {
+		if _, exists := order[key.String()]; !exists {
+			order[key.String()] = idx
+		}
+	}
+
+	return tomlValueNode(tree, nil, order), nil
+}
+
+func tomlValueNode(value any, path []string, order map[string]int) *yaml.Node {
+	switch val := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		keyOrder := func(key string) int {
+			return order[toml.Key(append(append([]string{}, path...), key)).String()]
+		}
+		sort.SliceStable(keys, func(i, j int) bool { return keyOrder(keys[i]) < keyOrder(keys[j]) })
+
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range keys {
+			node.Content = append(node.Content, scalarNode(key, "!!str"), tomlValueNode(val[key], append(path, key), order))
+		}
+		return node
+	case []map[string]any:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range val {
+			node.Content = append(node.Content, tomlValueNode(item, path, order))
+		}
+		return node
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range val {
+			node.Content = append(node.Content, tomlValueNode(item, path, order))
+		}
+		return node
+	case string:
+		return scalarNode(val, "!!str")
+	case bool:
+		return scalarNode(fmt.Sprintf("%t", val), "!!bool")
+	case int64:
+		return scalarNode(fmt.Sprintf("%d", val), "!!int")
+	case float64:
+		repr := strconv.FormatFloat(val, 'f', -1, 64)
+		if !strings.ContainsAny(repr, ".eE") {
+			repr += ".0"
+		}
+		return scalarNode(repr, "!!float")
+	case time.Time:
+		return scalarNode(val.Format(time.RFC3339Nano), "!!str")
+	}
+	return scalarNode(fmt.Sprintf("%v", value), "!!str")
+}
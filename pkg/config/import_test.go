@@ -0,0 +1,150 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+func importFixture(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("could not write fixture: %s", err)
+	}
+	return path
+}
+
+func importAs(t *testing.T, path string, opts *config.ImportOptions) string {
+	t.Helper()
+	cfg, err := config.Import(path, opts)
+	if err != nil {
+		t.Fatalf("could not import: %s", err)
+	}
+
+	out, err := cfg.AsYAML()
+	if err != nil {
+		t.Fatalf("could not serialize: %s", err)
+	}
+	return string(out)
+}
+
+func TestImportDotenv(t *testing.T) {
+	path := importFixture(t, ".env", `# where mail goes
+SMTP_HOST=smtp.example.com # inline comment
+SMTP_PORT=587
+SMTP_PASSWORD="hunter\"2"
+export DEBUG=false
+ZIP='01234'
+RATIO=0.5
+MULTILINE="one
+two"
+DATABASE_URL=postgres://user:pass@db/app
+`)
+
+	got := importAs(t, path, &config.ImportOptions{DetectSecrets: true, Vault: "example", Name: "test"})
+	expected := `_config: !!joao
+  vault: example
+  name: test
+# where mail goes
+SMTP_HOST: smtp.example.com
+SMTP_PORT: 587
+SMTP_PASSWORD: !!secret hunter"2
+DEBUG: false
+ZIP: "01234"
+RATIO: 0.5
+MULTILINE: |-
+  one
+  two
+DATABASE_URL: !!secret postgres://user:pass@db/app
+`
+	if got != expected {
+		t.Fatalf("unexpected import.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
+
+func TestImportJSON(t *testing.T) {
+	path := importFixture(t, "config.json", `{"name": "api", "port": 8080, "debug": true, "version": "1", "db": {"user": "api", "password": "s3cr3t"}, "hosts": ["a", "b"]}`)
+
+	got := importAs(t, path, &config.ImportOptions{
+		SecretRules: []*regexp.Regexp{regexp.MustCompile(`^db\.user$`)},
+	})
+	expected := `name: api
+port: 8080
+debug: true
+version: "1"
+db:
+  user: !!secret api
+  password: s3cr3t
+hosts:
+  - a
+  - b
+`
+	if got != expected {
+		t.Fatalf("unexpected import.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
+
+func TestImportTOML(t *testing.T) {
+	path := importFixture(t, "config.toml", `title = "api"
+port = 8080
+ratio = 2.0
+
+[smtp]
+host = "smtp.example.com"
+api_key = "abc"
+
+[[servers]]
+host = "a"
+
+[[servers]]
+host = "b"
+`)
+
+	got := importAs(t, path, &config.ImportOptions{DetectSecrets: true})
+	expected := `title: api
+port: 8080
+ratio: 2.0
+smtp:
+  host: smtp.example.com
+  api_key: !!secret abc
+servers:
+  - host: a
+  - host: b
+`
+	if got != expected {
+		t.Fatalf("unexpected import.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
+
+func TestImportSOPS(t *testing.T) {
+	path := importFixture(t, "secrets.yaml", `host: ENC[AES256_GCM,data:abc,iv:def,tag:ghi,type:str]
+port_unencrypted: 25
+sops:
+  age:
+    - recipient: age1example
+  mac: ENC[AES256_GCM,data:mac,iv:def,tag:ghi,type:str]
+`)
+
+	decrypt := config.SOPSDecrypt
+	defer func() { config.SOPSDecrypt = decrypt }()
+	config.SOPSDecrypt = func(path, format string) ([]byte, error) {
+		if format != "yaml" {
+			t.Fatalf("unexpected format %s", format)
+		}
+		return []byte("host: smtp.example.com\nport_unencrypted: 25\n"), nil
+	}
+
+	got := importAs(t, path, &config.ImportOptions{DetectSecrets: true})
+	expected := `host: !!secret smtp.example.com
+port_unencrypted: 25
+`
+	if got != expected {
+		t.Fatalf("unexpected import.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
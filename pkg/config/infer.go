@@ -0,0 +1,289 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFiles returns the config files at paths, looking for them inside directories, skipping hidden ones.
+func ConfigFiles(paths ...string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			hidden := strings.HasPrefix(entry.Name(), ".") && file != path
+			if entry.IsDir() {
+				if hidden {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if !hidden && argIsConfigFile(file) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// SchemaGroup returns the glob grouping the file at path with others named by the same nameTemplate, i.e. all of
+// `host/*.yaml` for the default `{{ DirName }}:{{ FileName }}`.
+func SchemaGroup(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	rmc, err := findRepoConfig(abs)
+	if err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(abs)
+	ext := ""
+	if idx := strings.Index(name, "."); idx != -1 {
+		ext = name[idx:]
+	}
+
+	if rmc == nil {
+		return filepath.Join(filepath.Dir(path), "*"+ext), nil
+	}
+
+	dir, err := filepath.Rel(rmc.Repo, filepath.Dir(abs))
+	if err != nil {
+		return "", err
+	}
+
+	template := rmc.NameTemplate
+	if template == "" || strings.Contains(template, "FileName") {
+		return filepath.ToSlash(filepath.Join(dir, "*"+ext)), nil
+	}
+
+	if strings.Contains(template, "DirName") {
+		return filepath.ToSlash(filepath.Join(filepath.Dir(dir), "*", name)), nil
+	}
+	return filepath.ToSlash(filepath.Join(dir, name)), nil
+}
+
+// keyStats counts what's found at a key path across configs.
+type keyStats struct {
+	configs int
+	types   map[string]int
+	secrets int
+	plain   int
+	values  map[string]int
+	order   []string
+}
+
+// Inference collects the keys in a group of configs, to infer a schema from them.
+type Inference struct {
+	Pattern string
+	Configs int
+	keys    map[string]*keyStats
+	order   []string
+}
+
+func NewInference(pattern string) *Inference {
+	return &Inference{Pattern: pattern, keys: map[string]*keyStats{}}
+}
+
+// Add counts the keys in tree.
+func (inf *Inference) Add(tree *Entry) {
+	inf.Configs++
+	seen := map[string]bool{}
+	inf.add(tree, []string{}, seen)
+}
+
+func (inf *Inference) add(e *Entry, path []string, seen map[string]bool) {
+	if len(path) > 0 {
+		key := JoinPath(path)
+		stats, ok := inf.keys[key]
+		if !ok {
+			stats = &keyStats{types: map[string]int{}, values: map[string]int{}}
+			inf.keys[key] = stats
+			inf.order = append(inf.order, key)
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			stats.configs++
+		}
+
+		stats.types[e.valueType()]++
+		if e.IsSecret() {
+			stats.secrets++
+		} else {
+			stats.plain++
+			if e.IsScalar() && !e.IsRef() {
+				if _, found := stats.values[e.Value]; !found {
+					stats.order = append(stats.order, e.Value)
+				}
+				stats.values[e.Value]++
+			}
+		}
+	}
+
+	switch e.Kind {
+	case yaml.SequenceNode:
+		for _, child := range e.Content {
+			inf.add(child, append(append([]string{}, path...), "*"), seen)
+		}
+	case yaml.MappingNode, yaml.DocumentNode:
+		for idx := 1; idx < len(e.Content); idx += 2 {
+			child := e.Content[idx]
+			if len(path) == 0 && child.Type == YAMLTypeMetaConfig {
+				continue
+			}
+			inf.add(child, append(append([]string{}, path...), e.Content[idx-1].Value), seen)
+		}
+	}
+}
+
+// parentConfigs returns how many configs hold the parent of key, or every config for top-level keys.
+func (inf *Inference) parentConfigs(key string) int {
+	path, err := SplitPath(key)
+	if err != nil || len(path) < 2 {
+		return inf.Configs
+	}
+	if parent, ok := inf.keys[JoinPath(path[0:len(path)-1])]; ok {
+		return parent.configs
+	}
+	return inf.Configs
+}
+
+// Schema returns the schema inferred so far, listing values as enums for non-secret keys with up to maxEnum
+// distinct values repeated across configs.
+func (inf *Inference) Schema(maxEnum int) *Schema {
+	schema := &Schema{Strict: true, Keys: map[string]*KeySchema{}}
+	for _, key := range inf.order {
+		schema.Keys[key] = inf.keySchema(key, maxEnum)
+	}
+	return schema
+}
+
+func (inf *Inference) keySchema(key string, maxEnum int) *KeySchema {
+	stats := inf.keys[key]
+	ks := &KeySchema{}
+
+	if len(stats.types) == 1 {
+		for kind := range stats.types {
+			ks.Type = kind
+		}
+	} else if len(stats.types) == 2 && stats.types["int"] > 0 && stats.types["float"] > 0 {
+		ks.Type = "float"
+	}
+
+	// keys below lists can't tell if their parent was there, so they're required whenever found everywhere
+	ks.Required = !strings.HasSuffix(key, ".*") && stats.configs == inf.parentConfigs(key)
+
+	switch {
+	case stats.plain == 0:
+		secret := true
+		ks.Secret = &secret
+	case stats.secrets == 0:
+		secret := false
+		ks.Secret = &secret
+	}
+
+	if stats.secrets == 0 && (ks.Type == "string" || ks.Type == "bool") && len(stats.values) <= maxEnum {
+		total := 0
+		for _, count := range stats.values {
+			total += count
+		}
+		if total > len(stats.values) {
+			ks.Enum = append([]string{}, stats.order...)
+			sort.Strings(ks.Enum)
+		}
+	}
+
+	if ks.Type == "map" {
+		ks.Strict = true
+	}
+	return ks
+}
+
+// comment describes how a key was found across configs.
+func (inf *Inference) comment(key string) string {
+	stats := inf.keys[key]
+	parts := []string{fmt.Sprintf("in %d/%d", stats.configs, inf.parentConfigs(key))}
+
+	if len(stats.types) > 1 {
+		types := []string{}
+		for kind, count := range stats.types {
+			types = append(types, fmt.Sprintf("%s ×%d", kind, count))
+		}
+		sort.Strings(types)
+		parts = append(parts, "types: "+strings.Join(types, ", "))
+	}
+
+	if stats.secrets > 0 && stats.plain > 0 {
+		parts = append(parts, fmt.Sprintf("secret in %d of %d", stats.secrets, stats.secrets+stats.plain))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Encode returns the inferred schema as YAML, commented with how often and how every key was found.
+func (inf *Inference) Encode(maxEnum int) ([]byte, error) {
+	schema := inf.Schema(maxEnum)
+
+	keys := &yaml.Node{Kind: yaml.MappingNode}
+	for _, key := range inf.order {
+		value := &yaml.Node{}
+		if err := value.Encode(schema.Keys[key]); err != nil {
+			return nil, err
+		}
+		if len(value.Content) > 0 {
+			// enums read better inline
+			for idx := 0; idx < len(value.Content); idx += 2 {
+				if value.Content[idx].Value == "enum" {
+					value.Content[idx+1].Style = yaml.FlowStyle
+				}
+			}
+		}
+
+		keys.Content = append(keys.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: key, LineComment: inf.comment(key)},
+			value,
+		)
+	}
+
+	root := &yaml.Node{
+		Kind:        yaml.MappingNode,
+		HeadComment: fmt.Sprintf("inferred from %d configs at %s", inf.Configs, inf.Pattern),
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "strict"},
+			{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"},
+			{Kind: yaml.ScalarNode, Value: "keys"},
+			keys,
+		},
+	}
+
+	return encodeNode(root)
+}
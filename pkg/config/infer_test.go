@@ -0,0 +1,140 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+func inferFixtures(t *testing.T) string {
+	t.Helper()
+	return refFixtures(t, map[string]string{
+		".joao.yaml": "vault: example\n",
+		"host/juazeiro.yaml": `dc: casa
+address: 10.0.0.2
+roles: [http, dns]
+token: !!secret abc
+`,
+		"host/tetecala.yaml": `dc: casa
+address: 10.0.0.3
+roles: [http]
+token: !!secret def
+ports:
+  ssh: 22
+`,
+		"host/xitle.yaml": `dc: nube
+address: 10.0.1.2
+roles: []
+token: plain
+`,
+		"service/api.yaml": "port: 8080\n",
+	})
+}
+
+func TestInferSchema(t *testing.T) {
+	dir := inferFixtures(t)
+	files, err := config.ConfigFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := map[string]*config.Inference{}
+	for _, path := range files {
+		pattern, err := config.SchemaGroup(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if groups[pattern] == nil {
+			groups[pattern] = config.NewInference(pattern)
+		}
+
+		cfg, err := config.Load(path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups[pattern].Add(cfg.Tree)
+	}
+
+	if len(groups) != 2 || groups["host/*.yaml"] == nil || groups["service/*.yaml"] == nil {
+		t.Fatalf("unexpected groups: %v", groups)
+	}
+
+	got, err := groups["host/*.yaml"].Encode(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# inferred from 3 configs at host/*.yaml
+strict: true
+keys:
+  dc: # in 3/3
+    type: string
+    required: true
+    secret: false
+    enum: [casa, nube]
+  address: # in 3/3
+    type: string
+    required: true
+    secret: false
+  roles: # in 3/3
+    type: list
+    required: true
+    secret: false
+  roles.*: # in 2/3
+    type: string
+    secret: false
+    enum: [dns, http]
+  token: # in 3/3, secret in 2 of 3
+    type: string
+    required: true
+  ports: # in 1/3
+    type: map
+    secret: false
+    strict: true
+  ports.ssh: # in 1/1
+    type: int
+    required: true
+    secret: false
+`
+	if string(got) != expected {
+		t.Fatalf("unexpected schema.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+
+	// inferred schemas validate the configs they were inferred from
+	schema, err := config.ParseSchema(got)
+	if err != nil {
+		t.Fatalf("could not parse inferred schema: %s", err)
+	}
+
+	for _, name := range []string{"juazeiro", "tetecala", "xitle"} {
+		file, err := config.LoadFile(filepath.Join(dir, "host", name+".yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := file.ValidateWith(schema, file.Documents[0]); err != nil {
+			t.Fatalf("expected %s to validate: %s", name, err)
+		}
+	}
+}
+
+func TestConfigFiles(t *testing.T) {
+	dir := inferFixtures(t)
+	files, err := config.ConfigFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, file := range files {
+		rel, _ := filepath.Rel(dir, file)
+		got = append(got, rel)
+	}
+
+	if expected := "host/juazeiro.yaml host/tetecala.yaml host/xitle.yaml service/api.yaml"; strings.Join(got, " ") != expected {
+		t.Fatalf("unexpected files: %v", got)
+	}
+}
@@ -4,7 +4,6 @@ package config
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 
@@ -18,37 +17,27 @@ const warnChecksumMismatch = `1Password item %s changed and checksum was not upd
 Expected: %s
 found   : %s`
 
+// Load reads the config at ref: a local file, or its 1Password item if preferRemote, or a VAULT/ITEM reference.
 func Load(ref string, preferRemote bool) (*Config, error) {
-	if preferRemote {
+	return LoadDocument(ref, "", preferRemote)
+}
+
+// LoadDocument works like Load, selecting one of the documents in a file by index or item name. Local files are
+// returned with the values of the files they extend.
+func LoadDocument(ref, document string, preferRemote bool) (*Config, error) {
+	if preferRemote && !argIsConfigFile(ref) {
 		name := ref
 		vault := ""
-
-		if argIsYAMLFile(ref) {
-			path, err := filepath.Abs(ref)
-			if err != nil {
-				return nil, fmt.Errorf("could not find asbolute path to file %s: %w", ref, err)
-			}
-			name, vault, err = VaultAndNameFrom(path, nil)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			parts := strings.SplitN(ref, "/", 2)
-			if len(parts) > 1 {
-				vault = parts[0]
-				name = parts[1]
-			}
+		parts := strings.SplitN(ref, "/", 2)
+		if len(parts) > 1 {
+			vault = parts[0]
+			name = parts[1]
 		}
 
-		item, err := opClient.Get(vault, name)
-		if err != nil {
-			return nil, err
-		}
-
-		return FromOP(item)
+		return Remote(vault, name)
 	}
 
-	if !argIsYAMLFile(ref) {
+	if !argIsConfigFile(ref) {
 		return nil, fmt.Errorf("could not load %s from local as it's not a path", ref)
 	}
 
@@ -56,53 +45,83 @@ func Load(ref string, preferRemote bool) (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not find asbolute path to file %s: %w", ref, err)
 	}
-	cfg, err := FromFile(path)
+
+	file, err := LoadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("could not load file %s: %w", path, err)
+		return nil, err
 	}
-	return cfg, nil
-}
 
-// FromFile reads a path and returns a config.
-func FromFile(path string) (*Config, error) {
-	buf, err := os.ReadFile(path)
+	cfg, err := file.Select(document)
 	if err != nil {
-		return nil, fmt.Errorf("could not read file %s", path)
+		return nil, err
 	}
 
-	if len(buf) == 0 {
-		buf = []byte("{}")
+	if preferRemote {
+		return Remote(cfg.Vault, cfg.Name)
 	}
+	return file.Effective(cfg)
+}
 
-	name, vault, err := VaultAndNameFrom(path, buf)
+// Remote reads the config stored at a 1Password item.
+func Remote(vault, name string) (*Config, error) {
+	item, err := opClient.Get(vault, name)
 	if err != nil {
 		return nil, err
 	}
-	logrus.Debugf("Found name: %s and vault: %s", name, vault)
 
-	cfg, err := FromYAML(buf)
+	return FromOP(item)
+}
+
+// FromFile reads a path and returns a config, erroring if it holds more than one document.
+func FromFile(path string) (*Config, error) {
+	file, err := LoadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	cfg.Name = name
-	cfg.Vault = vault
-
-	return cfg, nil
+	return file.Select("")
 }
 
-// FromYAML reads yaml bytes and returns a config.
+// FromYAML reads yaml bytes and returns a config for its first document.
 func FromYAML(data []byte) (*Config, error) {
-	cfg := &Config{
-		Tree: NewEntry("root", yaml.MappingNode),
+	return Decode(CodecYAML, data)
+}
+
+// Decode reads bytes encoded with codec and returns a config for its first document.
+func Decode(codec *Codec, data []byte) (*Config, error) {
+	configs, err := DecodeAll(codec, data)
+	if err != nil {
+		return nil, err
 	}
+	return configs[0], nil
+}
 
-	err := yaml.Unmarshal(data, &cfg.Tree)
+// DecodeAll reads bytes encoded with codec and returns a config per document.
+func DecodeAll(codec *Codec, data []byte) ([]*Config, error) {
+	docs, err := codec.Decode(data)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse %w", err)
 	}
-	cfg.Tree.SetPath([]string{}, ".")
 
-	return cfg, nil
+	return configsFrom(docs)
+}
+
+// configsFrom returns a config for every decoded document.
+func configsFrom(docs []*yaml.Node) ([]*Config, error) {
+	configs := []*Config{}
+	for _, doc := range docs {
+		cfg := &Config{
+			Tree: NewEntry("root", yaml.MappingNode),
+		}
+
+		if err := doc.Decode(&cfg.Tree); err != nil {
+			return nil, fmt.Errorf("could not parse %w", err)
+		}
+		cfg.Tree.SetPath([]string{}, ".")
+		cfg.Tree.linkAliases(map[string]*Entry{})
+		configs = append(configs, cfg)
+	}
+
+	return configs, nil
 }
 
 // FromOP reads a config from an op item and returns a config.
@@ -113,9 +132,14 @@ func FromOP(item *op.Item) (*Config, error) {
 		Tree:  NewEntry("root", yaml.MappingNode),
 	}
 
-	if cs := opClient.Checksum(item.Fields); cs != item.GetValue("password") {
+	if cs, ok := opClient.VerifyChecksum(item); !ok {
 		logrus.Warnf(warnChecksumMismatch, fmt.Sprintf("%s/%s", item.Vault.ID, item.Title), cs, item.GetValue("password"))
 	}
-	err := cfg.Tree.FromOP(item.Fields)
+	files, err := fileFields(item)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Tree.FromOP(append(append([]*op.ItemField{}, item.Fields...), files...))
 	return cfg, err
 }
@@ -0,0 +1,356 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrorLayerCycle is returned when a config ends up extending itself.
+var ErrorLayerCycle = fmt.Errorf("config extends itself")
+
+const (
+	// FlushEffective flushes the tree resulting from applying a config on top of the ones it extends.
+	FlushEffective = "effective"
+	// FlushOverlay flushes only the values a config sets itself.
+	FlushOverlay = "overlay"
+)
+
+// OverlayRule makes config files matching a pattern extend other files, configured in `.joao.yaml`.
+type OverlayRule struct {
+	// Match is a glob matched against file names, or against paths relative to the repo config if it has slashes.
+	Match string `yaml:"match"`
+	// Extends are the files extended by matching files, relative to them.
+	Extends []string `yaml:"extends"`
+	// Flush is either "effective" (the default) or "overlay".
+	Flush string `yaml:"flush"`
+}
+
+// globMatches tells if path matches pattern, either by file name, or relative to repo if pattern has slashes.
+func globMatches(pattern, repo, path string) bool {
+	target := filepath.Base(path)
+	if strings.Contains(pattern, "/") {
+		rel, err := filepath.Rel(repo, path)
+		if err != nil {
+			return false
+		}
+		target = filepath.ToSlash(rel)
+	}
+
+	matched, err := filepath.Match(pattern, target)
+	return err == nil && matched
+}
+
+// Origin returns the file an entry of an effective tree was inherited from, or an empty string if the config sets
+// it itself.
+func (e *Entry) Origin() string {
+	return e.origin
+}
+
+func (e *Entry) inherit(origin string) {
+	if e.origin == "" {
+		e.origin = origin
+	}
+	for _, child := range e.Content {
+		child.inherit(origin)
+	}
+}
+
+// detach drops anchors, aliases and merge keys below e, so it's output with concrete values anywhere.
+func (e *Entry) detach() {
+	e.Anchor = ""
+	e.Alias = ""
+	e.aliased = nil
+	e.merges = nil
+	e.mergeKey = nil
+	e.merged = false
+	for _, child := range e.Content {
+		child.detach()
+	}
+}
+
+// childIndex returns the index of the value named name in the contents of a map, or -1 if there's none.
+func (e *Entry) childIndex(name string) int {
+	for idx := 1; idx < len(e.Content); idx += 2 {
+		if e.Content[idx].Name() == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// layered returns a copy of base with over applied on top of it: maps are merged key by key, and anything else in
+// over replaces what's in base.
+func layered(base, over *Entry) *Entry {
+	if base.Kind != yaml.MappingNode || over.Kind != yaml.MappingNode {
+		return over.clone()
+	}
+
+	result := over.clone()
+	result.Content = []*Entry{}
+	// the embedded config is never inherited
+	for idx := 1; idx < len(over.Content); idx += 2 {
+		if over.Content[idx].Type == YAMLTypeMetaConfig {
+			result.Content = append(result.Content, over.Content[idx-1].clone(), over.Content[idx].clone())
+		}
+	}
+
+	for idx := 1; idx < len(base.Content); idx += 2 {
+		value := base.Content[idx]
+		if value.Type == YAMLTypeMetaConfig {
+			continue
+		}
+
+		if own := over.childIndex(value.Name()); own != -1 {
+			result.Content = append(result.Content, over.Content[own-1].clone(), layered(value, over.Content[own]))
+			continue
+		}
+
+		inherited := value.clone()
+		inherited.detach()
+		result.Content = append(result.Content, base.Content[idx-1].clone(), inherited)
+	}
+
+	for idx := 1; idx < len(over.Content); idx += 2 {
+		if over.Content[idx].Type != YAMLTypeMetaConfig && base.childIndex(over.Content[idx].Name()) == -1 {
+			result.Content = append(result.Content, over.Content[idx-1].clone(), over.Content[idx].clone())
+		}
+	}
+
+	return result
+}
+
+// unlayered returns the values in tree that differ from the ones in base, keeping every value own sets.
+func unlayered(base, tree, own *Entry) *Entry {
+	result := tree.clone()
+	if base == nil || base.Kind != yaml.MappingNode || tree.Kind != yaml.MappingNode {
+		return result
+	}
+
+	result.Content = []*Entry{}
+	for idx := 1; idx < len(tree.Content); idx += 2 {
+		value := tree.Content[idx]
+		var ownValue *Entry
+		if own != nil {
+			ownValue = own.ChildNamed(value.Name())
+		}
+
+		inherited := base.ChildNamed(value.Name())
+		if inherited != nil {
+			if ownValue == nil && inherited.equal(value) {
+				continue
+			}
+
+			if inherited.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+				value = unlayered(inherited, value, ownValue)
+				if ownValue == nil && len(value.Content) == 0 {
+					continue
+				}
+			}
+		}
+
+		result.Content = append(result.Content, tree.Content[idx-1].clone(), value)
+	}
+	return result
+}
+
+// layers returns the files the config in cfg extends, and how it should be flushed, either from its `_config` or
+// overlay rules in the repo config.
+func (f *File) layers(cfg *Config) ([]string, string, error) {
+	path, err := filepath.Abs(f.Path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	extends := []string{}
+	flush := ""
+	if meta := cfg.metaConfig(); meta != nil {
+		extends = meta.Extends
+		flush = meta.Flush
+	}
+
+	if len(extends) == 0 {
+		rmc, err := findRepoConfig(path)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if rmc != nil {
+			for _, rule := range rmc.Overlays {
+				if globMatches(rule.Match, rmc.Repo, path) {
+					extends = rule.Extends
+					if flush == "" {
+						flush = rule.Flush
+					}
+					break
+				}
+			}
+		}
+	}
+
+	switch flush {
+	case "":
+		flush = FlushEffective
+	case FlushEffective, FlushOverlay:
+	default:
+		return nil, "", fmt.Errorf("unknown flush mode %s for %s, use %s or %s", flush, f.Path, FlushEffective, FlushOverlay)
+	}
+
+	bases := make([]string, 0, len(extends))
+	for _, base := range extends {
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(path), base)
+		}
+		bases = append(bases, base)
+	}
+	return bases, flush, nil
+}
+
+// bases returns the effective tree of the files cfg extends, in order, or nil if it extends none.
+func (f *File) bases(cfg *Config, stack []string) (*Entry, error) {
+	paths, _, err := f.layers(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree *Entry
+	for _, path := range paths {
+		for _, seen := range stack {
+			if seen == path {
+				return nil, fmt.Errorf("%w: %s", ErrorLayerCycle, strings.Join(append(stack, path), " -> "))
+			}
+		}
+
+		base, err := effectiveFile(path, append(append([]string{}, stack...), path))
+		if err != nil {
+			return nil, err
+		}
+
+		if tree == nil {
+			tree = base
+		} else {
+			tree = layered(tree, base)
+		}
+	}
+	return tree, nil
+}
+
+func effectiveFile(path string, stack []string) (*Entry, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s, extended by %s", path, stack[len(stack)-2])
+	}
+
+	file, err := ParseFile(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := file.Select("")
+	if err != nil {
+		return nil, fmt.Errorf("could not extend %s: %w", path, err)
+	}
+
+	base, err := file.bases(cfg, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Tree.linkRefs(path)
+	tree := cfg.Tree.clone()
+	if base != nil {
+		tree = layered(base, tree)
+	}
+	tree.inherit(path)
+	return tree, nil
+}
+
+// Effective returns the config resulting from applying cfg, a document of f, on top of the files it extends, with
+// every inherited value pointing to the file it came from. It returns cfg as-is if it extends no files.
+func (f *File) Effective(cfg *Config) (*Config, error) {
+	path, err := filepath.Abs(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := f.bases(cfg, []string{path})
+	if err != nil {
+		return nil, err
+	}
+
+	if base == nil {
+		return cfg, nil
+	}
+
+	tree := layered(base, cfg.Tree)
+	tree.SetPath([]string{}, ".")
+	return &Config{Vault: cfg.Vault, Name: cfg.Name, Tree: tree}, nil
+}
+
+// Flushed returns the config to store in 1Password for cfg, a document of f: either its effective tree or the
+// values it sets itself.
+func (f *File) Flushed(cfg *Config) (*Config, error) {
+	_, flush, err := f.layers(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if flush == FlushOverlay {
+		return cfg, nil
+	}
+	return f.Effective(cfg)
+}
+
+// Overlay returns the values in tree, read for cfg (a document of f), that are not inherited from the files cfg
+// extends, so they can be merged into cfg.
+func (f *File) Overlay(cfg *Config, tree *Config) (*Config, error) {
+	path, err := filepath.Abs(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := f.bases(cfg, []string{path})
+	if err != nil {
+		return nil, err
+	}
+
+	overlay := unlayered(base, tree.Tree, cfg.Tree)
+	overlay.SetPath([]string{}, ".")
+	return &Config{Vault: tree.Vault, Name: tree.Name, Tree: overlay}, nil
+}
+
+// ValueOrigin tells the file a value of an effective tree came from.
+type ValueOrigin struct {
+	Path []string
+	File string
+}
+
+// Origins lists the file every scalar below e came from, defaulting to file for the values set by the config itself.
+func (e *Entry) Origins(file string) []ValueOrigin {
+	origins := []ValueOrigin{}
+	if e.Type == YAMLTypeMetaConfig {
+		return origins
+	}
+
+	if e.IsScalar() || len(e.Content) == 0 {
+		origin := e.origin
+		if origin == "" {
+			origin = file
+		}
+		return append(origins, ValueOrigin{Path: e.Path, File: origin})
+	}
+
+	start, step := 0, 1
+	if e.Kind == yaml.MappingNode {
+		start, step = 1, 2
+	}
+	for idx := start; idx < len(e.Content); idx += step {
+		origins = append(origins, e.Content[idx].Origins(file)...)
+	}
+	return origins
+}
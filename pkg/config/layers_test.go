@@ -0,0 +1,174 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+const layersBase = `_config: !!joao
+  vault: example
+  name: base
+host: db.example.com
+port: 5432
+tls:
+  enabled: true
+  ca: ca.pem
+password: !!secret base-secret
+`
+
+const layersProd = `_config: !!joao
+  vault: example
+  name: prod
+  extends: [base.yaml]
+host: prod.example.com
+tls:
+  ca: prod.pem
+replicas: 3
+`
+
+func TestLayersEffective(t *testing.T) {
+	dir := refFixtures(t, map[string]string{"base.yaml": layersBase, "prod.yaml": layersProd})
+	path := filepath.Join(dir, "prod.yaml")
+
+	cfg, err := config.Load(path, false)
+	if err != nil {
+		t.Fatalf("could not load: %s", err)
+	}
+
+	got, err := cfg.AsYAML(config.OutputModeNoConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `host: prod.example.com
+port: 5432
+tls:
+  enabled: true
+  ca: prod.pem
+password: !!secret base-secret
+replicas: 3
+`
+	if string(got) != expected {
+		t.Fatalf("unexpected effective config.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+
+	origins := []string{}
+	for _, origin := range cfg.Tree.Origins(path) {
+		origins = append(origins, strings.Join(origin.Path, ".")+"="+filepath.Base(origin.File))
+	}
+	if got, expected := strings.Join(origins, " "), "host=prod.yaml port=base.yaml tls.enabled=base.yaml tls.ca=prod.yaml password=base.yaml replicas=prod.yaml"; got != expected {
+		t.Fatalf("unexpected origins.\nwanted: %s\ngot:    %s", expected, got)
+	}
+
+	if cfg.Name != "prod" || cfg.Vault != "example" {
+		t.Fatalf("unexpected item %s", cfg.OPURL())
+	}
+}
+
+func TestLayersFlushed(t *testing.T) {
+	dir := refFixtures(t, map[string]string{
+		"base.yaml":    layersBase,
+		"prod.yaml":    layersProd,
+		"staging.yaml": strings.Replace(strings.Replace(layersProd, "name: prod", "name: staging", 1), "extends: [base.yaml]", "extends: [base.yaml]\n  flush: overlay", 1),
+	})
+
+	for name, expected := range map[string]int{"prod.yaml": 6, "staging.yaml": 4} {
+		file, err := config.LoadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("could not load: %s", err)
+		}
+
+		flushed, err := file.Flushed(file.Documents[0])
+		if err != nil {
+			t.Fatalf("could not get flushed config: %s", err)
+		}
+
+		if got := len(flushed.ToMap()); got != expected {
+			t.Fatalf("expected %d top-level values flushed for %s, got %d: %v", expected, name, got, flushed.ToMap())
+		}
+	}
+}
+
+func TestLayersOverlay(t *testing.T) {
+	dir := refFixtures(t, map[string]string{"base.yaml": layersBase, "prod.yaml": layersProd})
+	file, err := config.LoadFile(filepath.Join(dir, "prod.yaml"))
+	if err != nil {
+		t.Fatalf("could not load: %s", err)
+	}
+	local := file.Documents[0]
+
+	remote, err := file.Effective(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Set([]string{"password"}, []byte("prod-secret"), true, false); err != nil {
+		t.Fatal(err)
+	}
+
+	overlay, err := file.Overlay(local, remote)
+	if err != nil {
+		t.Fatalf("could not get overlay: %s", err)
+	}
+
+	if err := local.Merge(overlay); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := local.AsYAML(config.OutputModeNoConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `host: prod.example.com
+tls:
+  ca: prod.pem
+replicas: 3
+password: !!secret prod-secret
+`
+	if string(got) != expected {
+		t.Fatalf("unexpected merged overlay.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
+
+func TestLayersRepoOverlays(t *testing.T) {
+	dir := refFixtures(t, map[string]string{
+		".joao.yaml": `vault: example
+overlays:
+  - match: "config.*.yaml"
+    extends: [config.yaml]
+`,
+		"config.yaml":      "host: db.example.com\nport: 5432\n",
+		"config.prod.yaml": "_config: !!joao\n  name: prod\nhost: prod.example.com\n",
+	})
+
+	cfg, err := config.Load(filepath.Join(dir, "config.prod.yaml"), false)
+	if err != nil {
+		t.Fatalf("could not load: %s", err)
+	}
+
+	got, err := cfg.AsYAML(config.OutputModeNoConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "host: prod.example.com\nport: 5432\n"; string(got) != expected {
+		t.Fatalf("unexpected effective config.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+}
+
+func TestLayersCycle(t *testing.T) {
+	dir := refFixtures(t, map[string]string{
+		"a.yaml": "_config: !!joao\n  vault: example\n  name: a\n  extends: b.yaml\nx: 1\n",
+		"b.yaml": "_config: !!joao\n  vault: example\n  name: b\n  extends: a.yaml\ny: 1\n",
+	})
+
+	_, err := config.Load(filepath.Join(dir, "a.yaml"), false)
+	if !errors.Is(err, config.ErrorLayerCycle) {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+}
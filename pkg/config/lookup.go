@@ -9,7 +9,6 @@ import (
 	"strings"
 
 	"git.rob.mx/nidito/chinampa/pkg/command"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
@@ -38,9 +37,14 @@ func scalarsIn(data map[string]yaml.Node, parents []string) ([]string, error) {
 		if key == "_config" && len(parents) == 0 {
 			continue
 		}
+
+		for leaf.Kind == yaml.AliasNode && leaf.Alias != nil {
+			leaf = *leaf.Alias
+		}
+
 		switch leaf.Kind {
 		case yaml.ScalarNode:
-			newKey := strings.Join(append(parents, key), ".")
+			newKey := JoinPath(append(parents, key))
 			keys = append(keys, newKey)
 		case yaml.MappingNode, yaml.DocumentNode, yaml.SequenceNode:
 			sub := map[string]yaml.Node{}
@@ -64,7 +68,7 @@ func scalarsIn(data map[string]yaml.Node, parents []string) ([]string, error) {
 			}
 			keys = append(keys, ret...)
 		default:
-			logrus.Fatalf("found unknown %v at %s", leaf.Kind, key)
+			return keys, fmt.Errorf("found unknown node kind %v at %s", leaf.Kind, JoinPath(append(parents, key)))
 		}
 	}
 
@@ -72,13 +76,37 @@ func scalarsIn(data map[string]yaml.Node, parents []string) ([]string, error) {
 }
 
 func KeysFromYAML(data []byte) ([]string, error) {
-	cfg := map[string]yaml.Node{}
-	err := yaml.Unmarshal(data, &cfg)
+	return KeysFrom(CodecYAML, data)
+}
+
+// KeysFrom returns the dot-delimited paths to every scalar in data, encoded with codec, across all documents.
+func KeysFrom(codec *Codec, data []byte) ([]string, error) {
+	docs, err := codec.Decode(data)
 	if err != nil {
 		return nil, err
 	}
 
-	return scalarsIn(cfg, []string{})
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, doc := range docs {
+		cfg := map[string]yaml.Node{}
+		if err := doc.Decode(&cfg); err != nil {
+			return nil, err
+		}
+
+		docKeys, err := scalarsIn(cfg, []string{})
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range docKeys {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys, nil
 }
 
 func AutocompleteKeys(cmd *command.Command, currentValue, config string) ([]string, cobra.ShellCompDirective, error) {
@@ -89,7 +117,7 @@ func AutocompleteKeys(cmd *command.Command, currentValue, config string) ([]stri
 		return nil, flag, fmt.Errorf("could not read file %s", file)
 	}
 
-	keys, err := KeysFromYAML(buf)
+	keys, err := KeysFrom(CodecFor(file), buf)
 	if err != nil {
 		return nil, flag, fmt.Errorf("could not parse file %s as %w", file, err)
 	}
@@ -103,10 +131,13 @@ func AutocompleteKeysAndParents(cmd *command.Command, currentValue string, confi
 	opts := map[string]bool{".": true}
 	options, flag, err := AutocompleteKeys(cmd, currentValue, "")
 	for _, opt := range options {
-		parts := strings.Split(opt, ".")
+		parts, err := SplitPath(opt)
+		if err != nil || len(parts) == 0 {
+			continue
+		}
 		sub := []string{parts[0]}
 		for idx, p := range parts {
-			key := strings.Join(sub, ".")
+			key := JoinPath(sub)
 			opts[key] = true
 
 			if idx > 0 && idx < len(parts)-1 {
@@ -0,0 +1,131 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" // nolint: gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IsOTP tells if e holds the seed of a one-time password, tagged `!!otp`.
+func (e *Entry) IsOTP() bool {
+	return e.Tag == YAMLTypeOTP
+}
+
+// otpParams are the parameters to compute time-based one-time passwords with.
+type otpParams struct {
+	secret    []byte
+	digits    int
+	period    int64
+	algorithm func() hash.Hash
+}
+
+// parseOTPSeed reads an `otpauth://totp/...` URI, or a bare base32-encoded secret.
+func parseOTPSeed(seed string) (*otpParams, error) {
+	params := &otpParams{digits: 6, period: 30, algorithm: sha1.New}
+	secret := seed
+
+	if strings.HasPrefix(seed, "otpauth://") {
+		uri, err := url.Parse(seed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid otpauth uri: %w", err)
+		}
+
+		if uri.Host != "totp" {
+			return nil, fmt.Errorf("unsupported one-time password type %s, only totp is supported", uri.Host)
+		}
+
+		query := uri.Query()
+		secret = query.Get("secret")
+		if digits := query.Get("digits"); digits != "" {
+			// RFC 4226 codes are 6 to 8 digits long
+			if params.digits, err = strconv.Atoi(digits); err != nil || params.digits < 6 || params.digits > 8 {
+				return nil, fmt.Errorf("invalid otpauth digits %s, expected 6 to 8", digits)
+			}
+		}
+
+		if period := query.Get("period"); period != "" {
+			if params.period, err = strconv.ParseInt(period, 10, 64); err != nil || params.period <= 0 {
+				return nil, fmt.Errorf("invalid otpauth period %s", period)
+			}
+		}
+
+		switch strings.ToUpper(query.Get("algorithm")) {
+		case "", "SHA1":
+		case "SHA256":
+			params.algorithm = sha256.New
+		case "SHA512":
+			params.algorithm = sha512.New
+		default:
+			return nil, fmt.Errorf("unsupported otpauth algorithm %s", query.Get("algorithm"))
+		}
+	}
+
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("one-time password secrets must be base32 encoded")
+	}
+	params.secret = key
+
+	return params, nil
+}
+
+// TOTP computes the time-based one-time password at a given time for seed, either an `otpauth://totp/...` URI or
+// a base32-encoded secret.
+func TOTP(seed string, at time.Time) (string, error) {
+	params, err := parseOTPSeed(seed)
+	if err != nil {
+		return "", err
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(at.Unix()/params.period))
+
+	mac := hmac.New(params.algorithm, params.secret)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	code %= uint32(math.Pow10(params.digits))
+
+	return fmt.Sprintf("%0*d", params.digits, code), nil
+}
+
+// OTPCodes replaces the seeds of one-time passwords below e with their codes at a given time, as secrets. Empty
+// seeds, like those of redacted files, are left as-is.
+func (e *Entry) OTPCodes(at time.Time) error {
+	if e.IsOTP() {
+		if e.Value == "" {
+			return nil
+		}
+
+		code, err := TOTP(e.Value, at)
+		if err != nil {
+			return fmt.Errorf("could not compute one-time password at %s: %w", strings.Join(e.Path, "."), err)
+		}
+		e.Value = code
+		e.Tag = YAMLTypeSecret
+		e.Type = YAMLTypeSecret
+		return nil
+	}
+
+	for _, child := range e.Content {
+		if err := child.OTPCodes(at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"git.rob.mx/nidito/joao/pkg/config"
+	op "github.com/1Password/connect-sdk-go/onepassword"
+)
+
+// base32 encodings of the RFC 6238 test secrets
+const (
+	rfcSecretSHA1   = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	rfcSecretSHA256 = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA"
+)
+
+func TestTOTP(t *testing.T) {
+	for _, c := range []struct {
+		seed     string
+		at       int64
+		expected string
+	}{
+		{rfcSecretSHA1, 59, "287082"},
+		{"otpauth://totp/joao?secret=" + rfcSecretSHA1 + "&digits=8", 59, "94287082"},
+		{"otpauth://totp/joao?secret=" + rfcSecretSHA1 + "&digits=8", 1111111109, "07081804"},
+		{"otpauth://totp/joao?secret=" + rfcSecretSHA256 + "&digits=8&algorithm=SHA256", 1234567890, "91819424"},
+		{"gezd gnbv gy3t qojq gezd gnbv gy3t qojq", 20000000000, "353130"},
+	} {
+		got, err := config.TOTP(c.seed, time.Unix(c.at, 0))
+		if err != nil {
+			t.Fatalf("could not compute totp for %s: %s", c.seed, err)
+		}
+		if got != c.expected {
+			t.Fatalf("unexpected totp for %s at %d: wanted %s, got %s", c.seed, c.at, c.expected, got)
+		}
+	}
+
+	for _, seed := range []string{
+		"not base32!",
+		"otpauth://hotp/joao?secret=" + rfcSecretSHA1,
+		"otpauth://totp/joao?secret=" + rfcSecretSHA1 + "&algorithm=MD5",
+		"otpauth://totp/joao?secret=" + rfcSecretSHA1 + "&digits=0",
+		"otpauth://totp/joao?secret=" + rfcSecretSHA1 + "&digits=-1",
+		"otpauth://totp/joao?secret=" + rfcSecretSHA1 + "&digits=12",
+	} {
+		if _, err := config.TOTP(seed, time.Now()); err == nil {
+			t.Fatalf("expected an error for %s", seed)
+		}
+	}
+}
+
+func TestOTPRoundTrip(t *testing.T) {
+	seed := "otpauth://totp/joao?secret=" + rfcSecretSHA1
+	cfg, err := config.FromYAML([]byte("mfa:\n  seed: !!otp " + seed + "\n"))
+	if err != nil {
+		t.Fatalf("could not parse config: %s", err)
+	}
+
+	item, err := cfg.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+
+	fields := item.Fields
+	var field *op.ItemField
+	for _, f := range fields {
+		if f.Label == "seed" {
+			field = f
+		}
+	}
+	if field == nil || field.Type != op.FieldTypeOTP || field.Value != seed {
+		t.Fatalf("expected seed to be an otp field, got %+v", field)
+	}
+
+	remote, err := config.FromOP(&op.Item{Title: "otp", Vault: op.ItemVault{ID: "example"}, Fields: fields})
+	if err != nil {
+		t.Fatalf("could not read item: %s", err)
+	}
+
+	entry := remote.Tree.Lookup([]string{"mfa", "seed"})
+	if entry == nil || !entry.IsOTP() || !entry.IsSecret() || entry.Value != seed {
+		t.Fatalf("otp did not round-trip, got %+v", entry)
+	}
+
+	out, err := remote.AsYAML(config.OutputModeRedacted)
+	if err != nil {
+		t.Fatalf("could not encode: %s", err)
+	}
+	if string(out) != "mfa:\n  seed: !!otp\n" {
+		t.Fatalf("unexpected redacted output: %q", out)
+	}
+
+	// fields typed as otp are one-time passwords, even without annotations
+	remote, err = config.FromOP(&op.Item{Fields: []*op.ItemField{{Label: "totp", Type: op.FieldTypeOTP, Value: seed}}})
+	if err != nil {
+		t.Fatalf("could not read item: %s", err)
+	}
+	if entry := remote.Tree.Lookup([]string{"totp"}); entry == nil || !entry.IsOTP() {
+		t.Fatalf("otp field was not read as otp, got %+v", entry)
+	}
+
+	if err := remote.Tree.OTPCodes(time.Unix(59, 0)); err != nil {
+		t.Fatalf("could not compute codes: %s", err)
+	}
+	if entry := remote.Tree.Lookup([]string{"totp"}); entry.Value != "287082" || !entry.IsSecret() {
+		t.Fatalf("unexpected code: %+v", entry)
+	}
+}
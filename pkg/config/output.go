@@ -3,11 +3,8 @@
 package config
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/fs"
-	"os"
 
 	opClient "git.rob.mx/nidito/joao/pkg/op-client"
 	op "github.com/1Password/connect-sdk-go/onepassword"
@@ -17,6 +14,11 @@ import (
 
 const YAMLTypeSecret string = "!!secret"
 const YAMLTypeMetaConfig string = "!!joao"
+const YAMLTypeRef string = "!!ref"
+const YAMLTypeGenerate string = "!!generate"
+const YAMLTypeOTP string = "!!otp"
+const YAMLTypeFile string = "!!file"
+const YAMLTypeBinary string = "!!binary"
 
 type outputOptions struct {
 	mode OutputMode
@@ -72,16 +74,33 @@ func (cfg *Config) ToMap(modes ...OutputMode) map[string]any {
 	return ret
 }
 
+// ToMap turns an entry into a dictionary or list of values, or a single value for scalars.
+func (e *Entry) ToMap(modes ...OutputMode) any {
+	defer setOutputMode(modes)()
+	return e.AsMap()
+}
+
 // ToOp turns a config into an 1Password Item.
-func (cfg *Config) ToOP() *op.Item {
+func (cfg *Config) ToOP() (*op.Item, error) {
 	sections := []*op.ItemSection{annotationsSection}
 	fields := append([]*op.ItemField{}, defaultItemFields...)
 
 	datafields := cfg.Tree.ToOP()
+	files, err := cfg.Tree.opFiles()
+	if err != nil {
+		return nil, fmt.Errorf("could not attach files: %w", err)
+	}
 	cs := opClient.Checksum(datafields)
 
 	fields[0].Value = cs
 	fields = append(fields, datafields...)
+	fields = append(fields, &op.ItemField{
+		ID:      "~annotations." + escapedLabelsAnnotation,
+		Section: annotationsSection,
+		Label:   escapedLabelsAnnotation,
+		Type:    op.FieldTypeString,
+		Value:   "escaped",
+	})
 
 	for i := 0; i < len(cfg.Tree.Content); i += 2 {
 		value := cfg.Tree.Content[i+1]
@@ -103,7 +122,8 @@ func (cfg *Config) ToOP() *op.Item {
 		Vault:    op.ItemVault{ID: cfg.Vault},
 		Category: op.Password,
 		Fields:   fields,
-	}
+		Files:    files,
+	}, nil
 }
 
 // MarshalYAML implements `yaml.Marshal“.
@@ -113,23 +133,30 @@ func (cfg *Config) MarshalYAML() (any, error) {
 
 // AsYAML returns the config encoded as YAML.
 func (cfg *Config) AsYAML(modes ...OutputMode) ([]byte, error) {
+	return cfg.Encode(CodecYAML, modes...)
+}
+
+// Encode returns the config encoded with codec.
+func (cfg *Config) Encode(codec *Codec, modes ...OutputMode) ([]byte, error) {
 	defer setOutputMode(modes)()
-	logrus.Debugf("Printing as yaml with modes %v", yamlOutput)
+	logrus.Debugf("Printing as %s with modes %v", codec.Name, yamlOutput)
 
-	var out bytes.Buffer
-	enc := yaml.NewEncoder(&out)
-	enc.SetIndent(2)
-	if err := enc.Encode(cfg); err != nil {
-		return nil, fmt.Errorf("could not serialize config as yaml: %w", err)
+	out, err := codec.Encode(cfg.Tree)
+	if err != nil {
+		return nil, fmt.Errorf("could not serialize config as %s: %w", codec.Name, err)
 	}
-	return out.Bytes(), nil
+	return out, nil
 }
 
 // AsJSON returns the config enconded as JSON, optionally encoding as a 1Password item.
 func (cfg *Config) AsJSON(redacted bool, item bool) ([]byte, error) {
 	var repr any
 	if item {
-		repr = cfg.ToOP()
+		opItem, err := cfg.ToOP()
+		if err != nil {
+			return nil, err
+		}
+		repr = opItem
 	} else {
 		modes := []OutputMode{OutputModeNoConfig}
 		if redacted {
@@ -146,20 +173,12 @@ func (cfg *Config) AsJSON(redacted bool, item bool) ([]byte, error) {
 	return bytes, nil
 }
 
+// AsFile writes the config to path, encoded in the format its extension names.
 func (cfg *Config) AsFile(path string, modes ...OutputMode) error {
-	b, err := cfg.AsYAML(modes...)
+	b, err := cfg.Encode(CodecFor(path), modes...)
 	if err != nil {
 		return err
 	}
 
-	var mode fs.FileMode = 0644
-	if info, err := os.Stat(path); err == nil {
-		mode = info.Mode().Perm()
-	}
-
-	if err := os.WriteFile(path, b, mode); err != nil {
-		return fmt.Errorf("could not save config to file %s: %w", path, err)
-	}
-
-	return nil
+	return writeConfigFile(path, b)
 }
@@ -0,0 +1,129 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
+)
+
+// EscapeKey escapes a single key, so it's read back as-is by SplitPath.
+func EscapeKey(key string) string {
+	return opclient.EscapeKey(key)
+}
+
+// JoinPath returns the dot-delimited query for path, escaping dots within keys as `\.`. Queries are used as labels
+// for 1Password fields and annotations, too.
+func JoinPath(path []string) string {
+	escaped := make([]string, len(path))
+	for idx, key := range path {
+		escaped[idx] = EscapeKey(key)
+	}
+	return strings.Join(escaped, ".")
+}
+
+// SplitPath returns the keys a dot-delimited query is made of. Keys containing dots are either escaped, as in
+// `hosts.example\.com`, or quoted within brackets, as in `hosts["example.com"]`, and list indices may also be
+// written as `roles[0]`. Both empty and `.` queries refer to the whole tree.
+func SplitPath(query string) ([]string, error) {
+	path := []string{}
+	if query == "" || query == "." {
+		return path, nil
+	}
+
+	key := strings.Builder{}
+	// pending tells a key is being read, closed that a bracketed one was just read
+	pending, closed := false, false
+	for idx := 0; idx < len(query); idx++ {
+		switch char := query[idx]; char {
+		case '\\':
+			if idx+1 == len(query) {
+				return nil, fmt.Errorf("invalid query %s: trailing backslash", query)
+			}
+			idx++
+			key.WriteByte(query[idx])
+			pending, closed = true, false
+		case '.':
+			if !pending && !closed {
+				return nil, fmt.Errorf("invalid query %s: empty key at %d", query, idx)
+			}
+			if pending {
+				path = append(path, key.String())
+				key.Reset()
+			}
+			pending, closed = false, false
+			if idx+1 == len(query) {
+				return nil, fmt.Errorf("invalid query %s: trailing dot", query)
+			}
+		case '[':
+			if pending {
+				path = append(path, key.String())
+				key.Reset()
+			}
+
+			bracketed, end, err := bracketKey(query, idx)
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, bracketed)
+			idx = end
+			pending, closed = false, true
+		default:
+			if closed {
+				return nil, fmt.Errorf("invalid query %s: expected a dot after ] at %d", query, idx-1)
+			}
+			key.WriteByte(char)
+			pending = true
+		}
+	}
+
+	if pending {
+		path = append(path, key.String())
+	}
+	return path, nil
+}
+
+// bracketKey reads the key within the bracket opened at start of query, either a quoted string or a list index,
+// and returns it along with the position of the closing bracket.
+func bracketKey(query string, start int) (string, int, error) {
+	end := strings.IndexByte(query[start:], ']')
+	if end == -1 {
+		return "", 0, fmt.Errorf("invalid query %s: unclosed bracket at %d", query, start)
+	}
+	end += start
+
+	inner := query[start+1 : end]
+	if inner == "" {
+		return "", 0, fmt.Errorf("invalid query %s: empty brackets at %d", query, start)
+	}
+
+	if quote := inner[0]; quote != '"' && quote != '\'' {
+		if !isNumeric(inner) {
+			return "", 0, fmt.Errorf("invalid query %s: brackets hold quoted keys or list indices, got %s", query, inner)
+		}
+		return inner, end, nil
+	}
+
+	quote := query[start+1]
+	key := strings.Builder{}
+	for idx := start + 2; idx < len(query); idx++ {
+		switch char := query[idx]; char {
+		case '\\':
+			if idx+1 < len(query) {
+				idx++
+				key.WriteByte(query[idx])
+			}
+		case quote:
+			if idx+1 == len(query) || query[idx+1] != ']' {
+				return "", 0, fmt.Errorf("invalid query %s: expected ] after the quoted key at %d", query, idx)
+			}
+			return key.String(), idx + 1, nil
+		default:
+			key.WriteByte(char)
+		}
+	}
+
+	return "", 0, fmt.Errorf("invalid query %s: unterminated quoted key at %d", query, start+1)
+}
@@ -0,0 +1,63 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+func TestSplitPath(t *testing.T) {
+	for query, expected := range map[string][]string{
+		"":                                 {},
+		".":                                {},
+		"tls.cert":                         {"tls", "cert"},
+		"roles.0":                          {"roles", "0"},
+		"roles[0]":                         {"roles", "0"},
+		`hosts.example\.com.address`:       {"hosts", "example.com", "address"},
+		`hosts["example.com"].address`:     {"hosts", "example.com", "address"},
+		`labels['app.kubernetes.io/name']`: {"labels", "app.kubernetes.io/name"},
+		`["a.b"]["c"][1]`:                  {"a.b", "c", "1"},
+		`quoted["say \"hi\""]`:             {"quoted", `say "hi"`},
+		`back\\slash`:                      {`back\slash`},
+		`bracket\[0]`:                      {"bracket[0]"},
+	} {
+		got, err := config.SplitPath(query)
+		if err != nil {
+			t.Fatalf("could not split %s: %s", query, err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("unexpected keys for %s: wanted %q, got %q", query, expected, got)
+		}
+	}
+
+	for _, query := range []string{"a..b", "a.", ".a", `a\`, "a[b]", "a[", `a["b`, `a["b"]c`, "a[]"} {
+		if _, err := config.SplitPath(query); err == nil {
+			t.Fatalf("expected an error splitting %s", query)
+		}
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	for _, path := range [][]string{
+		{"tls", "cert"},
+		{"hosts", "example.com", "address"},
+		{"labels", "app.kubernetes.io/name"},
+		{`back\slash`, "bracket[0]"},
+	} {
+		query := config.JoinPath(path)
+		got, err := config.SplitPath(query)
+		if err != nil {
+			t.Fatalf("could not split %s: %s", query, err)
+		}
+		if !reflect.DeepEqual(got, path) {
+			t.Fatalf("%q did not round-trip through %s, got %q", path, query, got)
+		}
+	}
+
+	if got := config.JoinPath([]string{"hosts", "example.com"}); got != `hosts.example\.com` {
+		t.Fatalf("unexpected query: %s", got)
+	}
+}
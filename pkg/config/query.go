@@ -0,0 +1,608 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Query selects entries from a tree. Besides the dot-delimited keys understood by SplitPath, queries may use
+// wildcards (`hosts.*.address`), recursive descent (`..password`), list indices counting from the end
+// (`roles[-1]`), slices (`roles[1:3]`) and filters (`roles[?(@ == "http")]`, `servers[?(@.port >= 8000)]`).
+// Filters never compare secrets, as matching would reveal their values even when output is redacted.
+type Query struct {
+	raw   string
+	steps []*queryStep
+}
+
+type stepKind int
+
+const (
+	stepKey stepKind = iota
+	stepWildcard
+	stepIndex
+	stepSlice
+	stepFilter
+)
+
+// queryStep selects entries below the ones matched by the previous step.
+type queryStep struct {
+	kind stepKind
+	// recursive applies the step to every entry below the previous ones, too.
+	recursive bool
+	key       string
+	index     int
+	// slice holds the start, end and step of slices, nil when omitted.
+	slice  [3]*int
+	filter filterExpr
+}
+
+// filterExpr tells if an entry matches a filter.
+type filterExpr func(e *Entry) bool
+
+// operand is a value found while evaluating filters.
+type operand struct {
+	value  string
+	found  bool
+	scalar bool
+	secret bool
+}
+
+// ParseQuery reads a query. Both empty and `.` queries select the whole tree.
+func ParseQuery(query string) (*Query, error) {
+	q := &Query{raw: query, steps: []*queryStep{}}
+	if query == "" || query == "." {
+		return q, nil
+	}
+
+	p := &queryParser{query: query}
+	for !p.done() {
+		recursive := false
+		switch {
+		case strings.HasPrefix(p.rest(), ".."):
+			p.pos += 2
+			recursive = true
+		case p.peek() == '.':
+			if len(q.steps) == 0 {
+				return nil, p.errorf("empty key")
+			}
+			p.pos++
+		case p.peek() == '[':
+		default:
+			if len(q.steps) > 0 {
+				return nil, p.errorf("expected a dot")
+			}
+		}
+
+		step, err := p.step()
+		if err != nil {
+			return nil, err
+		}
+		step.recursive = recursive
+		q.steps = append(q.steps, step)
+	}
+
+	return q, nil
+}
+
+func (q *Query) String() string {
+	return q.raw
+}
+
+// Definite tells if q points to a single value, selecting keys and list indices alone.
+func (q *Query) Definite() bool {
+	for _, step := range q.steps {
+		if step.recursive || (step.kind != stepKey && step.kind != stepIndex) {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the entries below root matching q, in order.
+func (q *Query) Select(root *Entry) []*Entry {
+	current := []*Entry{root}
+	for _, step := range q.steps {
+		next := []*Entry{}
+		for _, e := range current {
+			candidates := []*Entry{e}
+			if step.recursive {
+				candidates = e.descendants()
+			}
+
+			for _, candidate := range candidates {
+				next = append(next, step.apply(candidate)...)
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// Get returns the entry q points to below root for definite queries, or a list holding every entry matching it
+// otherwise. Matches keep their tags, so secrets are still redacted when output.
+func (q *Query) Get(root *Entry) (*Entry, error) {
+	matches := q.Select(root)
+	if q.Definite() {
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("value not found at %s", q)
+		}
+		return matches[0], nil
+	}
+
+	list := NewEntry("", yaml.SequenceNode)
+	list.Tag = "!!seq"
+	list.Content = matches
+	return list, nil
+}
+
+// descendants returns e and every entry below it, skipping joao's own config.
+func (e *Entry) descendants() []*Entry {
+	found := []*Entry{e}
+	for _, child := range e.children() {
+		found = append(found, child.descendants()...)
+	}
+	return found
+}
+
+func (step *queryStep) apply(e *Entry) []*Entry {
+	if e.IsScalar() {
+		return nil
+	}
+
+	switch step.kind {
+	case stepWildcard:
+		return e.children()
+	case stepIndex:
+		if e.Kind != yaml.SequenceNode {
+			if child := e.ChildNamed(strconv.Itoa(step.index)); child != nil && step.index >= 0 {
+				return []*Entry{child}
+			}
+			return nil
+		}
+
+		index := step.index
+		if index < 0 {
+			index += len(e.Content)
+		}
+		if index < 0 || index >= len(e.Content) {
+			return nil
+		}
+		return []*Entry{e.Content[index]}
+	case stepSlice:
+		if e.Kind != yaml.SequenceNode {
+			return nil
+		}
+		return sliceOf(e.Content, step.slice)
+	case stepFilter:
+		matches := []*Entry{}
+		for _, child := range e.children() {
+			if step.filter(child) {
+				matches = append(matches, child)
+			}
+		}
+		return matches
+	}
+
+	if child := e.ChildNamed(step.key); child != nil {
+		return []*Entry{child}
+	}
+	return nil
+}
+
+// sliceOf returns the items between start and end of a list, every step items, counting negative bounds from its end.
+func sliceOf(items []*Entry, bounds [3]*int) []*Entry {
+	clamp := func(bound *int, fallback int) int {
+		if bound == nil {
+			return fallback
+		}
+		value := *bound
+		if value < 0 {
+			value += len(items)
+		}
+		return min(max(value, 0), len(items))
+	}
+
+	start, end, step := clamp(bounds[0], 0), clamp(bounds[1], len(items)), 1
+	if bounds[2] != nil {
+		step = *bounds[2]
+	}
+
+	selected := []*Entry{}
+	for idx := start; idx < end; idx += step {
+		selected = append(selected, items[idx])
+	}
+	return selected
+}
+
+// queryParser reads queries, keeping track of the position it's at.
+type queryParser struct {
+	query string
+	pos   int
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid query %s: %s at %d", p.query, fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *queryParser) done() bool {
+	return p.pos >= len(p.query)
+}
+
+func (p *queryParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.query[p.pos]
+}
+
+func (p *queryParser) rest() string {
+	return p.query[p.pos:]
+}
+
+func (p *queryParser) skipSpaces() {
+	for p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+func (p *queryParser) expect(token string) error {
+	p.skipSpaces()
+	if !strings.HasPrefix(p.rest(), token) {
+		return p.errorf("expected %s", token)
+	}
+	p.pos += len(token)
+	return nil
+}
+
+// step reads a key, a wildcard, or a bracketed step.
+func (p *queryParser) step() (*queryStep, error) {
+	if p.peek() == '[' {
+		return p.bracket()
+	}
+
+	key := strings.Builder{}
+	escaped := false
+	for !p.done() && p.peek() != '.' && p.peek() != '[' {
+		if p.peek() == '\\' {
+			if p.pos+1 == len(p.query) {
+				return nil, p.errorf("trailing backslash")
+			}
+			p.pos++
+			escaped = true
+		}
+		key.WriteByte(p.peek())
+		p.pos++
+	}
+
+	if key.Len() == 0 {
+		return nil, p.errorf("empty key")
+	}
+
+	if key.String() == "*" && !escaped {
+		return &queryStep{kind: stepWildcard}, nil
+	}
+	return &queryStep{kind: stepKey, key: key.String()}, nil
+}
+
+// bracket reads a quoted key, wildcard, index, slice or filter within brackets.
+func (p *queryParser) bracket() (*queryStep, error) {
+	p.pos++
+	p.skipSpaces()
+
+	var step *queryStep
+	switch char := p.peek(); {
+	case char == '"' || char == '\'':
+		key, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		step = &queryStep{kind: stepKey, key: key}
+	case char == '*':
+		p.pos++
+		step = &queryStep{kind: stepWildcard}
+	case char == '?':
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		filter, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		step = &queryStep{kind: stepFilter, filter: filter}
+	default:
+		end := strings.IndexByte(p.rest(), ']')
+		if end == -1 {
+			return nil, p.errorf("unclosed bracket")
+		}
+		inner := strings.TrimSpace(p.rest()[0:end])
+		var err error
+		if step, err = p.indexOrSlice(inner); err != nil {
+			return nil, err
+		}
+		p.pos += end
+	}
+
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	return step, nil
+}
+
+// indexOrSlice reads list indices, as in `[-1]`, and slices, as in `[1:]` or `[::2]`.
+func (p *queryParser) indexOrSlice(inner string) (*queryStep, error) {
+	if !strings.Contains(inner, ":") {
+		index, err := strconv.Atoi(inner)
+		if err != nil {
+			return nil, p.errorf("brackets hold quoted keys, wildcards, list indices, slices or filters, got %s", inner)
+		}
+		return &queryStep{kind: stepIndex, index: index}, nil
+	}
+
+	parts := strings.Split(inner, ":")
+	if len(parts) > 3 {
+		return nil, p.errorf("slices take a start, end and step at most, got %s", inner)
+	}
+
+	step := &queryStep{kind: stepSlice}
+	for idx, part := range parts {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		bound, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, p.errorf("invalid slice %s", inner)
+		}
+		step.slice[idx] = &bound
+	}
+
+	if step.slice[2] != nil && *step.slice[2] <= 0 {
+		return nil, p.errorf("slice steps must be positive, got %s", inner)
+	}
+	return step, nil
+}
+
+// quoted reads a string within single or double quotes, where backslashes escape the next character.
+func (p *queryParser) quoted() (string, error) {
+	quote := p.peek()
+	start := p.pos
+	p.pos++
+
+	value := strings.Builder{}
+	for !p.done() {
+		switch char := p.peek(); char {
+		case '\\':
+			p.pos++
+			if !p.done() {
+				value.WriteByte(p.peek())
+			}
+		case quote:
+			p.pos++
+			return value.String(), nil
+		default:
+			value.WriteByte(char)
+		}
+		p.pos++
+	}
+
+	p.pos = start
+	return "", p.errorf("unterminated string")
+}
+
+// or reads filters joined by `||`.
+func (p *queryParser) or() (filterExpr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.skipSpaces(); strings.HasPrefix(p.rest(), "||"); p.skipSpaces() {
+		p.pos += 2
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		previous := left
+		left = func(e *Entry) bool { return previous(e) || right(e) }
+	}
+	return left, nil
+}
+
+// and reads filters joined by `&&`.
+func (p *queryParser) and() (filterExpr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.skipSpaces(); strings.HasPrefix(p.rest(), "&&"); p.skipSpaces() {
+		p.pos += 2
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		previous := left
+		left = func(e *Entry) bool { return previous(e) && right(e) }
+	}
+	return left, nil
+}
+
+// unary reads negated or parenthesized filters, and comparisons.
+func (p *queryParser) unary() (filterExpr, error) {
+	p.skipSpaces()
+	switch p.peek() {
+	case '!':
+		p.pos++
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *Entry) bool { return !inner(e) }, nil
+	case '(':
+		p.pos++
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+
+	return p.comparison()
+}
+
+var comparisonOperators = []string{"==", "!=", "<=", ">=", "=~", "<", ">"}
+
+// comparison reads `operand OPERATOR operand`, or a lone operand that matches when found.
+func (p *queryParser) comparison() (filterExpr, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	operator := ""
+	for _, candidate := range comparisonOperators {
+		if strings.HasPrefix(p.rest(), candidate) {
+			operator = candidate
+			p.pos += len(candidate)
+			break
+		}
+	}
+
+	if operator == "" {
+		return func(e *Entry) bool { return left(e).found }, nil
+	}
+
+	p.skipSpaces()
+	if operator == "=~" {
+		if quote := p.peek(); quote != '"' && quote != '\'' {
+			return nil, p.errorf("expected a quoted regular expression")
+		}
+		pattern, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		expr, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, p.errorf("invalid regular expression %s: %s", pattern, err)
+		}
+		return func(e *Entry) bool {
+			value := left(e)
+			return value.scalar && !value.secret && expr.MatchString(value.value)
+		}, nil
+	}
+
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(e *Entry) bool {
+		a, b := left(e), right(e)
+		if a.secret || b.secret {
+			return false
+		}
+
+		if !a.scalar || !b.scalar {
+			return operator == "!="
+		}
+
+		cmp := compareValues(a.value, b.value)
+		switch operator {
+		case "==":
+			return cmp == 0
+		case "!=":
+			return cmp != 0
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		}
+		return cmp >= 0
+	}, nil
+}
+
+// operand reads `@`, optionally followed by a path below it, or a literal string, number or boolean.
+func (p *queryParser) operand() (func(e *Entry) operand, error) {
+	p.skipSpaces()
+	switch char := p.peek(); {
+	case char == '@':
+		p.pos++
+		start := p.pos
+		for !p.done() && !strings.ContainsRune(" =!<>&|)", rune(p.peek())) {
+			if quote := p.peek(); quote == '"' || quote == '\'' {
+				if _, err := p.quoted(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if p.peek() == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+
+		path, err := SplitPath(strings.TrimPrefix(p.query[start:p.pos], "."))
+		if err != nil {
+			return nil, err
+		}
+		return func(e *Entry) operand {
+			found := e.Lookup(path)
+			if found == nil {
+				return operand{}
+			}
+			return operand{value: found.Value, found: true, scalar: found.IsScalar(), secret: found.IsSecret()}
+		}, nil
+	case char == '"' || char == '\'':
+		value, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return literal(value), nil
+	}
+
+	start := p.pos
+	for !p.done() && (p.peek() == '-' || p.peek() == '.' || p.peek() == '_' || (p.peek() >= '0' && p.peek() <= '9') || (p.peek() >= 'a' && p.peek() <= 'z')) {
+		p.pos++
+	}
+
+	value := p.query[start:p.pos]
+	if _, err := strconv.ParseFloat(value, 64); err != nil && value != "true" && value != "false" && value != "null" {
+		p.pos = start
+		return nil, p.errorf("expected @, a quoted string, a number or a boolean")
+	}
+	return literal(value), nil
+}
+
+func literal(value string) func(e *Entry) operand {
+	return func(e *Entry) operand {
+		return operand{value: value, found: true, scalar: true}
+	}
+}
+
+// compareValues compares values as numbers if both are, or as strings otherwise.
+func compareValues(a, b string) int {
+	if x, err := strconv.ParseFloat(a, 64); err == nil {
+		if y, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
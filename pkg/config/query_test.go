@@ -0,0 +1,126 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"reflect"
+	"testing"
+
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+const queryYAML = `_config: !!joao
+  vault: example
+  name: query
+password: !!secret root
+hosts:
+  example.com:
+    address: 10.0.0.1
+    password: !!secret first
+  example.org:
+    address: 10.0.0.2
+roles: [consul-client, http, https, nomad]
+servers:
+  - host: web-1
+    port: 8080
+  - host: web-2
+    port: 80
+  - host: db-1
+    port: 5432
+    tls: true
+`
+
+func TestQuerySelect(t *testing.T) {
+	cfg, err := config.FromYAML([]byte(queryYAML))
+	if err != nil {
+		t.Fatalf("could not parse config: %s", err)
+	}
+
+	for query, expected := range map[string][]string{
+		"roles.1":                         {"http"},
+		"roles[-1]":                       {"nomad"},
+		"roles[1:3]":                      {"http", "https"},
+		"roles[::2]":                      {"consul-client", "https"},
+		"roles[-2:]":                      {"https", "nomad"},
+		"hosts.*.address":                 {"10.0.0.1", "10.0.0.2"},
+		`hosts["example.com"].*`:          {"10.0.0.1", "first"},
+		"..password":                      {"root", "first"},
+		"servers[*].host":                 {"web-1", "web-2", "db-1"},
+		`roles[?(@ == "http")]`:           {"http"},
+		`roles[?(@ =~ "^http")]`:          {"http", "https"},
+		`roles[?(!(@ =~ "http"))]`:        {"consul-client", "nomad"},
+		"servers[?(@.port >= 8000)].host": {"web-1"},
+		`servers[?(@.port < 1000 || @.host == "db-1")].host`:  {"web-2", "db-1"},
+		`servers[?(@.tls)].host`:                              {"db-1"},
+		`servers[?(@.port != 80 && @["host"] =~ "web")].port`: {"8080"},
+		`..[?(@.address == '10.0.0.2')].address`:              {"10.0.0.2"},
+		"missing.*":                                           {},
+		// secrets are never compared, not to reveal their values
+		`..[?(@ == "root")]`:                     {},
+		`hosts[?(@.password != "nope")].address`: {"10.0.0.2"},
+		`hosts[?(@.password =~ "^f")].address`:   {},
+		`hosts[?(@.password)].address`:           {"10.0.0.1"},
+	} {
+		q, err := config.ParseQuery(query)
+		if err != nil {
+			t.Fatalf("could not parse %s: %s", query, err)
+		}
+
+		got := []string{}
+		for _, entry := range q.Select(cfg.Tree) {
+			got = append(got, entry.Value)
+		}
+
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("unexpected values for %s: wanted %q, got %q", query, expected, got)
+		}
+	}
+}
+
+func TestQueryGet(t *testing.T) {
+	cfg, err := config.FromYAML([]byte(queryYAML))
+	if err != nil {
+		t.Fatalf("could not parse config: %s", err)
+	}
+
+	q, _ := config.ParseQuery("hosts.example\\.com.password")
+	if !q.Definite() {
+		t.Fatal("expected query to be definite")
+	}
+	entry, err := q.Get(cfg.Tree)
+	if err != nil || entry.Value != "first" || !entry.IsSecret() {
+		t.Fatalf("unexpected entry %+v: %v", entry, err)
+	}
+
+	q, _ = config.ParseQuery("hosts.example\\.net")
+	if _, err := q.Get(cfg.Tree); err == nil || err.Error() != `value not found at hosts.example\.net` {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	q, _ = config.ParseQuery("..password")
+	if q.Definite() {
+		t.Fatal("expected recursive query not to be definite")
+	}
+	entry, err = q.Get(cfg.Tree)
+	if err != nil {
+		t.Fatalf("could not get: %s", err)
+	}
+
+	if got := entry.ToMap(config.OutputModeRedacted); !reflect.DeepEqual(got, []any{"", ""}) {
+		t.Fatalf("expected secrets to be redacted, got %v", got)
+	}
+	if got := entry.ToMap(); !reflect.DeepEqual(got, []any{"root", "first"}) {
+		t.Fatalf("unexpected values, got %v", got)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"a..", "a.", ".a", "a[", "a[b]", `a["b`, "a[1:2:3:4]", "a[::0]", "a[?(@ == )]", "a[?(@ == b)]",
+		`a[?(@ =~ "(")]`, "a[?(@ == 1]", "a[0]b",
+	} {
+		if _, err := config.ParseQuery(query); err == nil {
+			t.Fatalf("expected an error parsing %s", query)
+		}
+	}
+}
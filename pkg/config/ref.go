@@ -0,0 +1,261 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	opClient "git.rob.mx/nidito/joao/pkg/op-client"
+	op "github.com/1Password/connect-sdk-go/onepassword"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorReferenceCycle is returned when references end up pointing back to themselves.
+var ErrorReferenceCycle = fmt.Errorf("reference cycle")
+
+// refAnnotation prefixes the 1Password item a file reference points to, in the ~annotations of an item.
+const refAnnotation = "ref"
+
+func (e *Entry) IsRef() bool {
+	return e.Tag == YAMLTypeRef
+}
+
+// splitFileRef splits a `path/to/file.yaml#dotted.query` reference into its path and keys.
+func splitFileRef(ref string) (string, []string, error) {
+	path, query, _ := strings.Cut(ref, "#")
+	keys, err := SplitPath(query)
+	return path, keys, err
+}
+
+// refFile returns the absolute path to the file a reference found in file points to.
+func refFile(ref, file string) string {
+	path, _, _ := splitFileRef(ref)
+	if path == "" {
+		return file
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(file), path)
+	}
+	return path
+}
+
+// linkRefs points file references below e, found in file, to the 1Password item they'd be read from, so they can
+// be resolved without the filesystem.
+func (e *Entry) linkRefs(file string) {
+	if !e.IsRef() {
+		for _, child := range e.Content {
+			child.linkRefs(file)
+		}
+		return
+	}
+
+	if IsOPReference(e.Value) {
+		return
+	}
+
+	target := refFile(e.Value, file)
+	name, vault, err := VaultAndNameFrom(target, nil)
+	if err != nil {
+		logrus.Debugf("could not find the item %s at %s points to: %s", e.Value, strings.Join(e.Path, "."), err)
+		return
+	}
+	_, keys, err := splitFileRef(e.Value)
+	if err != nil {
+		logrus.Debugf("could not read the reference at %s: %s", JoinPath(e.Path), err)
+		return
+	}
+	e.refTarget = (&OPReference{Vault: vault, Item: name, Path: keys}).String()
+}
+
+// refAnnotationValue returns the annotation stored for a reference in 1Password.
+func (e *Entry) refAnnotationValue() string {
+	if e.refTarget != "" {
+		return refAnnotation + ":" + e.refTarget
+	}
+	return refAnnotation
+}
+
+// parseRefAnnotation tells if annotation marks a reference, and the item it points to, if known.
+func parseRefAnnotation(annotation string) (target string, isRef bool) {
+	if annotation == refAnnotation {
+		return "", true
+	}
+	if target, found := strings.CutPrefix(annotation, refAnnotation+":"); found {
+		return target, true
+	}
+	return "", false
+}
+
+// RefResolver replaces `!!ref` values with copies of the values they point to, caching the configs read.
+type RefResolver struct {
+	// Remote reads file references from their 1Password items instead of the filesystem.
+	Remote bool
+	// Items fetches 1Password items for `op://` references.
+	Items   func(vault, name string) (*op.Item, error)
+	configs map[string]*Config
+}
+
+func NewRefResolver(remote bool) *RefResolver {
+	return &RefResolver{
+		Remote:  remote,
+		Items:   opClient.Get,
+		configs: map[string]*Config{},
+	}
+}
+
+// ResolveConfig resolves references in cfg, loaded from ref: either a path to a file or a 1Password item.
+func (r *RefResolver) ResolveConfig(cfg *Config, ref string) error {
+	file := ""
+	if argIsConfigFile(ref) {
+		var err error
+		if file, err = filepath.Abs(ref); err != nil {
+			return err
+		}
+	}
+	return r.Resolve(cfg.Tree, file)
+}
+
+// Resolve replaces references below entry, read from file, with the values they point to. File references are
+// relative to file, or resolved through their 1Password annotations if file is empty.
+func (r *RefResolver) Resolve(entry *Entry, file string) error {
+	return r.resolve(entry, file, []string{})
+}
+
+func (r *RefResolver) resolve(e *Entry, file string, stack []string) error {
+	if !e.IsRef() {
+		for _, child := range e.Content {
+			if err := r.resolve(child, file, stack); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if e.origin != "" && file != "" {
+		// inherited references are relative to the file they were inherited from
+		file = e.origin
+	}
+
+	key, target, targetFile, err := r.target(e, file)
+	if err != nil {
+		return fmt.Errorf("could not resolve %s at %s: %w", e.Value, strings.Join(e.Path, "."), err)
+	}
+
+	stack = append(append([]string{}, stack...), key)
+	for _, seen := range stack[0 : len(stack)-1] {
+		if seen == key {
+			return fmt.Errorf("%w: %s", ErrorReferenceCycle, strings.Join(stack, " -> "))
+		}
+	}
+
+	resolved := target.clone()
+	if err := r.resolve(resolved, targetFile, stack); err != nil {
+		return err
+	}
+
+	e.Kind = resolved.Kind
+	e.Value = resolved.Value
+	e.Tag = resolved.Tag
+	e.Type = resolved.Type
+	e.Style = resolved.Style
+	e.Content = resolved.Content
+	e.refTarget = ""
+	if len(e.Path) > 0 {
+		e.SetPath(e.Path[0:len(e.Path)-1], e.Path[len(e.Path)-1])
+	}
+	return nil
+}
+
+// target returns the key identifying the value a reference points to, the value itself, and the file it was read
+// from, if any.
+func (r *RefResolver) target(e *Entry, file string) (string, *Entry, string, error) {
+	if IsOPReference(e.Value) {
+		return r.itemTarget(e.Value)
+	}
+
+	if file == "" {
+		if e.refTarget != "" {
+			return r.itemTarget(e.refTarget)
+		}
+		return "", nil, "", fmt.Errorf("file references can only be resolved from files")
+	}
+
+	path := refFile(e.Value, file)
+	_, keys, err := splitFileRef(e.Value)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if len(keys) == 0 {
+		return "", nil, "", fmt.Errorf("references must point to a key, as FILE#dotted.path")
+	}
+
+	cfg, err := r.config(path)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	entry := cfg.Tree.Lookup(keys)
+	if entry == nil {
+		return "", nil, "", fmt.Errorf("value not found at %s of %s", JoinPath(keys), path)
+	}
+
+	targetFile := path
+	if r.Remote {
+		targetFile = ""
+	}
+	return path + "#" + JoinPath(keys), entry, targetFile, nil
+}
+
+func (r *RefResolver) itemTarget(ref string) (string, *Entry, string, error) {
+	opRef, err := ParseOPReference(ref)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	cfg, err := r.item(opRef.Vault, opRef.Item)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	entry := cfg.Tree.Lookup(opRef.Path)
+	if entry == nil {
+		return "", nil, "", fmt.Errorf("value not found at %s", opRef)
+	}
+	return opRef.String(), entry, "", nil
+}
+
+// config returns the config at path, loading it only once.
+func (r *RefResolver) config(path string) (*Config, error) {
+	if cfg, ok := r.configs[path]; ok {
+		return cfg, nil
+	}
+
+	cfg, err := Load(path, r.Remote)
+	if err != nil {
+		return nil, err
+	}
+	r.configs[path] = cfg
+	return cfg, nil
+}
+
+// item returns the config stored at a 1Password item, fetching it only once.
+func (r *RefResolver) item(vault, name string) (*Config, error) {
+	key := OPReferencePrefix + vault + "/" + name
+	if cfg, ok := r.configs[key]; ok {
+		return cfg, nil
+	}
+
+	item, err := r.Items(vault, name)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch %s: %w", key, err)
+	}
+
+	cfg, err := FromOP(item)
+	if err != nil {
+		return nil, err
+	}
+	r.configs[key] = cfg
+	return cfg, nil
+}
@@ -0,0 +1,279 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.rob.mx/nidito/joao/pkg/config"
+	op "github.com/1Password/connect-sdk-go/onepassword"
+)
+
+func refFixtures(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := refFixturesIn(dir, files); err != nil {
+		t.Fatalf("could not write fixture: %s", err)
+	}
+	return dir
+}
+
+func refFixturesIn(dir string, files map[string]string) error {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const refShared = `_config: !!joao
+  vault: example
+  name: shared
+consul:
+  address: consul.example.com
+  port: 8500
+ca: !!secret -----BEGIN CERTIFICATE-----
+`
+
+const refApp = `_config: !!joao
+  vault: example
+  name: app
+consul: !!ref shared.yaml#consul.address
+ca: !!ref shared.yaml#ca
+upstream: !!ref shared.yaml#consul
+address: !!ref "#consul"
+`
+
+func TestRefResolve(t *testing.T) {
+	dir := refFixtures(t, map[string]string{"shared.yaml": refShared, "app.yaml": refApp})
+	path := filepath.Join(dir, "app.yaml")
+
+	cfg, err := config.Load(path, false)
+	if err != nil {
+		t.Fatalf("could not load: %s", err)
+	}
+
+	if err := config.NewRefResolver(false).ResolveConfig(cfg, path); err != nil {
+		t.Fatalf("could not resolve: %s", err)
+	}
+
+	got, err := cfg.AsYAML(config.OutputModeNoConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `consul: consul.example.com
+ca: !!secret '-----BEGIN CERTIFICATE-----'
+upstream:
+  address: consul.example.com
+  port: 8500
+address: consul.example.com
+`
+	if string(got) != expected {
+		t.Fatalf("unexpected resolved config.\nwanted:\n%s\n---\ngot:\n%s", expected, got)
+	}
+
+	if port := cfg.Tree.Lookup([]string{"upstream", "port"}); port == nil || port.TypeStr() != "int" || fmt.Sprint(port.Path) != "[upstream port]" {
+		t.Fatalf("unexpected resolved entry %+v", port)
+	}
+}
+
+func TestRefCycle(t *testing.T) {
+	dir := refFixtures(t, map[string]string{
+		"a.yaml": "_config: !!joao\n  vault: example\n  name: a\nx: !!ref b.yaml#y\n",
+		"b.yaml": "_config: !!joao\n  vault: example\n  name: b\ny: !!ref a.yaml#x\n",
+		"c.yaml": "_config: !!joao\n  vault: example\n  name: c\nz: !!ref \"#z\"\n",
+	})
+
+	for _, name := range []string{"a.yaml", "c.yaml"} {
+		path := filepath.Join(dir, name)
+		cfg, err := config.Load(path, false)
+		if err != nil {
+			t.Fatalf("could not load: %s", err)
+		}
+
+		err = config.NewRefResolver(false).ResolveConfig(cfg, path)
+		if !errors.Is(err, config.ErrorReferenceCycle) {
+			t.Fatalf("expected a reference cycle resolving %s, got %v", name, err)
+		}
+	}
+}
+
+func TestRefItemRoundTrip(t *testing.T) {
+	dir := refFixtures(t, map[string]string{"shared.yaml": refShared, "app.yaml": refApp})
+
+	shared, err := config.Load(filepath.Join(dir, "shared.yaml"), false)
+	if err != nil {
+		t.Fatalf("could not load: %s", err)
+	}
+	app, err := config.Load(filepath.Join(dir, "app.yaml"), false)
+	if err != nil {
+		t.Fatalf("could not load: %s", err)
+	}
+
+	item, err := app.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+	fields := map[string]*op.ItemField{}
+	for _, field := range item.Fields {
+		fields[field.ID] = field
+	}
+
+	if field := fields["consul"]; field == nil || field.Value != "shared.yaml#consul.address" || field.Type != op.FieldTypeString {
+		t.Fatalf("expected the reference to be stored, got %+v", field)
+	}
+
+	if annotation := fields["~annotations.consul"]; annotation == nil || annotation.Value != "ref:op://example/shared/consul/address" {
+		t.Fatalf("unexpected annotation %+v", annotation)
+	}
+
+	item.Vault.ID = "example"
+	remote, err := config.FromOP(item)
+	if err != nil {
+		t.Fatalf("could not read item: %s", err)
+	}
+
+	if consul := remote.Tree.ChildNamed("consul"); consul == nil || !consul.IsRef() {
+		t.Fatalf("expected reference to be restored, got %+v", consul)
+	}
+
+	// without files around, references are read from the items they point to
+	sharedItem, err := shared.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+	appItem, err := app.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+	items := map[string]*op.Item{"shared": sharedItem, "app": appItem}
+	resolver := config.NewRefResolver(false)
+	resolver.Items = func(vault, name string) (*op.Item, error) {
+		if item, ok := items[name]; ok && vault == "example" {
+			return item, nil
+		}
+		return nil, fmt.Errorf("unexpected item %s/%s", vault, name)
+	}
+
+	if err := resolver.Resolve(remote.Tree, ""); err != nil {
+		t.Fatalf("could not resolve: %s", err)
+	}
+
+	for _, key := range []string{"consul", "address"} {
+		if got := remote.Tree.ChildNamed(key).String(); got != "consul.example.com" {
+			t.Fatalf("unexpected value for %s: %s", key, got)
+		}
+	}
+
+	if ca := remote.Tree.ChildNamed("ca"); !ca.IsSecret() {
+		t.Fatalf("expected secretness to carry through, got %+v", ca)
+	}
+}
+
+func TestRefOPReference(t *testing.T) {
+	cfg, err := config.FromYAML([]byte("token: !!ref op://example/shared/ca\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared, err := config.FromYAML([]byte(refShared))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := config.NewRefResolver(false)
+	resolver.Items = func(vault, name string) (*op.Item, error) {
+		return shared.ToOP()
+	}
+
+	if err := resolver.Resolve(cfg.Tree, ""); err != nil {
+		t.Fatalf("could not resolve: %s", err)
+	}
+
+	got, err := cfg.AsYAML(config.OutputModeRedacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "token: !!secret\n" {
+		t.Fatalf("unexpected redacted output: %s", got)
+	}
+}
+
+func TestRefEscapedKeysRoundTrip(t *testing.T) {
+	dir := refFixtures(t, map[string]string{
+		"shared.yaml": "_config: !!joao\n  vault: example\n  name: shared\nlabels:\n  app.kubernetes.io/name: api\n",
+		"app.yaml":    "_config: !!joao\n  vault: example\n  name: app\nname: !!ref 'shared.yaml#labels[\"app.kubernetes.io/name\"]'\n",
+	})
+
+	shared, err := config.Load(filepath.Join(dir, "shared.yaml"), false)
+	if err != nil {
+		t.Fatalf("could not load: %s", err)
+	}
+	app, err := config.Load(filepath.Join(dir, "app.yaml"), false)
+	if err != nil {
+		t.Fatalf("could not load: %s", err)
+	}
+
+	item, err := app.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+
+	annotation := ""
+	for _, field := range item.Fields {
+		if field.ID == "~annotations.name" {
+			annotation = field.Value
+		}
+	}
+	if expected := `ref:op://example/shared/labels/app.kubernetes.io\/name`; annotation != expected {
+		t.Fatalf("unexpected annotation, wanted %s, got %s", expected, annotation)
+	}
+
+	item.Vault.ID = "example"
+	remote, err := config.FromOP(item)
+	if err != nil {
+		t.Fatalf("could not read item: %s", err)
+	}
+
+	sharedItem, err := shared.ToOP()
+	if err != nil {
+		t.Fatalf("could not convert to item: %s", err)
+	}
+	resolver := config.NewRefResolver(false)
+	resolver.Items = func(vault, name string) (*op.Item, error) {
+		if name != "shared" || vault != "example" {
+			return nil, fmt.Errorf("unexpected item %s/%s", vault, name)
+		}
+		return sharedItem, nil
+	}
+
+	if err := resolver.Resolve(remote.Tree, ""); err != nil {
+		t.Fatalf("could not resolve: %s", err)
+	}
+
+	if got := remote.Tree.ChildNamed("name").String(); got != "api" {
+		t.Fatalf("unexpected value for name: %s", got)
+	}
+
+	ref, err := config.ParseOPReference(`op://example/shared/a\\b/c\/d/e`)
+	if err != nil {
+		t.Fatalf("could not parse reference: %s", err)
+	}
+	if fmt.Sprint(ref.Path) != `[a\b c/d e]` || ref.String() != `op://example/shared/a\\b/c\/d/e` {
+		t.Fatalf("unexpected reference %+v, %s", ref.Path, ref)
+	}
+
+	if _, err := config.ParseOPReference(`op://example/shared/a\`); err == nil {
+		t.Fatal("did not fail on an unfinished escape")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	opClient "git.rob.mx/nidito/joao/pkg/op-client"
+)
+
+const OPReferencePrefix = "op://"
+
+// OPReference points to a value in a 1Password item, as `op://VAULT/ITEM/PATH/TO/KEY`.
+type OPReference struct {
+	Vault string
+	Item  string
+	Path  []string
+}
+
+func IsOPReference(ref string) bool {
+	return strings.HasPrefix(ref, OPReferencePrefix)
+}
+
+// opPathEscaper escapes slashes within keys of an `op://` reference, so they're not read as delimiters.
+var opPathEscaper = strings.NewReplacer(`\`, `\\`, `/`, `\/`)
+
+// splitOPPath splits s at slashes not escaped with a backslash, unescaping every part.
+func splitOPPath(s string) ([]string, error) {
+	parts := []string{}
+	part := strings.Builder{}
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			part.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '/':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("%s ends with an unfinished escape", s)
+	}
+	return append(parts, part.String()), nil
+}
+
+// ParseOPReference parses `op://VAULT/ITEM`, optionally followed by slash-delimited keys. Slashes and backslashes
+// within keys are escaped with a backslash, i.e. `op://VAULT/ITEM/labels/app.kubernetes.io\/name`.
+func ParseOPReference(ref string) (*OPReference, error) {
+	if !IsOPReference(ref) {
+		return nil, fmt.Errorf("%s is not an %s reference", ref, OPReferencePrefix)
+	}
+
+	parts, err := splitOPPath(strings.TrimPrefix(ref, OPReferencePrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("%s must be at least %sVAULT/ITEM", ref, OPReferencePrefix)
+	}
+
+	path := []string{}
+	for _, part := range parts[2:] {
+		if part != "" {
+			path = append(path, part)
+		}
+	}
+
+	return &OPReference{Vault: parts[0], Item: parts[1], Path: path}, nil
+}
+
+func (ref *OPReference) String() string {
+	parts := []string{ref.Vault, ref.Item}
+	for _, key := range ref.Path {
+		parts = append(parts, opPathEscaper.Replace(key))
+	}
+	return OPReferencePrefix + strings.Join(parts, "/")
+}
+
+// Load fetches the referenced item from 1Password, returning it along with the entry at the referenced path.
+func (ref *OPReference) Load() (*Config, *Entry, error) {
+	item, err := opClient.Get(ref.Vault, ref.Item)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not fetch %s: %w", ref, err)
+	}
+
+	cfg, err := FromOP(item)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry := cfg.Tree.Lookup(ref.Path)
+	if entry == nil {
+		return nil, nil, fmt.Errorf("value not found at %s", ref)
+	}
+
+	return cfg, entry, nil
+}
@@ -0,0 +1,343 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
+	op "github.com/1Password/connect-sdk-go/onepassword"
+	"gopkg.in/yaml.v3"
+)
+
+// rotatedAtPrefix labels the annotations recording when a secret was last rotated.
+const rotatedAtPrefix = "~rotated-at."
+
+// RotationPolicy tells how often, and how, a secret is rotated.
+type RotationPolicy struct {
+	// Path is the key the policy was declared for, the secret itself or one of its parents.
+	Path []string
+	// MaxAge is how long a secret may go without being rotated, zero for forever.
+	MaxAge time.Duration
+	// Generator produces new values for the secret, if known.
+	Generator *Generator
+}
+
+// ParseMaxAge reads a duration, accepting days (`90d`) and weeks (`2w`) besides time.ParseDuration's units.
+func ParseMaxAge(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if count, found := strings.CutSuffix(value, suffix); found {
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				return 0, fmt.Errorf("invalid max age %s: %w", value, err)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	age, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid max age %s: %w", value, err)
+	}
+	return age, nil
+}
+
+// secretsMeta returns the `_config.secrets` entry of cfg, creating it if asked to.
+func (cfg *Config) secretsMeta(create bool) *Entry {
+	meta := cfg.Tree.ChildNamed("_config")
+	if meta == nil {
+		if !create {
+			return nil
+		}
+		meta = NewEntry("_config", yaml.MappingNode)
+		meta.Tag = YAMLTypeMetaConfig
+		meta.Type = YAMLTypeMetaConfig
+		key := NewEntry("_config", yaml.ScalarNode)
+		key.Value = "_config"
+		key.Type = YAMLTypeMetaConfig
+		cfg.Tree.Content = append([]*Entry{key, meta}, cfg.Tree.Content...)
+	}
+
+	secrets := meta.ChildNamed("secrets")
+	if secrets == nil && create {
+		secrets = NewEntry("secrets", yaml.MappingNode)
+		key := NewEntry("secrets", yaml.ScalarNode)
+		key.Value = "secrets"
+		meta.Content = append(meta.Content, key, secrets)
+		meta.SetPath(nil, "_config")
+	}
+	return secrets
+}
+
+// recordGenerator keeps the generator of the value at path in `_config.secrets`, for rotations to use.
+func (cfg *Config) recordGenerator(path string, gen *Generator) error {
+	node := &yaml.Node{}
+	if err := node.Encode(gen); err != nil {
+		return err
+	}
+	node.Style = yaml.FlowStyle
+
+	value := &Entry{}
+	if err := node.Decode(value); err != nil {
+		return err
+	}
+
+	secrets := cfg.secretsMeta(true)
+	policy := secrets.ChildNamed(path)
+	if policy == nil {
+		policy = NewEntry(path, yaml.MappingNode)
+		key := NewEntry(path, yaml.ScalarNode)
+		key.Value = path
+		secrets.Content = append(secrets.Content, key, policy)
+	}
+
+	if existing := policy.ChildNamed("generate"); existing != nil {
+		*existing = *value
+	} else {
+		key := NewEntry("generate", yaml.ScalarNode)
+		key.Value = "generate"
+		policy.Content = append(policy.Content, key, value)
+	}
+
+	cfg.Tree.ChildNamed("_config").SetPath(nil, "_config")
+	return nil
+}
+
+// Rotation returns the rotation policy for the secret at path in cfg, a document of f. Policies are declared for
+// a key or any of its parents in `_config.secrets`, and max ages default to `_config.maxAge`, then the one in
+// `.joao.yaml`.
+func (f *File) Rotation(cfg *Config, path []string) (*RotationPolicy, error) {
+	policy := &RotationPolicy{Path: path}
+	maxAge := ""
+
+	if secrets := cfg.secretsMeta(false); secrets != nil {
+		for idx := len(path); idx > 0; idx-- {
+			key := secrets.ChildNamed(JoinPath(path[0:idx]))
+			if key == nil {
+				continue
+			}
+
+			if age := key.ChildNamed("maxAge"); age != nil && maxAge == "" {
+				maxAge = age.Value
+			}
+
+			if gen := key.ChildNamed("generate"); gen != nil && policy.Generator == nil {
+				generator, err := generatorFrom(gen)
+				if err != nil {
+					return nil, err
+				}
+				policy.Generator = generator
+				policy.Path = path[0:idx]
+			}
+		}
+	}
+
+	if meta := cfg.metaConfig(); maxAge == "" && meta != nil {
+		maxAge = meta.MaxAge
+	}
+
+	if maxAge == "" {
+		abs, err := filepath.Abs(f.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		rmc, err := findRepoConfig(abs)
+		if err != nil {
+			return nil, err
+		}
+		if rmc != nil {
+			maxAge = rmc.MaxAge
+		}
+	}
+
+	if maxAge != "" {
+		age, err := ParseMaxAge(maxAge)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", JoinPath(path), err)
+		}
+		policy.MaxAge = age
+	}
+
+	return policy, nil
+}
+
+// fieldPath returns the dot-delimited path of a field, as found in annotations.
+func fieldPath(field *op.ItemField) string {
+	if field.Section != nil && field.Section.ID != "" {
+		return EscapeKey(field.Section.Label) + "." + field.Label
+	}
+	return field.Label
+}
+
+// RotatedAt returns when every secret of item was last rotated, by path.
+func RotatedAt(item *op.Item) map[string]time.Time {
+	rotated := map[string]time.Time{}
+	if item == nil {
+		return rotated
+	}
+
+	for _, field := range item.Fields {
+		if field.Section == nil || field.Section.ID != annotationsSection.ID || !strings.HasPrefix(field.Label, rotatedAtPrefix) {
+			continue
+		}
+		if at, err := time.Parse(time.RFC3339, field.Value); err == nil {
+			rotated[strings.TrimPrefix(field.Label, rotatedAtPrefix)] = at
+		}
+	}
+	return rotated
+}
+
+// rotates tells if field holds a secret, whose rotations are tracked.
+func rotates(field *op.ItemField) bool {
+	return (field.Type == op.FieldTypeConcealed || field.Type == op.FieldTypeOTP) && field.Purpose == ""
+}
+
+// trackRotation annotates every secret of item with when it was last rotated: now, for secrets whose value differs
+// from the one in remote, or the time already recorded otherwise.
+func trackRotation(item, remote *op.Item, now time.Time) {
+	previous := map[string]string{}
+	if remote != nil {
+		for _, field := range remote.Fields {
+			if rotates(field) {
+				previous[fieldPath(field)] = field.Value
+			}
+		}
+	}
+	rotated := RotatedAt(remote)
+
+	for _, field := range item.Fields {
+		if !rotates(field) {
+			continue
+		}
+
+		path := fieldPath(field)
+		at, recorded := rotated[path]
+		if value, found := previous[path]; !found || !recorded || value != field.Value {
+			at = now
+		}
+
+		item.Fields = append(item.Fields, &op.ItemField{
+			ID:      "~annotations." + rotatedAtPrefix + path,
+			Section: annotationsSection,
+			Label:   rotatedAtPrefix + path,
+			Type:    op.FieldTypeString,
+			Value:   at.UTC().Format(time.RFC3339),
+		})
+	}
+}
+
+// Flush creates or updates the 1Password item for cfg, recording when every secret in it was last rotated.
+func (cfg *Config) Flush() error {
+	remote, err := opclient.Get(cfg.Vault, cfg.Name)
+	if err != nil {
+		if !opclient.ItemMissingError(cfg.Name, err) {
+			return fmt.Errorf("could not fetch remote 1password item to compare against: %w", err)
+		}
+		remote = nil
+	}
+
+	item, err := cfg.ToOP()
+	if err != nil {
+		return err
+	}
+	trackRotation(item, remote, time.Now())
+	return opclient.Update(cfg.Vault, cfg.Name, item)
+}
+
+// StaleSecret is a secret overdue for rotation.
+type StaleSecret struct {
+	Path []string
+	// RotatedAt is the last time the secret was rotated, zero if unknown.
+	RotatedAt time.Time
+	MaxAge    time.Duration
+}
+
+// Stale returns the secrets of cfg, a document of f, that were rotated longer ago than their max age, compared to
+// the rotations recorded in item. Secrets with no rotation recorded are always stale.
+func (f *File) Stale(cfg *Config, item *op.Item, now time.Time) ([]*StaleSecret, error) {
+	flushed, err := f.Flushed(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := RotatedAt(item)
+	stale := []*StaleSecret{}
+	var check func(e *Entry) error
+	check = func(e *Entry) error {
+		if e.IsFile() {
+			// files are attached to items, and their rotations aren't recorded
+			return nil
+		}
+
+		if e.IsSecret() {
+			policy, err := f.Rotation(cfg, e.Path)
+			if err != nil {
+				return err
+			}
+
+			at, recorded := rotated[JoinPath(e.Path)]
+			if policy.MaxAge > 0 && (!recorded || now.Sub(at) > policy.MaxAge) {
+				stale = append(stale, &StaleSecret{Path: e.Path, RotatedAt: at, MaxAge: policy.MaxAge})
+			}
+			return nil
+		}
+
+		for idx, child := range e.Content {
+			if (e.Kind == yaml.MappingNode || e.Kind == yaml.DocumentNode) && (idx%2 == 0 || child.Type == YAMLTypeMetaConfig) {
+				continue
+			}
+			if err := check(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := check(flushed.Tree); err != nil {
+		return nil, err
+	}
+	return stale, nil
+}
+
+// Rotate replaces the secret at path with values from generator, or the one configured for it.
+func (f *File) Rotate(cfg *Config, path []string, generator *Generator) error {
+	policy, err := f.Rotation(cfg, path)
+	if err != nil {
+		return err
+	}
+
+	if generator == nil {
+		if policy.Generator == nil {
+			return fmt.Errorf("no generator is configured for %s, add one to _config.secrets or specify one", JoinPath(path))
+		}
+		generator = policy.Generator
+		path = policy.Path
+	}
+
+	values, err := generator.Generate()
+	if err != nil {
+		return err
+	}
+
+	return cfg.SetGenerated(path, values)
+}
+
+// SetGenerated stores generated values at path, below it for generators producing many values.
+func (cfg *Config) SetGenerated(path []string, values []GeneratedValue) error {
+	for _, value := range values {
+		key := path
+		if value.Key != "" {
+			key = append(append([]string{}, path...), value.Key)
+		}
+		if err := cfg.Set(key, []byte(value.Value), value.Secret, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.rob.mx/nidito/joao/internal/testdata"
+	"git.rob.mx/nidito/joao/internal/testdata/opconnect"
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+func TestParseMaxAge(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"90d": 90 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+	} {
+		if got, err := config.ParseMaxAge(value); err != nil || got != expected {
+			t.Fatalf("unexpected max age for %s: %s (%v)", value, got, err)
+		}
+	}
+
+	if _, err := config.ParseMaxAge("soon"); err == nil {
+		t.Fatal("expected an error for an invalid max age")
+	}
+}
+
+func rotatedAt(t *testing.T, name, path string) time.Time {
+	t.Helper()
+	item, err := opconnect.Get(name, "example")
+	if err != nil {
+		t.Fatalf("could not get item %s: %s", name, err)
+	}
+	return config.RotatedAt(item)[path]
+}
+
+func backdate(t *testing.T, name, path string, at time.Time) {
+	t.Helper()
+	item, err := opconnect.Get(name, "example")
+	if err != nil {
+		t.Fatalf("could not get item %s: %s", name, err)
+	}
+	for _, field := range item.Fields {
+		if field.Label == "~rotated-at."+path {
+			field.Value = at.Format(time.RFC3339)
+			return
+		}
+	}
+	t.Fatalf("no rotation recorded for %s", path)
+}
+
+func TestRotationTracking(t *testing.T) {
+	testdata.MockOPConnect(t)
+	dir := refFixtures(t, map[string]string{
+		".joao.yaml": "vault: example\nmaxAge: 90d\n",
+		"app.yaml": `_config: !!joao
+  name: app
+  secrets:
+    db.password:
+      maxAge: 7d
+host: db.example.com
+token: !!secret abc
+db:
+  password: !!secret hunter2
+`,
+	})
+
+	file, err := config.LoadFile(filepath.Join(dir, "app.yaml"))
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+	cfg := file.Documents[0]
+
+	if err := cfg.Flush(); err != nil {
+		t.Fatalf("could not flush: %s", err)
+	}
+
+	if at := rotatedAt(t, "app", "db.password"); time.Since(at) > time.Minute {
+		t.Fatalf("expected db.password to be rotated just now, got %s", at)
+	}
+
+	if at := rotatedAt(t, "app", "host"); !at.IsZero() {
+		t.Fatalf("expected no rotation recorded for plain values, got %s", at)
+	}
+
+	old := time.Now().Add(-30 * 24 * time.Hour).UTC().Truncate(time.Second)
+	backdate(t, "app", "db.password", old)
+	backdate(t, "app", "token", old)
+
+	// unchanged secrets keep their rotation
+	if err := cfg.Flush(); err != nil {
+		t.Fatalf("could not flush again: %s", err)
+	}
+	if at := rotatedAt(t, "app", "db.password"); !at.Equal(old) {
+		t.Fatalf("expected db.password rotation to be kept at %s, got %s", old, at)
+	}
+
+	item, _ := opconnect.Get("app", "example")
+	stale, err := file.Stale(cfg, item, time.Now())
+	if err != nil {
+		t.Fatalf("could not list stale secrets: %s", err)
+	}
+	if len(stale) != 1 || stale[0].Path[1] != "password" || stale[0].MaxAge != 7*24*time.Hour {
+		t.Fatalf("expected only db.password to be stale, got %+v", stale)
+	}
+
+	// changed secrets are rotated now
+	if err := cfg.Set([]string{"db", "password"}, []byte("hunter3"), true, false); err != nil {
+		t.Fatalf("could not set: %s", err)
+	}
+	if err := cfg.Flush(); err != nil {
+		t.Fatalf("could not flush changes: %s", err)
+	}
+
+	if at := rotatedAt(t, "app", "db.password"); time.Since(at) > time.Minute {
+		t.Fatalf("expected db.password to be rotated just now, got %s", at)
+	}
+	if at := rotatedAt(t, "app", "token"); !at.Equal(old) {
+		t.Fatalf("expected token rotation to be kept at %s, got %s", old, at)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := refFixtures(t, map[string]string{
+		"app.yaml": `_config: !!joao
+  vault: example
+  name: app
+db:
+  password: !!generate {kind: password, length: 12}
+deploy: !!generate ed25519
+plain: !!secret hunter2
+`,
+	})
+
+	file, err := config.LoadFile(filepath.Join(dir, "app.yaml"))
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+	cfg := file.Documents[0]
+
+	if _, err := cfg.Materialize(); err != nil {
+		t.Fatalf("could not materialize: %s", err)
+	}
+
+	policy, err := file.Rotation(cfg, []string{"deploy", "private"})
+	if err != nil {
+		t.Fatalf("could not get rotation policy: %s", err)
+	}
+	if policy.Generator == nil || policy.Generator.Kind != "ed25519" || len(policy.Path) != 1 {
+		t.Fatalf("unexpected policy for deploy.private: %+v", policy)
+	}
+
+	password := cfg.Tree.Lookup([]string{"db", "password"}).Value
+	private := cfg.Tree.Lookup([]string{"deploy", "private"}).Value
+	if err := file.Rotate(cfg, []string{"db", "password"}, nil); err != nil {
+		t.Fatalf("could not rotate db.password: %s", err)
+	}
+	if err := file.Rotate(cfg, []string{"deploy", "private"}, nil); err != nil {
+		t.Fatalf("could not rotate deploy.private: %s", err)
+	}
+
+	if rotated := cfg.Tree.Lookup([]string{"db", "password"}); rotated.Value == password || len(rotated.Value) != 12 || !rotated.IsSecret() {
+		t.Fatalf("db.password was not rotated: %+v", rotated)
+	}
+	if rotated := cfg.Tree.Lookup([]string{"deploy", "private"}); rotated.Value == private || !rotated.IsSecret() {
+		t.Fatalf("deploy.private was not rotated: %+v", rotated)
+	}
+
+	if err := file.Rotate(cfg, []string{"plain"}, nil); err == nil {
+		t.Fatal("expected an error rotating a secret without a generator")
+	}
+
+	gen, _ := config.ParseGenerator("hex,length=4")
+	if err := file.Rotate(cfg, []string{"plain"}, gen); err != nil {
+		t.Fatalf("could not rotate with a generator: %s", err)
+	}
+	if rotated := cfg.Tree.Lookup([]string{"plain"}); len(rotated.Value) != 8 || !rotated.IsSecret() {
+		t.Fatalf("plain was not rotated: %+v", rotated)
+	}
+}
@@ -0,0 +1,525 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema describes the keys a config may hold. Keys are dotted paths, where `*` matches any key or list index,
+// i.e. `servers.*.host`.
+type Schema struct {
+	// Strict rejects top-level keys not declared in the schema.
+	Strict bool                  `yaml:"strict,omitempty" json:"strict,omitempty"`
+	Keys   map[string]*KeySchema `yaml:"keys" json:"keys"`
+	sorted [][]string
+}
+
+// KeySchema describes the values at a key path.
+type KeySchema struct {
+	// Type is one of string, int, float, bool, null, map or list.
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	// Required keys must be present whenever their parent is.
+	Required bool `yaml:"required,omitempty" json:"required,omitempty"`
+	// Secret tells if values must (true) or must not (false) be secret.
+	Secret *bool `yaml:"secret,omitempty" json:"secret,omitempty"`
+	// Enum lists the values allowed.
+	Enum []string `yaml:"enum,omitempty" json:"enum,omitempty"`
+	// Pattern is a regular expression values must match.
+	Pattern string `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	// Strict rejects keys of this map not declared in the schema.
+	Strict      bool   `yaml:"strict,omitempty" json:"strict,omitempty"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	pattern     *regexp.Regexp
+}
+
+// SchemaRule validates config files matching a glob against a schema, configured in `.joao.yaml`.
+type SchemaRule struct {
+	// Match is a glob matched against file names, or against paths relative to the repo config if it has slashes.
+	Match string `yaml:"match"`
+	// Schema is the path to the schema file, relative to the repo config.
+	Schema string `yaml:"schema"`
+}
+
+// schemaTypes maps JSON Schema types, and a few aliases, to the ones joao uses.
+var schemaTypes = map[string]string{
+	"string":  "string",
+	"int":     "int",
+	"integer": "int",
+	"float":   "float",
+	"number":  "float",
+	"bool":    "bool",
+	"boolean": "bool",
+	"null":    "null",
+	"map":     "map",
+	"object":  "map",
+	"list":    "list",
+	"array":   "list",
+}
+
+// ValidationError is a problem found validating a config against its schema.
+type ValidationError struct {
+	File    string
+	Path    []string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (err *ValidationError) Error() string {
+	position := err.File
+	if err.Line > 0 {
+		position = fmt.Sprintf("%s:%d:%d", position, err.Line, err.Column)
+	}
+
+	path := JoinPath(err.Path)
+	if path == "" {
+		path = "."
+	}
+
+	if position == "" {
+		return fmt.Sprintf("%s: %s", path, err.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", position, path, err.Message)
+}
+
+// ValidationErrors are all the problems found validating a config.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, 0, len(errs))
+	for _, err := range errs {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// LoadSchema reads a schema file, either in joao's format (with a `keys` map) or as a JSON Schema.
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read schema %s: %w", path, err)
+	}
+
+	schema, err := ParseSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse schema %s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// ParseSchema decodes a schema in joao's format (with a `keys` map) or as a JSON Schema, from YAML or JSON data.
+func ParseSchema(data []byte) (*Schema, error) {
+	raw := map[string]any{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{Keys: map[string]*KeySchema{}}
+	if _, native := raw["keys"]; native {
+		if err := yaml.Unmarshal(data, schema); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := schema.addJSONSchema(nil, raw, false); err != nil {
+			return nil, err
+		}
+	}
+
+	for path, key := range schema.Keys {
+		if key == nil {
+			key = &KeySchema{}
+			schema.Keys[path] = key
+		}
+
+		if key.Type != "" {
+			kind, ok := schemaTypes[key.Type]
+			if !ok {
+				return nil, fmt.Errorf("unknown type %s for %s", key.Type, path)
+			}
+			key.Type = kind
+		}
+
+		if key.Pattern != "" {
+			pattern, err := regexp.Compile(key.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern for %s: %w", path, err)
+			}
+			key.pattern = pattern
+		}
+	}
+
+	return schema, nil
+}
+
+// addJSONSchema adds the keys described by a JSON Schema node at path.
+func (s *Schema) addJSONSchema(path []string, node map[string]any, required bool) error {
+	key := &KeySchema{Required: required}
+	if len(path) > 0 {
+		s.Keys[JoinPath(path)] = key
+	}
+
+	switch kind := node["type"].(type) {
+	case string:
+		key.Type = kind
+	case []any:
+		// nullable types are checked against the first non-null one
+		for _, t := range kind {
+			if t != "null" {
+				key.Type = fmt.Sprint(t)
+				break
+			}
+		}
+	}
+
+	if description, ok := node["description"].(string); ok {
+		key.Description = description
+	}
+	if pattern, ok := node["pattern"].(string); ok {
+		key.Pattern = pattern
+	}
+	if enum, ok := node["enum"].([]any); ok {
+		for _, value := range enum {
+			key.Enum = append(key.Enum, fmt.Sprint(value))
+		}
+	}
+	for _, keyword := range []string{"x-secret", "writeOnly"} {
+		if secret, ok := node[keyword].(bool); ok {
+			key.Secret = &secret
+		}
+	}
+
+	requiredKeys := map[string]bool{}
+	if list, ok := node["required"].([]any); ok {
+		for _, name := range list {
+			requiredKeys[fmt.Sprint(name)] = true
+		}
+	}
+
+	if properties, ok := node["properties"].(map[string]any); ok {
+		for name, child := range properties {
+			childNode, ok := child.(map[string]any)
+			if !ok {
+				return fmt.Errorf("property %s of %s is not a schema", name, strings.Join(path, "."))
+			}
+			if err := s.addJSONSchema(append(append([]string{}, path...), name), childNode, requiredKeys[name]); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch additional := node["additionalProperties"].(type) {
+	case bool:
+		if !additional {
+			if len(path) == 0 {
+				s.Strict = true
+			}
+			key.Strict = true
+		}
+	case map[string]any:
+		if err := s.addJSONSchema(append(append([]string{}, path...), "*"), additional, false); err != nil {
+			return err
+		}
+	}
+
+	if items, ok := node["items"].(map[string]any); ok {
+		if err := s.addJSONSchema(append(append([]string{}, path...), "*"), items, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func pathMatches(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for idx, part := range pattern {
+		if part != "*" && part != path[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// patterns returns the key paths in the schema, split and sorted so literal keys come before wildcards.
+func (s *Schema) patterns() [][]string {
+	if s.sorted != nil {
+		return s.sorted
+	}
+
+	patterns := make([][]string, 0, len(s.Keys))
+	for key := range s.Keys {
+		pattern, err := SplitPath(key)
+		if err != nil {
+			pattern = strings.Split(key, ".")
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	sort.Slice(patterns, func(i, j int) bool {
+		a, b := JoinPath(patterns[i]), JoinPath(patterns[j])
+		wa, wb := strings.Count(a, "*"), strings.Count(b, "*")
+		if wa != wb {
+			return wa < wb
+		}
+		return a < b
+	})
+	s.sorted = patterns
+	return patterns
+}
+
+// Lookup returns the schema for the key at path, if any.
+func (s *Schema) Lookup(path []string) *KeySchema {
+	for _, pattern := range s.patterns() {
+		if pathMatches(pattern, path) {
+			return s.Keys[JoinPath(pattern)]
+		}
+	}
+	return nil
+}
+
+// declares tells if the schema describes path, or keys below it.
+func (s *Schema) declares(path []string) bool {
+	for _, pattern := range s.patterns() {
+		if len(pattern) >= len(path) && pathMatches(pattern[0:len(path)], path) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueType returns the schema type of the value at e, looking at the value of secrets.
+func (e *Entry) valueType() string {
+	switch e.Kind {
+	case yaml.MappingNode, yaml.DocumentNode:
+		return "map"
+	case yaml.SequenceNode:
+		return "list"
+	}
+
+	tag := e.Type
+	if e.IsSecret() {
+		tag = (&yaml.Node{Kind: yaml.ScalarNode, Value: e.Value}).ShortTag()
+	}
+
+	switch tag {
+	case "!!int":
+		return "int"
+	case "!!float":
+		return "float"
+	case "!!bool":
+		return "bool"
+	case "!!null":
+		return "null"
+	}
+	return "string"
+}
+
+// Validate checks the tree at e against schema, returning ValidationErrors if it's invalid. Errors point to file,
+// unless the values were inherited from another one.
+func (s *Schema) Validate(e *Entry, file string) error {
+	errs := ValidationErrors{}
+	s.validate(e, file, &errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].File != errs[j].File {
+			return errs[i].File < errs[j].File
+		}
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		return errs[i].Column < errs[j].Column
+	})
+	return errs
+}
+
+func (s *Schema) validate(e *Entry, file string, errs *ValidationErrors) {
+	fail := func(entry *Entry, path []string, format string, args ...any) {
+		origin := file
+		if entry.origin != "" {
+			origin = entry.origin
+		}
+		*errs = append(*errs, &ValidationError{
+			File:    origin,
+			Path:    path,
+			Line:    entry.Line,
+			Column:  entry.Column,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if len(e.Path) > 0 {
+		if key := s.Lookup(e.Path); key != nil && !e.IsRef() {
+			s.validateValue(e, key, fail)
+		}
+	}
+
+	if e.IsScalar() {
+		return
+	}
+
+	strict := s.Strict
+	if len(e.Path) > 0 {
+		strict = false
+		if key := s.Lookup(e.Path); key != nil {
+			strict = key.Strict
+		}
+	}
+
+	step := 1
+	start := 0
+	if e.Kind == yaml.MappingNode {
+		start, step = 1, 2
+	}
+
+	for idx := start; idx < len(e.Content); idx += step {
+		child := e.Content[idx]
+		if len(e.Path) == 0 && child.Type == YAMLTypeMetaConfig {
+			continue
+		}
+
+		if strict && !s.declares(child.Path) {
+			at := child
+			if step == 2 {
+				at = e.Content[idx-1]
+			}
+			fail(at, child.Path, "unknown key %s", child.Name())
+			continue
+		}
+
+		s.validate(child, file, errs)
+	}
+
+	if e.Kind != yaml.MappingNode {
+		return
+	}
+
+	for _, pattern := range s.patterns() {
+		key := s.Keys[JoinPath(pattern)]
+		name := pattern[len(pattern)-1]
+		if !key.Required || name == "*" || !pathMatches(pattern[0:len(pattern)-1], e.Path) {
+			continue
+		}
+
+		if e.ChildNamed(name) == nil {
+			fail(e, append(append([]string{}, e.Path...), name), "missing required key %s", name)
+		}
+	}
+}
+
+func (s *Schema) validateValue(e *Entry, key *KeySchema, fail func(*Entry, []string, string, ...any)) {
+	kind := e.valueType()
+	if key.Type != "" && kind != key.Type && !(key.Type == "float" && kind == "int") {
+		fail(e, e.Path, "expected %s, found %s", key.Type, kind)
+		return
+	}
+
+	if key.Secret != nil && *key.Secret != e.IsSecret() {
+		if *key.Secret {
+			fail(e, e.Path, "must be a secret")
+		} else {
+			fail(e, e.Path, "must not be a secret")
+		}
+	}
+
+	if !e.IsScalar() {
+		return
+	}
+
+	if len(key.Enum) > 0 {
+		found := false
+		for _, value := range key.Enum {
+			if value == e.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if e.IsSecret() {
+				fail(e, e.Path, "secret value is not one of %s", strings.Join(key.Enum, ", "))
+			} else {
+				fail(e, e.Path, "%q is not one of %s", e.Value, strings.Join(key.Enum, ", "))
+			}
+		}
+	}
+
+	if key.pattern != nil && !key.pattern.MatchString(e.Value) {
+		fail(e, e.Path, "value does not match %s", key.Pattern)
+	}
+}
+
+// SchemaPath returns the path to the schema cfg, a document of f, is validated against: the one set in its
+// `_config`, or the one in the repo config, either for files matching a glob or for every file. It returns an empty
+// string if there's none.
+func (f *File) SchemaPath(cfg *Config) (string, error) {
+	path, err := filepath.Abs(f.Path)
+	if err != nil {
+		return "", err
+	}
+
+	if meta := cfg.metaConfig(); meta != nil && meta.Schema != "" {
+		if filepath.IsAbs(meta.Schema) {
+			return meta.Schema, nil
+		}
+		return filepath.Join(filepath.Dir(path), meta.Schema), nil
+	}
+
+	rmc, err := findRepoConfig(path)
+	if err != nil || rmc == nil {
+		return "", err
+	}
+
+	schema := rmc.Schema
+	for _, rule := range rmc.Schemas {
+		if globMatches(rule.Match, rmc.Repo, path) {
+			schema = rule.Schema
+			break
+		}
+	}
+
+	if schema == "" || filepath.IsAbs(schema) {
+		return schema, nil
+	}
+	return filepath.Join(rmc.Repo, schema), nil
+}
+
+// Validate checks cfg, a document of f, with the values it inherits, against its schema, if it has one.
+func (f *File) Validate(cfg *Config) error {
+	path, err := f.SchemaPath(cfg)
+	if err != nil || path == "" {
+		return err
+	}
+
+	schema, err := LoadSchema(path)
+	if err != nil {
+		return err
+	}
+
+	return f.ValidateWith(schema, cfg)
+}
+
+// ValidateWith checks cfg, a document of f, with the values it inherits, against schema.
+func (f *File) ValidateWith(schema *Schema, cfg *Config) error {
+	effective, err := f.Effective(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := schema.Validate(effective.Tree, f.Path); err != nil {
+		return fmt.Errorf("%s is invalid:\n%w", f.Label(cfg), err)
+	}
+	return nil
+}
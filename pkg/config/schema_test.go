@@ -0,0 +1,160 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.rob.mx/nidito/joao/pkg/config"
+)
+
+const schemaConfig = `_config: !!joao
+  vault: example
+  name: smtp
+smpt:
+  port: 587
+smtp:
+  port: "587"
+  password: hunter2
+  tls: ssl
+servers:
+  - host: mail.example.com
+  - host: Mail_Example
+`
+
+const schemaNative = `strict: true
+keys:
+  smtp:
+    type: map
+    required: true
+  smtp.port:
+    type: int
+    required: true
+  smtp.password:
+    secret: true
+  smtp.tls:
+    enum: [none, starttls, tls]
+  smtp.username:
+    required: true
+  servers:
+    type: list
+  servers.*.host:
+    pattern: "^[a-z0-9.-]+$"
+`
+
+const schemaJSON = `{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["smtp"],
+  "properties": {
+    "smtp": {
+      "type": "object",
+      "required": ["port", "username"],
+      "properties": {
+        "port": {"type": "integer"},
+        "password": {"type": "string", "writeOnly": true},
+        "tls": {"enum": ["none", "starttls", "tls"]},
+        "username": {"type": "string"}
+      }
+    },
+    "servers": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {"host": {"type": "string", "pattern": "^[a-z0-9.-]+$"}}
+      }
+    }
+  }
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	expected := []string{
+		"smtp.yaml:4:1: smpt: unknown key smpt",
+		"smtp.yaml:7:3: smtp.username: missing required key username",
+		"smtp.yaml:7:9: smtp.port: expected int, found string",
+		"smtp.yaml:8:13: smtp.password: must be a secret",
+		`smtp.yaml:9:8: smtp.tls: "ssl" is not one of none, starttls, tls`,
+		"smtp.yaml:12:11: servers.1.host: value does not match ^[a-z0-9.-]+$",
+	}
+
+	for name, source := range map[string]string{"native": schemaNative, "json": schemaJSON} {
+		t.Run(name, func(t *testing.T) {
+			schema, err := config.ParseSchema([]byte(source))
+			if err != nil {
+				t.Fatalf("could not parse schema: %s", err)
+			}
+
+			dir := refFixtures(t, map[string]string{"smtp.yaml": schemaConfig})
+			file, err := config.LoadFile(filepath.Join(dir, "smtp.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = file.ValidateWith(schema, file.Documents[0])
+			var errs config.ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected validation errors, got %v", err)
+			}
+
+			got := []string{}
+			for _, err := range errs {
+				err.File = filepath.Base(err.File)
+				got = append(got, err.Error())
+			}
+
+			if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+				t.Fatalf("unexpected errors.\nwanted:\n%s\n---\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestSchemaValid(t *testing.T) {
+	dir := refFixtures(t, map[string]string{
+		".joao.yaml": `vault: example
+schema: schemas/default.yaml
+schemas:
+  - match: "smtp.yaml"
+    schema: schemas/smtp.yaml
+`,
+		"smtp.yaml": `smtp:
+  port: 587
+  username: mail@example.com
+  password: !!secret hunter2
+  tls: starttls
+`,
+		"other.yaml": "host: example.com\n",
+	})
+	if err := writeSchemas(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{"smtp.yaml": "schemas/smtp.yaml", "other.yaml": "schemas/default.yaml"} {
+		file, err := config.LoadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path, err := file.SchemaPath(file.Documents[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != filepath.Join(dir, expected) {
+			t.Fatalf("unexpected schema for %s: %s", name, path)
+		}
+
+		if err := file.Validate(file.Documents[0]); err != nil {
+			t.Fatalf("expected %s to be valid, got %s", name, err)
+		}
+	}
+}
+
+func writeSchemas(dir string) error {
+	return refFixturesIn(dir, map[string]string{
+		"schemas/smtp.yaml":    schemaNative,
+		"schemas/default.yaml": "keys:\n  host:\n    type: string\n    required: true\n",
+	})
+}
@@ -0,0 +1,182 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const JoaoReferencePrefix = "joao://"
+
+// Renderer resolves references to configuration values in go templates, loading each config only once, whether
+// it's referenced from templates or from other configs.
+type Renderer struct {
+	// Dir is where relative paths to config files are resolved from.
+	Dir string
+	// Remote loads config files from 1Password instead of the filesystem.
+	Remote bool
+	// Redacted renders secret values empty.
+	Redacted bool
+	refs     *RefResolver
+}
+
+// NewRenderer returns a renderer resolving relative paths from dir.
+func NewRenderer(dir string, remote, redacted bool) *Renderer {
+	return &Renderer{
+		Dir:      dir,
+		Remote:   remote,
+		Redacted: redacted,
+		refs:     NewRefResolver(remote),
+	}
+}
+
+// Render executes the template in source, writing the result to out. Templates reference values with:
+//   - `{{ joao "path/to/config.yaml" "dotted.query" }}`, from a config file,
+//   - `{{ joao "op://VAULT/ITEM/path/to/key" }}`, from a 1Password item, or
+//   - `{{ joao "joao://VAULT/ITEM#dotted.query" }}` or `{{ joao "joao://VAULT/ITEM" "dotted.query" }}`, also from a
+//     1Password item, queried like config files are.
+func (r *Renderer) Render(name, source string, out io.Writer) error {
+	tpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"joao": r.value,
+	}).Parse(source)
+	if err != nil {
+		return fmt.Errorf("could not parse template %s: %w", name, err)
+	}
+
+	if r.Redacted {
+		defer setOutputMode([]OutputMode{OutputModeRedacted})()
+	}
+
+	if err := tpl.Execute(out, nil); err != nil {
+		return fmt.Errorf("could not render template %s: %w", name, err)
+	}
+	return nil
+}
+
+func (r *Renderer) value(ref string, query ...string) (string, error) {
+	if strings.HasPrefix(ref, JoaoReferencePrefix) {
+		return r.reference(ref, query...)
+	}
+
+	if IsOPReference(ref) {
+		if len(query) > 0 {
+			return "", fmt.Errorf("%s already points to a key, no query is needed", ref)
+		}
+
+		opRef, err := ParseOPReference(ref)
+		if err != nil {
+			return "", err
+		}
+
+		cfg, err := r.item(opRef.Vault, opRef.Item)
+		if err != nil {
+			return "", err
+		}
+		return r.lookup(cfg, ref, opRef.Path)
+	}
+
+	if len(query) > 1 {
+		return "", fmt.Errorf("only one query can be given for %s", ref)
+	}
+
+	path := ref
+	if argIsConfigFile(path) && !filepath.IsAbs(path) {
+		path = filepath.Join(r.Dir, path)
+	}
+
+	cfg, err := r.config(path)
+	if err != nil {
+		return "", err
+	}
+
+	keys := []string{}
+	if len(query) > 0 {
+		if keys, err = SplitPath(query[0]); err != nil {
+			return "", err
+		}
+	}
+	return r.lookup(cfg, ref, keys)
+}
+
+// reference resolves a `joao://VAULT/ITEM#QUERY` reference, or a `joao://VAULT/ITEM` one followed by a query.
+func (r *Renderer) reference(ref string, query ...string) (string, error) {
+	itemRef, inline, hasInline := strings.Cut(strings.TrimPrefix(ref, JoaoReferencePrefix), "#")
+	if hasInline {
+		query = append([]string{inline}, query...)
+	}
+
+	if len(query) > 1 {
+		return "", fmt.Errorf("only one query can be given for %s", ref)
+	}
+
+	vault, name, _ := strings.Cut(itemRef, "/")
+	if vault == "" || name == "" {
+		return "", fmt.Errorf("invalid reference %s, expected %sVAULT/ITEM#QUERY", ref, JoaoReferencePrefix)
+	}
+
+	cfg, err := r.item(vault, name)
+	if err != nil {
+		return "", err
+	}
+
+	keys := []string{}
+	if len(query) > 0 {
+		if keys, err = SplitPath(query[0]); err != nil {
+			return "", err
+		}
+	}
+	return r.lookup(cfg, ref, keys)
+}
+
+func (r *Renderer) lookup(cfg *Config, ref string, keys []string) (string, error) {
+	entry := cfg.Tree.Lookup(keys)
+	if entry == nil {
+		return "", fmt.Errorf("value not found at %s of %s", JoinPath(keys), ref)
+	}
+
+	if entry.IsScalar() {
+		return entry.String(), nil
+	}
+
+	val := entry.AsMap()
+	if entry == cfg.Tree {
+		// ToMap would reset the output mode we're rendering with
+		tree := map[string]any{}
+		for idx := 1; idx < len(entry.Content); idx += 2 {
+			if child := entry.Content[idx]; child.Type != YAMLTypeMetaConfig {
+				tree[child.Name()] = child.AsMap()
+			}
+		}
+		val = tree
+	}
+
+	bytes, err := json.Marshal(val)
+	if err != nil {
+		return "", fmt.Errorf("could not serialize %s as json: %w", ref, err)
+	}
+	return string(bytes), nil
+}
+
+// config returns the config at path with its references resolved, sharing loaded configs with the ref resolver.
+func (r *Renderer) config(path string) (*Config, error) {
+	cfg, err := r.refs.config(path)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, r.refs.ResolveConfig(cfg, path)
+}
+
+// item returns the config at a 1Password item with its references resolved, sharing fetched items with the ref
+// resolver.
+func (r *Renderer) item(vault, name string) (*Config, error) {
+	cfg, err := r.refs.item(vault, name)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, r.refs.Resolve(cfg.Tree, "")
+}
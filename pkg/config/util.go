@@ -11,7 +11,6 @@ import (
 	"text/template"
 
 	"github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v3"
 )
 
 type opDetails struct {
@@ -19,19 +18,27 @@ type opDetails struct {
 	Name         string `yaml:"name"`
 	NameTemplate string `yaml:"nameTemplate"` // nolint: tagliatelle
 	Repo         string
+	// Extends lists the files an embedded config is applied on top of.
+	Extends []string `yaml:"extends"`
+	// Flush tells if an embedded config flushes its effective tree or just its own values.
+	Flush string `yaml:"flush"`
+	// Overlays make files in a repo extend others.
+	Overlays []*OverlayRule `yaml:"overlays"`
+	// Schema is the path to the schema configs are validated against.
+	Schema string `yaml:"schema"`
+	// Schemas validate files in a repo matching globs against other schemas.
+	Schemas []*SchemaRule `yaml:"schemas"`
+	// MaxAge is how long secrets may go without being rotated.
+	MaxAge string `yaml:"maxAge"` // nolint: tagliatelle
 }
 
 type singleModeConfig struct {
 	Config *opDetails `yaml:"_config,omitempty"` // nolint: tagliatelle
 }
 
-func argIsYAMLFile(path string) bool {
-	return strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
-}
-
 // VaultAndNameFrom path/buffer reads a path (unless a buffer is provided) and gets the 1Password
 // item name and vault name:
-// first, it looks at the embedded `_config: !!joao` YAML item.
+// first, it looks at the embedded `_config: !!joao` item.
 // if it still needs a vault or name, it looks for the repo config, erroring if none found
 // otherwise, it'll fill in missing values from the found repo config
 func VaultAndNameFrom(path string, buf []byte) (name string, vault string, err error) {
@@ -46,10 +53,19 @@ func VaultAndNameFrom(path string, buf []byte) (name string, vault string, err e
 		}
 	}
 
-	// decode single-mode config
-	if err = yaml.Unmarshal(buf, &smc); err == nil && smc.Config != nil {
-		name = smc.Config.Name
-		vault = smc.Config.Vault
+	// decode single-mode config, from the first document
+	if docs, err := CodecFor(path).Decode(buf); err == nil && docs[0].Decode(&smc) == nil {
+		return vaultAndNameFor(path, smc.Config)
+	}
+
+	return vaultAndNameFor(path, nil)
+}
+
+// vaultAndNameFor fills in the name and vault missing from a document's embedded config with the repo config's.
+func vaultAndNameFor(path string, embedded *opDetails) (name string, vault string, err error) {
+	if embedded != nil {
+		name = embedded.Name
+		vault = embedded.Vault
 	}
 
 	// if we have both name and vault, return early
@@ -9,7 +9,26 @@ import (
 	"golang.org/x/crypto/blake2b"
 )
 
+// keyEscaper escapes the characters that would otherwise delimit keys in field labels and queries.
+var keyEscaper = strings.NewReplacer(`\`, `\\`, `.`, `\.`, `[`, `\[`)
+
+// EscapeKey escapes dots, brackets and backslashes within a single key, so labels and queries joined from many keys
+// can be split back into them.
+func EscapeKey(key string) string {
+	return keyEscaper.Replace(key)
+}
+
+// unescapedKey returns key as-is, the way labels were joined before keys were escaped.
+func unescapedKey(key string) string {
+	return key
+}
+
 func Checksum(fields []*op.ItemField) string {
+	return checksum(fields, EscapeKey)
+}
+
+// checksum hashes the values of fields along with their labels, prefixed by their section's label escaped with escape.
+func checksum(fields []*op.ItemField, escape func(string) string) string {
 	newHash, err := blake2b.New256(nil)
 	if err != nil {
 		panic(err)
@@ -26,7 +45,7 @@ func Checksum(fields []*op.ItemField) string {
 				sectionID = field.Section.ID
 			}
 			if sectionID != "" {
-				label = sectionID + "." + label
+				label = escape(sectionID) + "." + label
 			}
 		}
 		df = append(df, label+field.Value)
@@ -36,3 +55,12 @@ func Checksum(fields []*op.ItemField) string {
 	checksum := newHash.Sum(nil)
 	return fmt.Sprintf("%x", checksum)
 }
+
+// VerifyChecksum computes the checksum for an item's fields and returns it, along with whether it
+// matches the checksum stored in the item's password field. Checksums of items flushed before keys were
+// escaped within labels are accepted, too.
+func VerifyChecksum(item *op.Item) (string, bool) {
+	cs := Checksum(item.Fields)
+	stored := item.GetValue("password")
+	return cs, cs == stored || checksum(item.Fields, unescapedKey) == stored
+}
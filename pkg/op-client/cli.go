@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	op "github.com/1Password/connect-sdk-go/onepassword"
@@ -85,7 +86,7 @@ func (b *CLI) Get(vault, name string) (*op.Item, error) {
 func (b *CLI) Create(vault string, item *op.Item) error {
 	logrus.Infof("Creating new item: %s/%s", vault, item.Title)
 
-	itemJSON, err := json.Marshal(item)
+	itemJSON, err := json.Marshal(withoutFiles(item))
 	if err != nil {
 		return fmt.Errorf("could not serialize op item into json: %w", err)
 	}
@@ -97,6 +98,10 @@ func (b *CLI) Create(vault string, item *op.Item) error {
 		return fmt.Errorf("could not create item: %w", err)
 	}
 
+	if err := b.attach(vault, item.Title, item, nil); err != nil {
+		return err
+	}
+
 	logrus.Infof("Item %s/%s created", vault, item.Title)
 	return nil
 }
@@ -123,7 +128,7 @@ func (b *CLI) Update(item *op.Item, remote *op.Item) error {
 func (b *CLI) UpdateModern(updated *op.Item, original *op.Item) error {
 	updated.ID = original.ID
 	updated.Vault = original.Vault
-	itemJSON, err := json.Marshal(updated)
+	itemJSON, err := json.Marshal(withoutFiles(updated))
 	if err != nil {
 		return fmt.Errorf("could not serialize op item into json: %w", err)
 	}
@@ -134,6 +139,10 @@ func (b *CLI) UpdateModern(updated *op.Item, original *op.Item) error {
 		return fmt.Errorf("could not create item: %w", err)
 	}
 
+	if err := b.attach(updated.Vault.ID, original.Title, updated, original); err != nil {
+		return err
+	}
+
 	logrus.Infof("Item %s/%s updated", updated.Vault.ID, updated.Title)
 	return nil
 }
@@ -173,10 +182,122 @@ func (b *CLI) DeprecatedUpdate(updated *op.Item, original *op.Item) error {
 		logrus.Errorf("op stderr: %s", stdout.String())
 		return err
 	}
+
+	if err := b.attach(updated.Vault.ID, updated.Title, updated, original); err != nil {
+		return err
+	}
 	logrus.Infof("Item %s/%s updated", updated.Vault.ID, updated.Title)
 	return nil
 }
 
 func (b *CLI) List(vault, prefix string) ([]string, error) {
-	return nil, nil
+	items, err := b.Items(vault)
+	if err != nil {
+		return nil, err
+	}
+	return titlesWithPrefix(items, prefix), nil
+}
+
+func (b *CLI) Items(vault string) ([]op.Item, error) {
+	stdout, err := invoke(false, vault, nil, "item", "list", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var items []op.Item
+	if err := json.Unmarshal(stdout.Bytes(), &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (b *CLI) FileContent(vault string, item *op.Item, file *op.File) ([]byte, error) {
+	itemRef := item.ID
+	if itemRef == "" {
+		itemRef = item.Title
+	}
+
+	fileRef := file.ID
+	if fileRef == "" {
+		fileRef = file.Name
+	}
+
+	stdout, err := invoke(false, "", nil, "read", "--no-newline", fmt.Sprintf("op://%s/%s/%s", vault, itemRef, fileRef))
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s: %w", file.Name, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// withoutFiles returns a copy of item without files, which are attached separately.
+func withoutFiles(item *op.Item) *op.Item {
+	copied := *item
+	copied.Files = nil
+	return &copied
+}
+
+// attach uploads the files of item that changed since remote, and deletes the ones remote holds that item doesn't.
+func (b *CLI) attach(vault, title string, item, remote *op.Item) error {
+	changed := changedFiles(item, remote)
+	removed := removedFiles(item, remote)
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	existing := map[string]bool{}
+	if remote != nil {
+		for _, file := range remote.Files {
+			existing[file.Name] = true
+		}
+	}
+
+	// replaced files are deleted first, so they're not attached twice
+	deletions := []string{}
+	for _, file := range append(removed, changed...) {
+		if existing[file.Name] {
+			deletions = append(deletions, fieldName(file.Name)+"[delete]")
+		}
+	}
+
+	if len(deletions) > 0 {
+		if _, err := invoke(b.DryRun, vault, nil, append([]string{"item", "edit", title, "--"}, deletions...)...); err != nil {
+			return fmt.Errorf("could not delete files: %w", err)
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "joao-files-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	attachments := []string{}
+	for idx, file := range changed {
+		content, err := file.Content()
+		if err != nil {
+			return fmt.Errorf("could not attach %s: %w", file.Name, err)
+		}
+
+		// files are named after the file they're attached from
+		path := filepath.Join(dir, fmt.Sprintf("%d", idx), file.Name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			return err
+		}
+		attachments = append(attachments, fmt.Sprintf("%s[file]=%s", fieldName(file.Name), path))
+	}
+
+	if _, err := invoke(b.DryRun, vault, nil, append([]string{"item", "edit", title, "--"}, attachments...)...); err != nil {
+		return fmt.Errorf("could not attach files: %w", err)
+	}
+
+	logrus.Infof("Attached %d files to %s/%s", len(changed), vault, title)
+	return nil
 }
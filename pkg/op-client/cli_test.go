@@ -157,3 +157,67 @@ func TestUpdate(t *testing.T) {
 		t.Fatalf("client called unexpected stdin.\nwant: %s\n got: %s", wantedStdin, calledStdin)
 	}
 }
+
+func TestUpdateAttachesFiles(t *testing.T) {
+	client := &opclient.CLI{}
+	calls := []string{}
+	attached := map[string]string{}
+	opclient.Exec = func(program string, args []string, stdin *bytes.Buffer) (bytes.Buffer, error) {
+		if strings.Contains(strings.Join(args, " "), "--version") {
+			return *bytes.NewBufferString("2.30"), nil
+		}
+
+		for _, arg := range args {
+			if name, path, found := strings.Cut(arg, "[file]="); found {
+				content, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("could not read attachment %s: %s", path, err)
+				}
+				attached[name] = string(content)
+				arg = name + "[file]"
+			}
+			calls = append(calls, arg)
+		}
+		calls = append(calls, "\n")
+		return *bytes.NewBufferString("updated"), nil
+	}
+
+	annotation := func(name, value string) *onepassword.ItemField {
+		return &onepassword.ItemField{
+			ID:      "~annotations." + name,
+			Section: &onepassword.ItemSection{ID: "~annotations", Label: "~annotations"},
+			Type:    "STRING",
+			Label:   name,
+			Value:   value,
+		}
+	}
+
+	original := testdata.NewTestConfig("some:test")
+	original.Fields = []*onepassword.ItemField{annotation("kept", "file:1"), annotation("tls.key", "file:2"), annotation("gone", "file:3")}
+	original.Files = []*onepassword.File{{ID: "a", Name: "kept"}, {ID: "b", Name: "tls.key"}, {ID: "c", Name: "gone"}}
+
+	updated := testdata.NewTestConfig(original.Title)
+	updated.Fields = []*onepassword.ItemField{annotation("kept", "file:1"), annotation("tls.key", "file:4"), annotation("new", "binary:5")}
+	updated.Files = []*onepassword.File{{Name: "kept"}, {Name: "tls.key"}, {Name: "new"}}
+	for _, file := range updated.Files {
+		file.SetContent([]byte(file.Name + " contents"))
+	}
+
+	if err := client.Update(updated, original); err != nil {
+		t.Fatalf("Failed in test update: %s", err)
+	}
+
+	got := strings.Join(calls, " ")
+	wanted := strings.Join([]string{
+		"--vault example item edit some:test \n",
+		"--vault example item edit some:test -- gone[delete] tls\\.key[delete] \n",
+		"--vault example item edit some:test -- tls\\.key[file] new[file] \n",
+	}, " ")
+	if got != wanted {
+		t.Fatalf("client called unexpected arguments.\nwant: %q\n got: %q", wanted, got)
+	}
+
+	if attached["tls\\.key"] != "tls.key contents" || attached["new"] != "new contents" || len(attached) != 2 {
+		t.Fatalf("unexpected attachments: %v", attached)
+	}
+}
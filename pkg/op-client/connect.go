@@ -3,8 +3,6 @@
 package opclient
 
 import (
-	"strings"
-
 	"github.com/1Password/connect-sdk-go/connect"
 	op "github.com/1Password/connect-sdk-go/onepassword"
 )
@@ -30,6 +28,8 @@ func IsValidClientUUID(uuid string) bool {
 	return true
 }
 
+// Connect reads and writes items through 1Password Connect, which can download file attachments but not upload
+// them: creating or updating items with new or changed files returns ErrorConnectFiles.
 type Connect struct {
 	client connect.Client
 }
@@ -48,26 +48,38 @@ func (b *Connect) Get(vault, name string) (*op.Item, error) {
 }
 
 func (b *Connect) Update(item *op.Item, remote *op.Item) error {
-	_, err := b.client.UpdateItem(item, item.Vault.ID)
+	if len(changedFiles(item, remote)) > 0 {
+		return ErrorConnectFiles
+	}
+
+	// items are updated by id, which local items don't know about
+	update := *item
+	update.ID = remote.ID
+	_, err := b.client.UpdateItem(&update, item.Vault.ID)
 	return err
 }
 
 func (b *Connect) List(vault, prefix string) ([]string, error) {
-	items, err := b.client.GetItems(vault)
+	items, err := b.Items(vault)
 	if err != nil {
 		return nil, err
 	}
-	res := []string{}
-	for _, item := range items {
-		if prefix != "" && !strings.HasPrefix(item.Title, prefix) {
-			continue
-		}
-		res = append(res, item.Title)
-	}
-	return res, nil
+	return titlesWithPrefix(items, prefix), nil
+}
+
+func (b *Connect) Items(vault string) ([]op.Item, error) {
+	return b.client.GetItems(vault)
 }
 
 func (b *Connect) Create(vault string, item *op.Item) error {
+	if len(item.Files) > 0 {
+		return ErrorConnectFiles
+	}
+
 	_, err := b.client.CreateItem(item, vault)
 	return err
 }
+
+func (b *Connect) FileContent(vault string, item *op.Item, file *op.File) ([]byte, error) {
+	return b.client.GetFileContent(file)
+}
@@ -0,0 +1,37 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package opclient_test
+
+import (
+	"errors"
+	"testing"
+
+	"git.rob.mx/nidito/joao/internal/testdata"
+	"git.rob.mx/nidito/joao/internal/testdata/opconnect"
+	opclient "git.rob.mx/nidito/joao/pkg/op-client"
+	"github.com/1Password/connect-sdk-go/onepassword"
+)
+
+func TestConnectUpdate(t *testing.T) {
+	testdata.MockOPConnect(t)
+	remote := opconnect.Add(testdata.NewTestConfig("some:test"))
+	client := opclient.NewConnect("", "")
+
+	item := testdata.NewTestConfig("some:test")
+	if err := client.Update(item, remote); err != nil {
+		t.Fatalf("could not update: %s", err)
+	}
+
+	if item.ID != "" {
+		t.Fatalf("update changed the id of the given item to %s", item.ID)
+	}
+
+	if _, err := opconnect.Get(remote.ID, remote.Vault.ID); err != nil {
+		t.Fatalf("item was not updated by id: %s", err)
+	}
+
+	item.Files = []*onepassword.File{{Name: "keystore"}}
+	if err := client.Update(item, remote); !errors.Is(err, opclient.ErrorConnectFiles) {
+		t.Fatalf("expected files to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright © 2022 Roberto Hidalgo <joao@un.rob.mx>
+// SPDX-License-Identifier: Apache-2.0
+package opclient
+
+import (
+	"fmt"
+
+	op "github.com/1Password/connect-sdk-go/onepassword"
+)
+
+// ErrorConnectFiles is returned when flushing files through 1Password Connect, which can only read them.
+var ErrorConnectFiles = fmt.Errorf("1Password Connect cannot upload files, use the op CLI to flush them instead")
+
+// FileContent returns the contents of a file attached to item, downloading them unless already loaded.
+func FileContent(vault string, item *op.Item, file *op.File) ([]byte, error) {
+	if content, err := file.Content(); err == nil {
+		return content, nil
+	}
+	return client.FileContent(vault, item, file)
+}
+
+// changedFiles returns the files of item that remote lacks, or whose annotation, holding a checksum of their
+// contents, differs.
+func changedFiles(item, remote *op.Item) []*op.File {
+	local := annotations(item)
+	other := annotations(remote)
+	existing := map[string]bool{}
+	if remote != nil {
+		for _, file := range remote.Files {
+			existing[file.Name] = true
+		}
+	}
+
+	changed := []*op.File{}
+	for _, file := range item.Files {
+		if !existing[file.Name] || local[file.Name] != other[file.Name] {
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
+
+// removedFiles returns the files of remote that item no longer holds.
+func removedFiles(item, remote *op.Item) []*op.File {
+	if remote == nil {
+		return nil
+	}
+
+	kept := map[string]bool{}
+	for _, file := range item.Files {
+		kept[file.Name] = true
+	}
+
+	removed := []*op.File{}
+	for _, file := range remote.Files {
+		if !kept[file.Name] {
+			removed = append(removed, file)
+		}
+	}
+	return removed
+}
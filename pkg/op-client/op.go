@@ -34,6 +34,8 @@ type opClient interface {
 	Update(item *op.Item, remote *op.Item) error
 	Create(vault string, item *op.Item) error
 	List(vault, prefix string) ([]string, error)
+	Items(vault string) ([]op.Item, error)
+	FileContent(vault string, item *op.Item, file *op.File) ([]byte, error)
 }
 
 func init() {
@@ -62,7 +64,7 @@ func Update(vault, name string, item *op.Item) error {
 	// we're checking the checksum we just calculated matches the stored on remote
 	// and that remoteCS matching the current item's stored password
 	// nolint:gocritic
-	if remoteCS == item.GetValue("password") && remoteCS == remote.GetValue("password") {
+	if remoteCS == item.GetValue("password") && remoteCS == remote.GetValue("password") && sameAnnotations(item, remote) {
 		logrus.Debugf("remote %s\nlocal %s", remoteCS, item.GetValue("password"))
 		logrus.Warnf("item %s/%s is already up to date", item.Vault.ID, item.Title)
 		return nil
@@ -72,14 +74,70 @@ func Update(vault, name string, item *op.Item) error {
 	return client.Update(item, remote)
 }
 
+// annotations returns the values in the annotations section of item, by label.
+func annotations(item *op.Item) map[string]string {
+	values := map[string]string{}
+	if item == nil {
+		return values
+	}
+
+	for _, field := range item.Fields {
+		if field.Section != nil && field.Section.ID == "~annotations" {
+			values[field.Label] = field.Value
+		}
+	}
+	return values
+}
+
+// sameAnnotations tells if both items hold the same annotations, which checksums leave out.
+func sameAnnotations(item, remote *op.Item) bool {
+	local := annotations(item)
+	other := annotations(remote)
+	if len(local) != len(other) {
+		return false
+	}
+
+	for label, value := range local {
+		if remoteValue, found := other[label]; !found || remoteValue != value {
+			return false
+		}
+	}
+	return true
+}
+
 func List(vault, prefix string) ([]string, error) {
 	return client.List(vault, prefix)
 }
 
+// Items returns the overview of every item in a vault, without their fields.
+func Items(vault string) ([]op.Item, error) {
+	return client.Items(vault)
+}
+
+func titlesWithPrefix(items []op.Item, prefix string) []string {
+	res := []string{}
+	for _, item := range items {
+		if prefix != "" && !strings.HasPrefix(item.Title, prefix) {
+			continue
+		}
+		res = append(res, item.Title)
+	}
+	return res
+}
+
+// assignmentEscaper escapes the characters op assignments would read as delimiters.
+var assignmentEscaper = strings.NewReplacer(`\`, `\\`, `.`, `\.`, `=`, `\=`)
+
+// fieldName escapes the dots in name, which op assignments would read as sections otherwise, along with equal
+// signs and the backslashes in labels of keys holding dots themselves.
+func fieldName(name string) string {
+	return assignmentEscaper.Replace(name)
+}
+
 func keyForField(field *op.ItemField) string {
-	name := strings.ReplaceAll(field.Label, ".", "\\.")
+	name := fieldName(field.Label)
 	if field.Section != nil {
-		name = field.Section.ID + "." + name
+		name = fieldName(field.Section.ID) + "." + name
 	}
 	return name
 }